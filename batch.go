@@ -0,0 +1,466 @@
+package tlog
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultBatchSize is the default number of records sent in one request by batching sinks.
+	DefaultBatchSize = 512
+	// DefaultBatchInterval is the default maximum time a record waits in a batching sink before it is sent.
+	DefaultBatchInterval = 5 * time.Second
+	// DefaultSendTimeout is the default timeout of one request sent by a remote sink.
+	DefaultSendTimeout = 10 * time.Second
+
+	// batchQueueFactor sizes the queue of a batchWriter as a multiple of its batch size.
+	batchQueueFactor = 4
+
+	// retryAttempts is the number of attempts made to send one batch.
+	retryAttempts = 5
+	// retryMinBackoff and retryMaxBackoff bound the delay between two attempts.
+	retryMinBackoff = 500 * time.Millisecond
+	retryMaxBackoff = 30 * time.Second
+)
+
+// errQueueFull is reported for records dropped because the queue of a sink is full.
+var errQueueFull = errors.New("queue is full; dropping record")
+
+// batchWriter queues copies of the records written to it and hands them to send in batches from
+// a background goroutine. A batch is sent when it reaches batchSize records or when batchInterval
+// has elapsed since the previous send, whichever comes first. Records written while the queue is
+// full are dropped so that logging never blocks on a slow remote endpoint.
+//
+// When a disk spool is configured, batches that cannot be delivered are spooled instead of
+// dropped. While the spool holds records, new batches are appended to it as well, so that records
+// reach the endpoint in the order they were logged, and the spool is replayed on every tick.
+type batchWriter struct {
+	// name identifies the sink in internal error messages.
+	name string
+
+	// send delivers one batch. It is only called from the batchWriter goroutine.
+	send func(records [][]byte) error
+
+	batchSize     int
+	batchInterval time.Duration
+
+	queue chan []byte
+
+	// spool holds undelivered batches; nil when spooling is disabled.
+	spool *diskSpool
+
+	// written, dropped, and failures count the records delivered, the records dropped, and the
+	// failed sends, for Health.
+	written  atomic.Uint64
+	dropped  atomic.Uint64
+	failures atomic.Uint64
+
+	done      chan struct{}
+	flushDone chan struct{}
+
+	closeOnce sync.Once
+}
+
+// newBatchWriter constructs a batchWriter and starts its goroutine. Non-positive batchSize and
+// batchInterval values fall back to DefaultBatchSize and DefaultBatchInterval.
+func newBatchWriter(name string, batchSize int, batchInterval time.Duration, send func(records [][]byte) error) *batchWriter {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	if batchInterval <= 0 {
+		batchInterval = DefaultBatchInterval
+	}
+
+	batchWriter := &batchWriter{
+		name: name,
+
+		send: send,
+
+		batchSize:     batchSize,
+		batchInterval: batchInterval,
+
+		queue: make(chan []byte, batchSize*batchQueueFactor),
+
+		spool: loadDiskSpool(name),
+
+		done:      make(chan struct{}),
+		flushDone: make(chan struct{}),
+	}
+
+	go batchWriter.run()
+
+	registerSink(batchWriter)
+
+	return batchWriter
+}
+
+// Write implements io.Writer. It queues a copy of p, because zerolog reuses the buffer after Write
+// returns, and always reports len(p) so the zerolog pipeline does not fail.
+func (w *batchWriter) Write(p []byte) (int, error) {
+	record := make([]byte, len(p))
+	copy(record, p)
+
+	select {
+	case <-w.done:
+		return 0, errors.New("tlog " + w.name + ": writer is closed")
+	default:
+	}
+
+	select {
+	case w.queue <- record:
+	default:
+		w.dropped.Add(1)
+
+		reportError(w.name, OpWrite, "", errQueueFull)
+	}
+
+	return len(p), nil
+}
+
+// Close stops the goroutine after sending the records that are still queued.
+func (w *batchWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+
+	<-w.flushDone
+
+	unregisterSink(w)
+
+	return nil
+}
+
+// health returns a snapshot of the state of the sink.
+func (w *batchWriter) health() SinkHealth {
+	return SinkHealth{
+		Name: w.name,
+
+		State: SinkStateClosed,
+
+		Queued: len(w.queue),
+
+		Written:  w.written.Load(),
+		Dropped:  w.dropped.Load(),
+		Failures: w.failures.Load(),
+	}
+}
+
+// run collects queued records into batches and sends them until Close is called.
+func (w *batchWriter) run() {
+	defer close(w.flushDone)
+
+	if w.spool != nil {
+		defer w.spool.close()
+	}
+
+	ticker := time.NewTicker(w.batchInterval)
+	defer ticker.Stop()
+
+	records := make([][]byte, 0, w.batchSize)
+
+	flush := func() {
+		if len(records) == 0 {
+			return
+		}
+
+		w.deliver(records)
+
+		records = make([][]byte, 0, w.batchSize)
+	}
+
+	for {
+		select {
+		case record := <-w.queue:
+			records = append(records, record)
+			if len(records) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			w.replay()
+			flush()
+		case <-w.done:
+			for {
+				select {
+				case record := <-w.queue:
+					records = append(records, record)
+					if len(records) >= w.batchSize {
+						flush()
+					}
+				default:
+					w.replay()
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver sends one batch, or spools it when the spool is not empty or the send fails with an
+// error that may not recur on a later attempt.
+func (w *batchWriter) deliver(records [][]byte) {
+	if w.spool != nil && !w.spool.empty() {
+		w.spoolRecords(records)
+		return
+	}
+
+	err := w.send(records)
+	if err == nil {
+		w.written.Add(uint64(len(records)))
+		return
+	}
+
+	w.failures.Add(1)
+
+	var rejectedErr *rejectedError
+	if errors.As(err, &rejectedErr) {
+		w.written.Add(uint64(len(records) - rejectedErr.rejected))
+		w.dropped.Add(uint64(rejectedErr.rejected))
+
+		reportError(w.name, OpSend, "", err)
+
+		return
+	}
+
+	if w.spool != nil && spoolable(err) {
+		reportError(w.name, OpSend, "", fmt.Errorf("failed to send %d records, spooling them: %w", len(records), err))
+
+		w.spoolRecords(records)
+
+		return
+	}
+
+	w.dropped.Add(uint64(len(records)))
+
+	reportError(w.name, OpSend, "", fmt.Errorf("failed to send %d records: %w", len(records), err))
+}
+
+// spoolRecords appends records to the spool.
+func (w *batchWriter) spoolRecords(records [][]byte) {
+	dropped, err := w.spool.append(records)
+	if err != nil {
+		reportError(w.name, OpSpool, w.spool.dir, fmt.Errorf("cannot spool records: %w", err))
+	}
+
+	if dropped > 0 {
+		w.dropped.Add(uint64(dropped))
+
+		reportError(w.name, OpSpool, w.spool.dir, fmt.Errorf("spool is full; dropped %d records", dropped))
+	}
+}
+
+// replay sends spooled batches in order until the spool is empty or a send fails. A batch that
+// fails with an error that would recur is dropped so that it does not block the spool.
+func (w *batchWriter) replay() {
+	if w.spool == nil {
+		return
+	}
+
+	for !w.spool.empty() {
+		records, position, err := w.spool.peek(w.batchSize)
+		if err != nil {
+			reportError(w.name, OpSpool, w.spool.dir, fmt.Errorf("cannot read spool: %w", err))
+			return
+		}
+
+		if len(records) > 0 {
+			err = w.send(records)
+			if err != nil && spoolable(err) {
+				w.failures.Add(1)
+				return
+			}
+
+			var rejectedErr *rejectedError
+
+			switch {
+			case errors.As(err, &rejectedErr):
+				w.failures.Add(1)
+				w.written.Add(uint64(len(records) - rejectedErr.rejected))
+				w.dropped.Add(uint64(rejectedErr.rejected))
+
+				reportError(w.name, OpSend, "", err)
+			case err != nil:
+				w.failures.Add(1)
+				w.dropped.Add(uint64(len(records)))
+
+				reportError(w.name, OpSend, "", fmt.Errorf("failed to send %d spooled records, dropping them: %w", len(records), err))
+			default:
+				w.written.Add(uint64(len(records)))
+			}
+		}
+
+		err = w.spool.ack(position)
+		if err != nil {
+			reportError(w.name, OpSpool, w.spool.dir, fmt.Errorf("cannot update spool cursor: %w", err))
+			return
+		}
+
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+	}
+}
+
+// statusError reports an HTTP response with an unexpected status code.
+type statusError struct {
+	statusCode int
+
+	// retryAfter is the delay requested by the Retry-After header, or zero.
+	retryAfter time.Duration
+}
+
+// Error implements error.
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected response status %d %s", e.statusCode, http.StatusText(e.statusCode))
+}
+
+// newStatusError returns nil for 2xx responses and a statusError otherwise.
+func newStatusError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	statusErr := &statusError{statusCode: resp.StatusCode}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		statusErr.retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return statusErr
+}
+
+// parseHeaders parses the extra request headers of a remote sink, written as a comma-separated
+// list of key=value pairs as in the OTEL_EXPORTER_OTLP_HEADERS convention. Values are URL-decoded.
+func parseHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		if unescaped, err := url.QueryUnescape(strings.TrimSpace(val)); err == nil {
+			val = unescaped
+		}
+
+		headers[key] = val
+	}
+
+	return headers
+}
+
+// errRejected is wrapped by the errors of sinks whose endpoint rejected records permanently after
+// the sink has already handled them, for example by writing them to a fallback writer.
+var errRejected = errors.New("records were rejected")
+
+// rejectedError reports the records of a batch that the sink has handled itself after they could
+// not be delivered, for example by writing them to a fallback writer. The other records of the
+// batch were delivered. It wraps errRejected, so the batch is neither retried nor spooled.
+type rejectedError struct {
+	// rejected is the number of records that were not delivered.
+	rejected int
+
+	// err is the cause of the last rejection.
+	err error
+}
+
+// Error implements error.
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("%d records were rejected: %v", e.rejected, e.err)
+}
+
+// Unwrap returns errRejected and the cause of the rejection.
+func (e *rejectedError) Unwrap() []error {
+	return []error{errRejected, e.err}
+}
+
+// retryable reports whether a failed send may succeed when repeated. Throttling, server errors,
+// and transport errors are retryable; other HTTP client errors, rejected records, and an open
+// circuit breaker are not.
+func retryable(err error) bool {
+	if errors.Is(err, errCircuitOpen) || errors.Is(err, errRejected) {
+		return false
+	}
+
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode == http.StatusTooManyRequests ||
+			statusErr.statusCode == http.StatusRequestTimeout ||
+			statusErr.statusCode >= 500
+	}
+
+	return true
+}
+
+// spoolable reports whether a batch that failed with err should be spooled for a later replay:
+// the endpoint was unreachable, failed temporarily, or was cut off by its circuit breaker.
+func spoolable(err error) bool {
+	return errors.Is(err, errCircuitOpen) || retryable(err)
+}
+
+// backoffDelay returns the delay before retry attempt (starting at 1): an exponentially growing
+// delay between minDelay and maxDelay, of which the upper half is randomized to spread out
+// retries from many processes.
+func backoffDelay(attempt int, minDelay, maxDelay time.Duration) time.Duration {
+	delay := minDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	half := delay / 2
+
+	return half + rand.N(half+1)
+}
+
+// sendWithRetry calls send until it succeeds, returns a non-retryable error, or retryAttempts
+// attempts have failed. Waiting between attempts is abandoned when done is closed. A
+// Retry-After delay requested by the server takes precedence over the computed backoff.
+func sendWithRetry(done <-chan struct{}, send func() error) error {
+	var err error
+
+	for attempt := 1; attempt <= retryAttempts; attempt++ {
+		err = send()
+		if err == nil || !retryable(err) || attempt == retryAttempts {
+			return err
+		}
+
+		delay := backoffDelay(attempt, retryMinBackoff, retryMaxBackoff)
+
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.retryAfter > 0 {
+			delay = statusErr.retryAfter
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-done:
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,143 @@
+package tlog
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakerThreshold is the default number of consecutive failures that open a circuit breaker.
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is the default time a circuit breaker stays open before it lets a
+	// trial request through.
+	DefaultBreakerCooldown = time.Minute
+)
+
+// errCircuitOpen is returned instead of sending to an endpoint whose circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// breakerState is the state of a circuitBreaker.
+type breakerState int
+
+const (
+	// breakerClosed lets all requests through.
+	breakerClosed breakerState = iota
+	// breakerOpen rejects all requests until the cooldown has elapsed.
+	breakerOpen
+	// breakerHalfOpen lets a single trial request through, whose outcome closes or reopens the breaker.
+	breakerHalfOpen
+)
+
+// String returns the name of the state reported by [SinkHealth].
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return SinkStateOpen
+	case breakerHalfOpen:
+		return SinkStateHalfOpen
+	default:
+		return SinkStateClosed
+	}
+}
+
+// circuitBreaker stops requests to an endpoint after threshold consecutive failures, so that a
+// dead endpoint is not hammered with retries. After cooldown, one trial request is let through: a
+// success closes the breaker, a failure opens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+
+	sync.Mutex
+}
+
+// newCircuitBreaker constructs a closed circuitBreaker. Non-positive threshold and cooldown values
+// fall back to DefaultBreakerThreshold and DefaultBreakerCooldown.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether a request may be sent. An open breaker whose cooldown has elapsed becomes
+// half-open and allows exactly one trial request.
+func (b *circuitBreaker) allow() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+
+		b.state = breakerHalfOpen
+
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// success records a successful request and closes the breaker.
+func (b *circuitBreaker) success() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+// failure records a failed request. It opens the breaker when the trial request of a half-open
+// breaker fails or when the consecutive failures reach the threshold.
+func (b *circuitBreaker) failure() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.failures++
+
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// current returns the state of the breaker.
+func (b *circuitBreaker) current() breakerState {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.state
+}
+
+// call runs send when the breaker allows it and records its outcome. It returns errCircuitOpen
+// without calling send while the breaker is open.
+func (b *circuitBreaker) call(send func() error) error {
+	if !b.allow() {
+		return errCircuitOpen
+	}
+
+	err := send()
+	if err != nil {
+		b.failure()
+	} else {
+		b.success()
+	}
+
+	return err
+}
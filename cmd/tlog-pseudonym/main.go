@@ -0,0 +1,62 @@
+// Command tlog-pseudonym computes the pseudonyms that tlog writes for identifiers, so that the
+// records of a known user can be searched for during an investigation.
+//
+// It reads the keys from [tlog.LogPseudonymKeys] like tlog itself and prints one line per
+// identifier and key, the key id first:
+//
+//	LOG_PSEUDONYM_KEYS="k2026:<base64 key>,k2025:<base64 key>" tlog-pseudonym user-42
+//
+// Every configured key is used unless -key-id selects one, so that the records written before a
+// key rotation are found as well.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/choveylee/tcfg"
+	"github.com/choveylee/tlog"
+)
+
+func main() {
+	keyId := flag.String("key-id", "", "compute pseudonyms under this key id only")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-key-id id] identifier...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	keys, keyIds, err := tlog.ParsePseudonymKeys(tcfg.DefaultString(tcfg.LocalKey(tlog.LogPseudonymKeys), ""))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tlog-pseudonym: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *keyId != "" {
+		if _, ok := keys[*keyId]; !ok {
+			fmt.Fprintf(os.Stderr, "tlog-pseudonym: pseudonym key %q is not configured\n", *keyId)
+			os.Exit(1)
+		}
+
+		keyIds = []string{*keyId}
+	}
+
+	if len(keyIds) == 0 {
+		fmt.Fprintf(os.Stderr, "tlog-pseudonym: no pseudonym key is configured in %s\n", tlog.LogPseudonymKeys)
+		os.Exit(1)
+	}
+
+	for _, value := range flag.Args() {
+		for _, id := range keyIds {
+			fmt.Printf("%s\t%s\t%s\n", id, value, tlog.Pseudonym(id, keys[id], value))
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package tlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mattn/go-isatty"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// ConsoleTimeFormat is the fixed-width timestamp layout used by the console format so that
+	// consecutive lines stay aligned.
+	ConsoleTimeFormat = "2006-01-02 15:04:05.000"
+
+	// consoleTraceIdLen is the number of leading trace identifier characters shown by the console format.
+	consoleTraceIdLen = 8
+
+	// consoleIndent prefixes the detail and error lines rendered below a console record.
+	consoleIndent = "    "
+)
+
+// consoleRawKeys lists the keys the console format writes without quoting, whose control
+// characters are escaped by formatConsolePrepare.
+var consoleRawKeys = []string{
+	zerolog.MessageFieldName,
+	zerolog.CallerFieldName,
+	CtxTraceId,
+	fieldDetail,
+	fieldError,
+}
+
+// newConsoleWriter returns a zerolog.ConsoleWriter that renders JSON records from tlog in a
+// human-readable layout. Colors are enabled only when out is a terminal. Control characters in
+// values are escaped or stripped according to the policy of fields.
+func newConsoleWriter(out io.Writer, fields *fieldConfig) zerolog.ConsoleWriter {
+	control := fields.controlMode()
+
+	return zerolog.ConsoleWriter{
+		Out:        out,
+		NoColor:    !isTerminal(out),
+		TimeFormat: ConsoleTimeFormat,
+
+		PartsOrder: []string{
+			zerolog.TimestampFieldName,
+			zerolog.LevelFieldName,
+			CtxTraceId,
+			zerolog.CallerFieldName,
+			zerolog.MessageFieldName,
+		},
+
+		FieldsExclude: []string{CtxTraceId, CtxSpanId, CtxTraceSampled, fieldDetail, fieldError},
+
+		FormatTimestamp:       formatConsoleTime,
+		FormatPartValueByName: formatConsolePart,
+		FormatExtra:           formatConsoleExtra,
+
+		FormatPrepare: func(evt map[string]any) error {
+			formatConsolePrepare(control, evt)
+			return nil
+		},
+	}
+}
+
+// formatConsolePrepare applies the control character policy to a decoded record before it is
+// rendered. ControlStrip strips every string value. Otherwise only the values the console format
+// writes unquoted are escaped, since zerolog quotes the other values and escapes their control
+// characters itself. Keys are always sanitized, because zerolog writes them unquoted.
+func formatConsolePrepare(control string, evt map[string]any) {
+	for key, value := range evt {
+		if sanitized := sanitizeControl(control, key); sanitized != key {
+			delete(evt, key)
+			evt[sanitized] = value
+		}
+	}
+
+	if control == ControlStrip {
+		for key, value := range evt {
+			if str, ok := value.(string); ok {
+				evt[key] = sanitizeControl(control, str)
+			}
+		}
+
+		return
+	}
+
+	for _, key := range consoleRawKeys {
+		if str, ok := evt[key].(string); ok {
+			evt[key] = sanitizeControl(control, str)
+		}
+	}
+}
+
+// formatConsoleTime renders the record time in local time with ConsoleTimeFormat, whichever
+// timestamp layout the record was written with.
+func formatConsoleTime(value any) string {
+	recordTime, ok := parseRecordTime(value)
+	if !ok {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return recordTime.Local().Format(ConsoleTimeFormat)
+}
+
+// formatConsolePart renders custom console parts. The trace identifier is shortened to
+// consoleTraceIdLen characters and wrapped in brackets; missing parts render as empty strings.
+func formatConsolePart(value any, name string) string {
+	if value == nil {
+		return ""
+	}
+
+	str := fmt.Sprintf("%v", value)
+
+	if name == CtxTraceId {
+		if len(str) > consoleTraceIdLen {
+			str = str[:consoleTraceIdLen]
+		}
+
+		return "[" + str + "]"
+	}
+
+	return str
+}
+
+// formatConsoleExtra renders the detail and error fields on separate indented lines below the record.
+func formatConsoleExtra(evt map[string]any, buf *bytes.Buffer) error {
+	for _, key := range []string{fieldDetail, fieldError} {
+		value, ok := evt[key]
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintf(buf, "\n%s%s: %v", consoleIndent, key, value)
+	}
+
+	return nil
+}
+
+// isTerminal reports whether out is a terminal, including Cygwin and MSYS pseudo terminals.
+func isTerminal(out io.Writer) bool {
+	if writer, ok := out.(noCloseWriter); ok {
+		out = writer.Writer
+	}
+
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+
+	return isatty.IsTerminal(file.Fd()) || isatty.IsCygwinTerminal(file.Fd())
+}
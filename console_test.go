@@ -0,0 +1,107 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const consoleTestRecord = `{"level":"error","app_name":"billing","time":"2026-01-02T03:04:05.25Z",` +
+	`"caller":"billing/charge.go:42","message":"card declined","trace_id":"0af7651916cd43dd8448eb211c80319c",` +
+	`"span_id":"b7ad6b7169203331","trace_sampled":true,"order_id":"A-17","detail":"line one\nline two","error":"declined"}` + "\n"
+
+func TestConsoleFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	consoleWriter := newFormatWriter(LogFormatConsole, &buf, &fieldConfig{})
+
+	_, err := consoleWriter.Write([]byte(consoleTestRecord))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	recordTime := time.Date(2026, 1, 2, 3, 4, 5, 250000000, time.UTC).Local().Format(ConsoleTimeFormat)
+
+	want := recordTime + " ERR [0af76519] billing/charge.go:42 > card declined app_name=billing order_id=A-17\n" +
+		consoleIndent + `detail: line one\nline two` + "\n" +
+		consoleIndent + "error: declined\n"
+
+	if got := buf.String(); got != want {
+		t.Errorf("console output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConsoleTimeFormat(t *testing.T) {
+	want := time.Date(2026, 1, 2, 3, 4, 5, 250000000, time.UTC).Local().Format(ConsoleTimeFormat)
+
+	for _, value := range []any{
+		"2026-01-02T03:04:05.25Z",
+		"2026-01-02T04:04:05.250000000+01:00",
+		json.Number("1767323045250"),
+		json.Number("1767323045250000"),
+	} {
+		if got := formatConsoleTime(value); got != want {
+			t.Errorf("formatConsoleTime(%v) = %q, want %q", value, got, want)
+		}
+	}
+
+	if got := formatConsoleTime("yesterday"); got != "yesterday" {
+		t.Errorf("formatConsoleTime(yesterday) = %q, want the value unchanged", got)
+	}
+}
+
+func TestConsoleTraceId(t *testing.T) {
+	for _, test := range []struct {
+		value any
+		want  string
+	}{
+		{"0af7651916cd43dd8448eb211c80319c", "[0af76519]"},
+		{"0af765", "[0af765]"},
+		{nil, ""},
+	} {
+		if got := formatConsolePart(test.value, CtxTraceId); got != test.want {
+			t.Errorf("formatConsolePart(%v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+
+	if got := formatConsolePart("billing/charge.go:42", "caller"); got != "billing/charge.go:42" {
+		t.Errorf("caller part = %q, want it unchanged", got)
+	}
+}
+
+func TestConsoleColorsOnlyOnTerminals(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "console.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	for name, out := range map[string]io.Writer{
+		"buffer":         &bytes.Buffer{},
+		"file":           file,
+		"wrapped file":   noCloseWriter{Writer: file},
+		"wrapped buffer": noCloseWriter{Writer: &bytes.Buffer{}},
+	} {
+		consoleWriter := newConsoleWriter(out, &fieldConfig{})
+		if !consoleWriter.NoColor {
+			t.Errorf("%s: colors are enabled, want them disabled for a non-terminal", name)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	consoleWriter := newConsoleWriter(&buf, &fieldConfig{})
+	consoleWriter.NoColor = false
+
+	_, _ = consoleWriter.Write([]byte(consoleTestRecord))
+
+	if !strings.Contains(buf.String(), "\x1b[") {
+		t.Errorf("console output %q has no color escapes with colors enabled", buf.String())
+	}
+}
@@ -9,12 +9,51 @@ const (
 	// LogLevel is the configuration key for the minimum enabled log level.
 	LogLevel = "LOG_LEVEL"
 
+	// LogFormat is the configuration key for the standard output format. Supported values are
+	// [LogFormatJson], [LogFormatConsole], [LogFormatLogfmt], [LogFormatEcs], and [LogFormatGcp]; the default is JSON.
+	LogFormat = "LOG_FORMAT"
+
+	// LogTimeFormat is the configuration key for the timestamp layout. Supported values are the
+	// TimeFormat constants; the default is [TimeFormatRFC3339].
+	LogTimeFormat = "LOG_TIME_FORMAT"
+	// LogTimeUtc is the configuration key that writes timestamps in UTC instead of local time.
+	LogTimeUtc = "LOG_TIME_UTC"
+
+	// LogFieldTime is the configuration key for the output name of the time field.
+	LogFieldTime = "LOG_FIELD_TIME"
+	// LogFieldLevel is the configuration key for the output name of the level field.
+	LogFieldLevel = "LOG_FIELD_LEVEL"
+	// LogFieldMessage is the configuration key for the output name of the message field.
+	LogFieldMessage = "LOG_FIELD_MESSAGE"
+	// LogFieldAppName is the configuration key for the output name of the app_name field.
+	LogFieldAppName = "LOG_FIELD_APP_NAME"
+	// LogFieldTraceId is the configuration key for the output name of the [CtxTraceId] field.
+	LogFieldTraceId = "LOG_FIELD_TRACE_ID"
+	// LogFieldSpanId is the configuration key for the output name of the [CtxSpanId] field.
+	LogFieldSpanId = "LOG_FIELD_SPAN_ID"
+	// LogFieldTraceSampled is the configuration key for the output name of the [CtxTraceSampled] field.
+	LogFieldTraceSampled = "LOG_FIELD_TRACE_SAMPLED"
+	// LogFieldDetail is the configuration key for the output name of the detail field.
+	LogFieldDetail = "LOG_FIELD_DETAIL"
+	// LogFieldCaller is the configuration key for the output name of the caller field.
+	LogFieldCaller = "LOG_FIELD_CALLER"
+	// LogFieldError is the configuration key for the output name of the error field.
+	LogFieldError = "LOG_FIELD_ERROR"
+
+	// LogStderrLevel is the configuration key for the lowest level written to standard error
+	// instead of standard output, for example ERROR. An empty value writes all levels to standard
+	// output. It does not apply when [LogOutputs] is set.
+	LogStderrLevel = "LOG_STDERR_LEVEL"
+
 	// LogFileEnable is the configuration key that enables output to a rotating log file
 	// in addition to standard output.
 	LogFileEnable = "LOG_FILE_ENABLE"
 
 	// LogFilePath is the configuration key for the active log file path.
 	LogFilePath = "LOG_FILE_PATH"
+	// LogFileFormat is the configuration key for the log file format. It accepts the same values as
+	// [LogFormat] and defaults to JSON independently of the standard output format.
+	LogFileFormat = "LOG_FILE_FORMAT"
 	// LogFileSize is the configuration key for the maximum active log file size,
 	// in megabytes, before size-based rotation occurs.
 	LogFileSize = "LOG_FILE_SIZE"
@@ -31,6 +70,268 @@ const (
 	// LogFileCompress is the configuration key that enables asynchronous gzip compression
 	// of rotated log files.
 	LogFileCompress = "LOG_FILE_COMPRESS"
+	// LogFileFallback is the configuration key for the destination of records while the log file
+	// cannot be written, for example because the disk is full: [FileFallbackStderr] (the default),
+	// [FileFallbackNone], or a directory that receives a log file of the same name. The log file is
+	// reopened with exponential backoff, and the switch and the recovery are reported once.
+	LogFileFallback = "LOG_FILE_FALLBACK"
+
+	// LogOutputs is the configuration key for the outputs of the routed pipeline, written as a JSON
+	// array of [OutputConfig] objects or as comma-separated URL specs such as
+	// file:///var/log/app.log?size=200&min_level=ERROR,stderr://?format=CONSOLE, whose schemes are
+	// resolved through [RegisterSink]. When set, the outputs replace standard output and the log
+	// file configured with the LOG_FILE_* keys; the other sinks are not affected.
+	LogOutputs = "LOG_OUTPUTS"
+	// LogOutputsFile is the configuration key for the path of a JSON file holding the outputs of
+	// the routed pipeline, used when [LogOutputs] is not set.
+	LogOutputsFile = "LOG_OUTPUTS_FILE"
+
+	// LogGcpProject is the configuration key for the Google Cloud project identifier used by
+	// [LogFormatGcp] to write trace identifiers as projects/PROJECT/traces/TRACE_ID. Cloud Logging
+	// only links records to their traces in this form, so a missing project is reported as an
+	// internal error.
+	LogGcpProject = "LOG_GCP_PROJECT"
+
+	// LogSpanEvent is the configuration key that records WARN and higher events as span events on
+	// the active span of the event context. ERROR and higher events also set the span status to error.
+	LogSpanEvent = "LOG_SPAN_EVENT"
+
+	// LogSyslogEnable is the configuration key that enables output to syslog.
+	LogSyslogEnable = "LOG_SYSLOG_ENABLE"
+	// LogSyslogNetwork is the configuration key for the syslog transport: udp, tcp, tls, unix, or
+	// unixgram. An empty value selects the local syslog socket.
+	LogSyslogNetwork = "LOG_SYSLOG_NETWORK"
+	// LogSyslogAddress is the configuration key for the syslog server address, such as
+	// 127.0.0.1:514, or the socket path for unix transports.
+	LogSyslogAddress = "LOG_SYSLOG_ADDRESS"
+	// LogSyslogFacility is the configuration key for the syslog facility, written as a name such
+	// as USER or LOCAL0, or as a numeric code. The default is USER.
+	LogSyslogFacility = "LOG_SYSLOG_FACILITY"
+	// LogSyslogFormat is the configuration key for the syslog message format:
+	// [SyslogFormatRFC5424] (the default) or [SyslogFormatRFC3164].
+	LogSyslogFormat = "LOG_SYSLOG_FORMAT"
+	// LogSyslogTlsCa is the configuration key for a PEM file of additional CA certificates used to
+	// verify the syslog server when the transport is tls.
+	LogSyslogTlsCa = "LOG_SYSLOG_TLS_CA"
+
+	// LogJournaldEnable is the configuration key that enables output to systemd-journald through
+	// its native protocol.
+	LogJournaldEnable = "LOG_JOURNALD_ENABLE"
+	// LogJournaldSocket is the configuration key for the journald socket path. The default is
+	// [DefaultJournaldSocket].
+	LogJournaldSocket = "LOG_JOURNALD_SOCKET"
+
+	// LogFluentAddress is the configuration key for the address of a Fluentd or Fluent Bit forward
+	// input, written as tcp://host:port, unix:///path, or host:port. An empty value disables the
+	// output.
+	LogFluentAddress = "LOG_FLUENT_ADDRESS"
+	// LogFluentAck is the configuration key that enables acknowledgements of every message for
+	// at-least-once delivery.
+	LogFluentAck = "LOG_FLUENT_ACK"
+	// LogFluentSharedKey is the configuration key for the shared key of the forward input. A
+	// non-empty value enables the authentication handshake.
+	LogFluentSharedKey = "LOG_FLUENT_SHARED_KEY"
+	// LogFluentUsername and LogFluentPassword are the configuration keys for user authentication
+	// during the handshake.
+	LogFluentUsername = "LOG_FLUENT_USERNAME"
+	LogFluentPassword = "LOG_FLUENT_PASSWORD"
+	// LogFluentTimeout is the configuration key for the timeout of sending one message and
+	// receiving its acknowledgement, written as a Go duration such as 10s.
+	LogFluentTimeout = "LOG_FLUENT_TIMEOUT"
+	// LogFluentBatchSize is the configuration key for the maximum number of records in one batch.
+	LogFluentBatchSize = "LOG_FLUENT_BATCH_SIZE"
+	// LogFluentBatchInterval is the configuration key for the maximum time a record waits before
+	// it is sent, written as a Go duration such as 5s.
+	LogFluentBatchInterval = "LOG_FLUENT_BATCH_INTERVAL"
+
+	// LogOtlpEndpoint is the configuration key for the URL of an OpenTelemetry collector that
+	// receives records over OTLP/HTTP, for example http://localhost:4318. An empty value disables
+	// the export; an endpoint without a path receives requests at /v1/logs.
+	LogOtlpEndpoint = "LOG_OTLP_ENDPOINT"
+	// LogOtlpHeaders is the configuration key for additional OTLP request headers, written as a
+	// comma-separated list of key=value pairs.
+	LogOtlpHeaders = "LOG_OTLP_HEADERS"
+	// LogOtlpTimeout is the configuration key for the timeout of one OTLP export request, written
+	// as a Go duration such as 10s.
+	LogOtlpTimeout = "LOG_OTLP_TIMEOUT"
+	// LogOtlpBatchSize is the configuration key for the maximum number of records in one OTLP
+	// export request.
+	LogOtlpBatchSize = "LOG_OTLP_BATCH_SIZE"
+	// LogOtlpBatchInterval is the configuration key for the maximum time a record waits before it
+	// is exported, written as a Go duration such as 5s.
+	LogOtlpBatchInterval = "LOG_OTLP_BATCH_INTERVAL"
+
+	// LogLokiEndpoint is the configuration key for the URL of a Grafana Loki server, for example
+	// http://localhost:3100. An empty value disables the output; an endpoint without a path
+	// receives requests at /loki/api/v1/push.
+	LogLokiEndpoint = "LOG_LOKI_ENDPOINT"
+	// LogLokiLabels is the configuration key for the comma-separated record keys used as stream
+	// labels. The default is [DefaultLokiLabels]; app_name is a label in any case.
+	LogLokiLabels = "LOG_LOKI_LABELS"
+	// LogLokiEncoding is the configuration key for the push request encoding:
+	// [LokiEncodingProtobuf] (the default) or [LokiEncodingJson].
+	LogLokiEncoding = "LOG_LOKI_ENCODING"
+	// LogLokiTenant is the configuration key for the tenant sent in the X-Scope-OrgID header.
+	LogLokiTenant = "LOG_LOKI_TENANT"
+	// LogLokiTimeout is the configuration key for the timeout of one push request, written as a
+	// Go duration such as 10s.
+	LogLokiTimeout = "LOG_LOKI_TIMEOUT"
+	// LogLokiBatchSize is the configuration key for the maximum number of records in one push request.
+	LogLokiBatchSize = "LOG_LOKI_BATCH_SIZE"
+	// LogLokiBatchAge is the configuration key for the maximum time a record waits before it is
+	// pushed, written as a Go duration such as 5s.
+	LogLokiBatchAge = "LOG_LOKI_BATCH_AGE"
+
+	// LogEsEndpoint is the configuration key for the URL of an Elasticsearch or OpenSearch cluster,
+	// for example http://localhost:9200. An empty value disables the output; requests are sent to
+	// the _bulk API below the endpoint path.
+	LogEsEndpoint = "LOG_ES_ENDPOINT"
+	// LogEsIndex is the configuration key for the index name prefix. Records are indexed in daily
+	// indices named <prefix>-<yyyy.MM.dd>; the default prefix is the lowercased application name.
+	LogEsIndex = "LOG_ES_INDEX"
+	// LogEsFormat is the configuration key for the document format: [LogFormatJson] (the
+	// default), [LogFormatEcs], or [LogFormatGcp].
+	LogEsFormat = "LOG_ES_FORMAT"
+	// LogEsUsername and LogEsPassword are the configuration keys for basic authentication.
+	LogEsUsername = "LOG_ES_USERNAME"
+	LogEsPassword = "LOG_ES_PASSWORD"
+	// LogEsApiKey is the configuration key for an encoded API key, which takes precedence over
+	// basic authentication.
+	LogEsApiKey = "LOG_ES_API_KEY"
+	// LogEsFallback is the configuration key for the destination of records that could not be
+	// indexed: stderr (the default), stdout, discard, or the path of a file.
+	LogEsFallback = "LOG_ES_FALLBACK"
+	// LogEsTimeout is the configuration key for the timeout of one bulk request, written as a Go
+	// duration such as 10s.
+	LogEsTimeout = "LOG_ES_TIMEOUT"
+	// LogEsFlushSize is the configuration key for the maximum number of records in one bulk request.
+	LogEsFlushSize = "LOG_ES_FLUSH_SIZE"
+	// LogEsFlushInterval is the configuration key for the maximum time a record waits before it is
+	// indexed, written as a Go duration such as 5s.
+	LogEsFlushInterval = "LOG_ES_FLUSH_INTERVAL"
+
+	// LogErrorInterval is the configuration key for the interval within which repeated internal
+	// errors of one sink and operation are passed to the [ErrorHandler] only once, written as a
+	// Go duration such as 10s. The default is [DefaultErrorInterval].
+	LogErrorInterval = "LOG_ERROR_INTERVAL"
+
+	// LogSinkIsolation is the configuration key that decouples the synchronous sinks (standard
+	// output, the log file, routed outputs, syslog, journald, and GELF) from the logging goroutine
+	// and from each other. Each sink then has its own queue, worker goroutine, write timeout, and
+	// circuit breaker, and its state is reported by [Health].
+	LogSinkIsolation = "LOG_SINK_ISOLATION"
+	// LogSinkQueueSize is the configuration key for the number of records queued for one isolated
+	// sink. The default is [DefaultSinkQueueSize].
+	LogSinkQueueSize = "LOG_SINK_QUEUE_SIZE"
+	// LogSinkTimeout is the configuration key for the time one write to an isolated sink may take,
+	// written as a Go duration such as 5s.
+	LogSinkTimeout = "LOG_SINK_TIMEOUT"
+	// LogSinkBreakerThreshold is the configuration key for the number of consecutive failed writes
+	// after which an isolated sink is disabled for the cooldown period.
+	LogSinkBreakerThreshold = "LOG_SINK_BREAKER_THRESHOLD"
+	// LogSinkBreakerCooldown is the configuration key for the time an isolated sink stays disabled
+	// after repeated failures, written as a Go duration such as 1m.
+	LogSinkBreakerCooldown = "LOG_SINK_BREAKER_COOLDOWN"
+
+	// LogSpoolDir is the configuration key for the directory of the disk spool of the batching
+	// remote sinks. Each sink spools the batches it fails to deliver in its own subdirectory and
+	// replays them in order once the endpoint has recovered. An empty value disables spooling.
+	LogSpoolDir = "LOG_SPOOL_DIR"
+	// LogSpoolMaxSize is the configuration key for the maximum size of the spool of one sink, in
+	// megabytes.
+	LogSpoolMaxSize = "LOG_SPOOL_MAX_SIZE"
+	// LogSpoolSegmentSize is the configuration key for the maximum size of one spool segment
+	// file, in megabytes.
+	LogSpoolSegmentSize = "LOG_SPOOL_SEGMENT_SIZE"
+	// LogSpoolDropPolicy is the configuration key for the handling of records that do not fit into
+	// a full spool: [SpoolDropNewest] (the default) or [SpoolDropOldest].
+	LogSpoolDropPolicy = "LOG_SPOOL_DROP_POLICY"
+
+	// LogGelfAddress is the configuration key for the host:port of a Graylog GELF input. An empty
+	// value disables the output.
+	LogGelfAddress = "LOG_GELF_ADDRESS"
+	// LogGelfNetwork is the configuration key for the GELF transport: udp (the default) or tcp.
+	LogGelfNetwork = "LOG_GELF_NETWORK"
+	// LogGelfCompression is the configuration key for the compression of GELF UDP messages:
+	// [GelfCompressionGzip] (the default), [GelfCompressionZlib], or [GelfCompressionNone].
+	LogGelfCompression = "LOG_GELF_COMPRESSION"
+	// LogGelfChunkSize is the configuration key for the maximum size of one GELF UDP datagram.
+	// The default is [DefaultGelfChunkSize].
+	LogGelfChunkSize = "LOG_GELF_CHUNK_SIZE"
+
+	// LogWebhookUrl is the configuration key for the URL that receives webhook requests. An empty
+	// value disables the webhook.
+	LogWebhookUrl = "LOG_WEBHOOK_URL"
+	// LogWebhookLevel is the configuration key for the lowest level sent to the webhook. The
+	// default is [LogLevelError].
+	LogWebhookLevel = "LOG_WEBHOOK_LEVEL"
+	// LogWebhookTemplate is the configuration key for the text/template that renders the request
+	// body from [WebhookData]. The default is [DefaultWebhookTemplate].
+	LogWebhookTemplate = "LOG_WEBHOOK_TEMPLATE"
+	// LogWebhookHeaders is the configuration key for additional request headers, written as a
+	// comma-separated list of key=value pairs.
+	LogWebhookHeaders = "LOG_WEBHOOK_HEADERS"
+	// LogWebhookTimeout is the configuration key for the timeout of one webhook request, written
+	// as a Go duration such as 10s.
+	LogWebhookTimeout = "LOG_WEBHOOK_TIMEOUT"
+	// LogWebhookBatchSize is the configuration key for the maximum number of records in one request.
+	LogWebhookBatchSize = "LOG_WEBHOOK_BATCH_SIZE"
+	// LogWebhookBatchInterval is the configuration key for the maximum time a record waits before
+	// it is sent, written as a Go duration such as 5s.
+	LogWebhookBatchInterval = "LOG_WEBHOOK_BATCH_INTERVAL"
+	// LogWebhookBreakerThreshold is the configuration key for the number of consecutive failed
+	// requests after which the webhook stops sending for the cooldown period.
+	LogWebhookBreakerThreshold = "LOG_WEBHOOK_BREAKER_THRESHOLD"
+	// LogWebhookBreakerCooldown is the configuration key for the time the webhook stops sending
+	// after repeated failures, written as a Go duration such as 1m.
+	LogWebhookBreakerCooldown = "LOG_WEBHOOK_BREAKER_COOLDOWN"
+
+	// LogRedactEnable is the configuration key that enables the redaction of sensitive values in
+	// the detail, error, and typed fields of events and in the messages sent to Sentry.
+	LogRedactEnable = "LOG_REDACT_ENABLE"
+	// LogRedactMode is the configuration key for the masking of values matched by redaction
+	// patterns: [RedactModeFull] (the default), [RedactModePartial], or [RedactModePseudonymize].
+	// Values of sensitive fields are always redacted in full.
+	LogRedactMode = "LOG_REDACT_MODE"
+	// LogRedactFields is the configuration key for the comma-separated, case-insensitive names of
+	// the fields whose values are redacted, in typed fields as well as in key=value pairs of free
+	// text. The default is [DefaultRedactFields].
+	LogRedactFields = "LOG_REDACT_FIELDS"
+	// LogRedactPatterns is the configuration key for the comma-separated built-in redaction
+	// patterns: [RedactPatternBearer], [RedactPatternJwt], [RedactPatternEmail], and
+	// [RedactPatternPan]. The default is [DefaultRedactPatterns].
+	LogRedactPatterns = "LOG_REDACT_PATTERNS"
+	// LogRedactRules is the configuration key for custom redaction rules, written as a JSON array
+	// of [RedactRule] objects.
+	LogRedactRules = "LOG_REDACT_RULES"
+
+	// LogPseudonymKeys is the configuration key for the keys of pseudonyms, written as a
+	// comma-separated list of <key id>:<base64 key> pairs. Keys are rotated by adding a key with a
+	// new id and making it active; older keys stay listed so that their pseudonyms can still be
+	// computed with [Pseudonym].
+	LogPseudonymKeys = "LOG_PSEUDONYM_KEYS"
+	// LogPseudonymKeyId is the configuration key for the id of the key used for new pseudonyms.
+	// The default is the first key of [LogPseudonymKeys].
+	LogPseudonymKeyId = "LOG_PSEUDONYM_KEY_ID"
+	// LogPseudonymFields is the configuration key for the comma-separated, case-insensitive names
+	// of the fields whose values are replaced with pseudonyms, for example user_id.
+	LogPseudonymFields = "LOG_PSEUDONYM_FIELDS"
+
+	// LogFieldMaxBytes is the configuration key for the byte budget of one value of an event: the
+	// message, the joined detail, the error, or a field value. Longer values are cut at a UTF-8
+	// boundary, followed by an ellipsis, and their keys are listed in the truncated field. An
+	// object or array over the budget is written empty, keeping its type, and its cut JSON
+	// encoding is written as a string under its key with the suffix _truncated. The default is
+	// [DefaultFieldMaxBytes]; zero or a negative value disables the budget.
+	LogFieldMaxBytes = "LOG_FIELD_MAX_BYTES"
+	// LogEventMaxBytes is the configuration key for the combined byte budget of the values of one
+	// event. Values are charged in the order they are added, with the message and the detail last,
+	// and are cut once the budget is spent. The default of zero disables the budget.
+	LogEventMaxBytes = "LOG_EVENT_MAX_BYTES"
+	// LogControlChars is the configuration key for the handling of control characters, such as
+	// CR, LF, and the ESC of ANSI escape sequences, in console and logfmt output: [ControlEscape]
+	// (the default) or [ControlStrip]. JSON-based formats always escape them.
+	LogControlChars = "LOG_CONTROL_CHARS"
 
 	// SentryDsn is the configuration key for the Sentry project DSN. An empty value
 	// disables Sentry reporting.
@@ -46,3 +347,38 @@ const (
 	LogLevelFatal = "FATAL"
 	LogLevelPanic = "PANIC"
 )
+
+// Output format names accepted by [LogFormat] and [LogFileFormat].
+const (
+	// LogFormatJson writes one JSON object per line.
+	LogFormatJson = "JSON"
+	// LogFormatConsole writes a human-readable line with aligned timestamps, colorized levels when
+	// the destination is a terminal, and detail and error fields on indented lines.
+	LogFormatConsole = "CONSOLE"
+	// LogFormatLogfmt writes one logfmt line of space-separated key=value pairs per record, with the
+	// time, level, app_name, trace_id, and message keys first.
+	LogFormatLogfmt = "LOGFMT"
+	// LogFormatEcs writes one Elastic Common Schema JSON document per line, with @timestamp,
+	// log.level, service.name, trace.id, span.id, error.*, and log.origin.file.* fields.
+	LogFormatEcs = "ECS"
+	// LogFormatGcp writes one JSON object per line following the Google Cloud Logging structured
+	// logging conventions: severity, logging.googleapis.com/trace, spanId, trace_sampled, and
+	// sourceLocation.
+	LogFormatGcp = "GCP"
+)
+
+// Timestamp layouts accepted by [LogTimeFormat].
+const (
+	// TimeFormatRFC3339 writes RFC 3339 timestamps with second precision.
+	TimeFormatRFC3339 = "RFC3339"
+	// TimeFormatRFC3339Nano writes RFC 3339 timestamps with nanosecond precision.
+	TimeFormatRFC3339Nano = "RFC3339NANO"
+	// TimeFormatUnix writes the number of seconds since the Unix epoch.
+	TimeFormatUnix = "UNIX"
+	// TimeFormatUnixMs writes the number of milliseconds since the Unix epoch.
+	TimeFormatUnixMs = "UNIXMS"
+	// TimeFormatUnixMicro writes the number of microseconds since the Unix epoch.
+	TimeFormatUnixMicro = "UNIXMICRO"
+	// TimeFormatUnixNano writes the number of nanoseconds since the Unix epoch.
+	TimeFormatUnixNano = "UNIXNANO"
+)
@@ -0,0 +1,250 @@
+package tlog
+
+import (
+	"errors"
+	stdlog "log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultErrorInterval is the default interval within which repeated internal errors of one
+	// sink and operation are reported only once.
+	DefaultErrorInterval = 10 * time.Second
+
+	// diagnosticsBuffer is the capacity of the channel returned by Diagnostics.
+	diagnosticsBuffer = 256
+)
+
+// Operations reported in [InternalError].
+const (
+	// OpInit reports a sink that could not be set up.
+	OpInit = "init"
+	// OpWrite reports a record that could not be written or queued.
+	OpWrite = "write"
+	// OpSend reports a batch that could not be delivered to a remote endpoint.
+	OpSend = "send"
+	// OpSpool reports a failure to write or read the disk spool.
+	OpSpool = "spool"
+	// OpList reports a failure to enumerate rotated log files.
+	OpList = "list"
+	// OpRemove reports a rotated log file that could not be removed.
+	OpRemove = "remove"
+	// OpCompress reports a rotated log file that could not be compressed.
+	OpCompress = "compress"
+	// OpFallback reports a sink that writes its records to its fallback writer.
+	OpFallback = "fallback"
+	// OpDisable reports a sink disabled by its circuit breaker after repeated failures.
+	OpDisable = "disable"
+	// OpRecover reports a disabled sink that receives records again.
+	OpRecover = "recover"
+)
+
+// errSinkRecovered is the error of the InternalError reported with OpRecover.
+var errSinkRecovered = errors.New("sink has recovered")
+
+// InternalError describes a failure inside tlog, such as a record that could not be delivered
+// to a sink. Internal errors are passed to the [ErrorHandler] set with [SetErrorHandler] and to
+// the channel returned by [Diagnostics].
+type InternalError struct {
+	// Sink names the sink or component that failed, for example file, otlp, or sentry.
+	Sink string
+
+	// Op is the operation that failed, for example [OpWrite] or [OpSend].
+	Op string
+
+	// Path is the file or directory involved in the failure; empty when there is none.
+	Path string
+
+	// Err is the underlying error.
+	Err error
+
+	// Time is the time the failure occurred.
+	Time time.Time
+
+	// Suppressed counts the errors of the same sink and operation that were not reported since
+	// the previous report because of rate limiting.
+	Suppressed int
+}
+
+// Error implements error.
+func (e *InternalError) Error() string {
+	var b strings.Builder
+
+	b.WriteString("tlog ")
+	b.WriteString(e.Sink)
+	b.WriteString(": ")
+	b.WriteString(e.Op)
+
+	if e.Path != "" {
+		b.WriteString(" ")
+		b.WriteString(e.Path)
+	}
+
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *InternalError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler handles internal errors of tlog. It is called synchronously from the goroutine
+// that encountered the error, which may be a logging goroutine, so it must not block or log
+// through tlog itself.
+type ErrorHandler func(err *InternalError)
+
+// defaultErrorHandler writes internal errors to the standard library logger.
+func defaultErrorHandler(err *InternalError) {
+	if err.Suppressed > 0 {
+		stdlog.Printf("%v (%d similar errors suppressed)", err, err.Suppressed)
+		return
+	}
+
+	stdlog.Print(err)
+}
+
+// diagnosticsKey identifies the errors that are rate limited together.
+type diagnosticsKey struct {
+	sink string
+	op   string
+}
+
+// diagnosticsLimit tracks the rate limiting of one diagnosticsKey.
+type diagnosticsLimit struct {
+	reportedAt time.Time
+	suppressed int
+}
+
+// diagnostics holds the internal error handler, the rate limiting state, and the last error of
+// each sink.
+var diagnostics = struct {
+	handler  ErrorHandler
+	interval time.Duration
+
+	channel chan *InternalError
+
+	limits     map[diagnosticsKey]*diagnosticsLimit
+	lastErrors map[string]*InternalError
+
+	// sinkNames lists the keys of lastErrors in the order they were first reported.
+	sinkNames []string
+
+	sync.Mutex
+}{
+	handler:  defaultErrorHandler,
+	interval: DefaultErrorInterval,
+
+	channel: make(chan *InternalError, diagnosticsBuffer),
+
+	limits:     make(map[diagnosticsKey]*diagnosticsLimit),
+	lastErrors: make(map[string]*InternalError),
+}
+
+// SetErrorHandler sets the handler of internal errors. A nil handler restores the default, which
+// writes them to the standard library logger.
+func SetErrorHandler(handler ErrorHandler) {
+	if handler == nil {
+		handler = defaultErrorHandler
+	}
+
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+
+	diagnostics.handler = handler
+}
+
+// Diagnostics returns a channel that receives the internal errors passed to the error handler.
+// Errors are dropped while the channel is full, so a consumer is optional.
+func Diagnostics() <-chan *InternalError {
+	return diagnostics.channel
+}
+
+// setErrorInterval sets the interval within which repeated errors of one sink and operation are
+// reported only once. Non-positive values fall back to DefaultErrorInterval.
+func setErrorInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultErrorInterval
+	}
+
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+
+	diagnostics.interval = interval
+}
+
+// reportError records err as the last error of sink and reports it to the error handler and the
+// diagnostics channel, unless an error of the same sink and operation has been reported within
+// the rate limiting interval.
+func reportError(sink, op, path string, err error) {
+	internalErr := &InternalError{
+		Sink: sink,
+		Op:   op,
+		Path: path,
+		Err:  err,
+		Time: time.Now(),
+	}
+
+	diagnostics.Lock()
+
+	if op != OpRecover {
+		if _, ok := diagnostics.lastErrors[sink]; !ok {
+			diagnostics.sinkNames = append(diagnostics.sinkNames, sink)
+		}
+
+		diagnostics.lastErrors[sink] = internalErr
+	}
+
+	key := diagnosticsKey{sink: sink, op: op}
+
+	limit, ok := diagnostics.limits[key]
+	if !ok {
+		limit = &diagnosticsLimit{}
+		diagnostics.limits[key] = limit
+	}
+
+	if !limit.reportedAt.IsZero() && internalErr.Time.Sub(limit.reportedAt) < diagnostics.interval {
+		limit.suppressed++
+
+		diagnostics.Unlock()
+
+		return
+	}
+
+	internalErr.Suppressed = limit.suppressed
+
+	limit.reportedAt = internalErr.Time
+	limit.suppressed = 0
+
+	handler := diagnostics.handler
+
+	diagnostics.Unlock()
+
+	select {
+	case diagnostics.channel <- internalErr:
+	default:
+	}
+
+	handler(internalErr)
+}
+
+// lastError returns the last error reported for sink, or nil.
+func lastError(sink string) *InternalError {
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+
+	return diagnostics.lastErrors[sink]
+}
+
+// erroredSinks returns the names of the sinks with a reported error, in the order of their first
+// error.
+func erroredSinks() []string {
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+
+	return append([]string(nil), diagnostics.sinkNames...)
+}
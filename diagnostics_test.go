@@ -0,0 +1,189 @@
+package tlog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureErrors sets an error handler that records the reported errors, and a rate limiting
+// interval, for the duration of the test. Errors reported by earlier tests are no longer limited.
+func captureErrors(t *testing.T, interval time.Duration) func() []*InternalError {
+	t.Helper()
+
+	var (
+		reported []*InternalError
+		mu       sync.Mutex
+	)
+
+	SetErrorHandler(func(err *InternalError) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		reported = append(reported, err)
+	})
+
+	setErrorInterval(interval)
+
+	diagnostics.Lock()
+	diagnostics.limits = make(map[diagnosticsKey]*diagnosticsLimit)
+	diagnostics.Unlock()
+
+	t.Cleanup(func() {
+		SetErrorHandler(nil)
+		setErrorInterval(DefaultErrorInterval)
+	})
+
+	return func() []*InternalError {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]*InternalError(nil), reported...)
+	}
+}
+
+// drainDiagnostics discards the errors waiting in the diagnostics channel.
+func drainDiagnostics() {
+	for {
+		select {
+		case <-Diagnostics():
+		default:
+			return
+		}
+	}
+}
+
+func TestReportErrorRateLimit(t *testing.T) {
+	reported := captureErrors(t, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		reportError("diag-rate", OpSend, "", fmt.Errorf("attempt %d failed", i))
+	}
+
+	// Another operation of the same sink is limited separately.
+	reportError("diag-rate", OpSpool, "/var/spool/app", errors.New("disk full"))
+
+	if got := reported(); len(got) != 2 || got[0].Op != OpSend || got[1].Op != OpSpool {
+		t.Fatalf("reported %v, want the first send error and the spool error", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	reportError("diag-rate", OpSend, "", errors.New("attempt 3 failed"))
+
+	got := reported()
+	if len(got) != 3 || got[2].Suppressed != 2 || got[2].Err.Error() != "attempt 3 failed" {
+		t.Fatalf("reported %v, want the error after the interval with 2 suppressed errors", got)
+	}
+
+	if want := "tlog diag-rate: send: attempt 3 failed"; got[2].Error() != want {
+		t.Errorf("Error() = %q, want %q", got[2].Error(), want)
+	}
+}
+
+func TestDiagnosticsDropsErrorsWhenFull(t *testing.T) {
+	reported := captureErrors(t, time.Hour)
+
+	drainDiagnostics()
+	t.Cleanup(drainDiagnostics)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < diagnosticsBuffer+10; i++ {
+			reportError(fmt.Sprintf("diag-full-%d", i), OpWrite, "", errors.New("write failed"))
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reportError blocked on the full diagnostics channel")
+	}
+
+	if got := len(Diagnostics()); got != diagnosticsBuffer {
+		t.Errorf("channel holds %d errors, want %d", got, diagnosticsBuffer)
+	}
+
+	if got := len(reported()); got != diagnosticsBuffer+10 {
+		t.Errorf("handler received %d errors, want all %d", got, diagnosticsBuffer+10)
+	}
+
+	select {
+	case first := <-Diagnostics():
+		if first.Sink != "diag-full-0" {
+			t.Errorf("first queued error is from %s, want diag-full-0", first.Sink)
+		}
+	default:
+		t.Error("diagnostics channel is empty")
+	}
+}
+
+func TestLastErrorAndErroredSinks(t *testing.T) {
+	captureErrors(t, time.Hour)
+
+	reportError("diag-first", OpWrite, "", errors.New("write failed"))
+	reportError("diag-second", OpCompress, "/var/log/app.log.1", errors.New("no space left"))
+	reportError("diag-first", OpSend, "", errors.New("connection refused"))
+
+	// Recovery is reported without replacing the last error.
+	reportError("diag-second", OpRecover, "", errSinkRecovered)
+
+	first := lastError("diag-first")
+	if first == nil || first.Op != OpSend || first.Err.Error() != "connection refused" || first.Time.IsZero() {
+		t.Errorf("last error of diag-first = %+v, want the later send error", first)
+	}
+
+	second := lastError("diag-second")
+	if second == nil || second.Op != OpCompress || second.Path != "/var/log/app.log.1" {
+		t.Errorf("last error of diag-second = %+v, want the compress error", second)
+	}
+
+	if got := lastError("diag-none"); got != nil {
+		t.Errorf("last error of a sink without errors = %v, want nil", got)
+	}
+
+	firstIndex, secondIndex := -1, -1
+
+	for i, name := range erroredSinks() {
+		switch name {
+		case "diag-first":
+			firstIndex = i
+		case "diag-second":
+			secondIndex = i
+		}
+	}
+
+	if firstIndex < 0 || secondIndex < firstIndex {
+		t.Errorf("errored sinks = %v, want diag-first before diag-second", erroredSinks())
+	}
+}
+
+func TestHealthReportsLastErrors(t *testing.T) {
+	captureErrors(t, time.Hour)
+
+	isolatedWriter := newIsolatedWriter("diag-isolated", &countingSink{}, &isolationConfig{queueSize: 16, timeout: time.Second})
+	defer isolatedWriter.Close()
+
+	reportError("diag-isolated", OpWrite, "", errSinkTimeout)
+	reportError("diag-remote", OpSend, "", errors.New("status 503"))
+
+	health := make(map[string]SinkHealth)
+	for _, sinkHealth := range Health() {
+		health[sinkHealth.Name] = sinkHealth
+	}
+
+	isolated, ok := health["diag-isolated"]
+	if !ok || isolated.LastError == nil || !errors.Is(isolated.LastError, errSinkTimeout) {
+		t.Errorf("health of diag-isolated = %+v, want the timeout as its last error", isolated)
+	}
+
+	remote, ok := health["diag-remote"]
+	if !ok || remote.State != SinkStateClosed || remote.LastError == nil || remote.LastError.Op != OpSend {
+		t.Errorf("health of diag-remote = %+v, want a closed sink with the send error", remote)
+	}
+}
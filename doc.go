@@ -7,11 +7,14 @@
 // error-level events to Sentry.
 //
 // When a context carries a valid trace identifier from github.com/choveylee/ttrace,
-// tlog emits that value under the trace_id field (see [CtxTraceId]).
+// tlog emits that value under the trace_id field (see [CtxTraceId]), together with
+// the span identifier and sampled flag of the active span ([CtxSpanId] and
+// [CtxTraceSampled]).
 //
 // Use [D], [I], [W], [E], [F], or [P] to create an event at the corresponding
-// severity. Add optional fields with [Tevent.Detail], [Tevent.Detailf], and
-// [Tevent.Err], then emit the record with [Tevent.Msg] or [Tevent.Msgf].
+// severity. Add optional fields with [Tevent.Detail], [Tevent.Detailf],
+// [Tevent.Err], [Tevent.Str], [Tevent.Any], and [Tevent.Object], then emit the record with
+// [Tevent.Msg] or [Tevent.Msgf].
 //
 // # Configuration
 //
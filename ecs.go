@@ -0,0 +1,113 @@
+package tlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EcsVersion is the Elastic Common Schema version declared in the ecs.version field of the ECS format.
+const EcsVersion = "8.11.0"
+
+// ecsFieldNames maps record keys to the ECS fields written by the ECS format. The caller and time
+// fields are split or reformatted separately and are therefore not listed.
+var ecsFieldNames = map[string]string{
+	fieldLevel:      "log.level",
+	fieldMessage:    "message",
+	fieldAppName:    "service.name",
+	CtxTraceId:      "trace.id",
+	CtxSpanId:       "span.id",
+	fieldError:      "error.message",
+	fieldErrorType:  "error.type",
+	fieldErrorStack: "error.stack_trace",
+}
+
+// ecsPriorityKeys lists the record keys written first, in order, by the ECS format.
+var ecsPriorityKeys = []string{
+	fieldTime,
+	fieldLevel,
+	fieldMessage,
+	fieldAppName,
+	CtxTraceId,
+	CtxSpanId,
+	fieldError,
+	fieldErrorType,
+	fieldErrorStack,
+	fieldCaller,
+}
+
+// ecsWriter re-encodes JSON records from tlog as Elastic Common Schema documents with dotted field
+// names, so that Elasticsearch can index them without an ingest pipeline.
+type ecsWriter struct {
+	out io.Writer
+}
+
+// reportsErrorDetail implements errorDetailReporter; ECS documents hold error.type and
+// error.stack_trace.
+func (w *ecsWriter) reportsErrorDetail() bool {
+	return true
+}
+
+// Write implements io.Writer. It decodes one JSON record and writes the ECS document to out in a
+// single call. Fields without an ECS counterpart keep their record keys.
+func (w *ecsWriter) Write(p []byte) (int, error) {
+	record, err := decodeRecord(p)
+	if err != nil {
+		return 0, fmt.Errorf("tlog ecs: cannot decode record: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for _, key := range recordKeys(record, ecsPriorityKeys) {
+		value := record[key]
+
+		switch key {
+		case fieldTime:
+			recordTime, ok := parseRecordTime(value)
+			if !ok {
+				continue
+			}
+
+			err = appendJsonField(&buf, "@timestamp", recordTime.UTC().Format(time.RFC3339Nano))
+		case fieldCaller:
+			file, line, ok := splitCaller(value)
+			if !ok {
+				err = appendJsonField(&buf, "log.origin.file.name", value)
+				break
+			}
+
+			err = appendJsonField(&buf, "log.origin.file.name", file)
+			if err == nil {
+				err = appendJsonField(&buf, "log.origin.file.line", line)
+			}
+		case fieldMessage:
+			err = appendJsonField(&buf, "message", value)
+			if err == nil {
+				err = appendJsonField(&buf, "ecs.version", EcsVersion)
+			}
+		default:
+			name, ok := ecsFieldNames[key]
+			if !ok {
+				name = key
+			}
+
+			err = appendJsonField(&buf, name, value)
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("tlog ecs: %w", err)
+		}
+	}
+
+	buf.WriteString("}\n")
+
+	_, err = w.out.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,198 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// stackError is an error that carries a stack trace, as reported by the ECS format.
+type stackError struct {
+	msg string
+}
+
+func (e *stackError) Error() string {
+	return e.msg
+}
+
+func (e *stackError) StackTrack() string {
+	return "main.charge\n\tbilling/charge.go:42"
+}
+
+func decodeTestDocument(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+
+	var document map[string]any
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&document)
+	if err != nil {
+		t.Fatalf("cannot decode %q: %v", data, err)
+	}
+
+	return document
+}
+
+// checkEcsFieldRules checks the rules ECS imposes on the field names of a document: dotted names
+// are written flat, and no field is at once a leaf and the parent of another field, as error and
+// error.message would be.
+func checkEcsFieldRules(t *testing.T, document map[string]any) {
+	t.Helper()
+
+	for key := range document {
+		if key == "" || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".") || strings.Contains(key, "..") {
+			t.Errorf("invalid field name %q", key)
+		}
+
+		for other := range document {
+			if strings.HasPrefix(other, key+".") {
+				t.Errorf("field %q is both a leaf and the parent of %q", key, other)
+			}
+		}
+	}
+}
+
+func TestEcsDocument(t *testing.T) {
+	var buf bytes.Buffer
+
+	record := `{"level":"error","app_name":"billing","trace_id":"0af7651916cd43dd8448eb211c80319c",` +
+		`"span_id":"b7ad6b7169203331","caller":"billing/charge.go:42","error":"card declined",` +
+		`"\u0000error_type":"*errors.errorString","\u0000error_stack":"main.charge","order_id":"A-17",` +
+		`"time":"2026-01-02T04:04:05+01:00","message":"charge failed"}` + "\n"
+
+	_, err := newFormatWriter(LogFormatEcs, &buf, nil).Write([]byte(record))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if !strings.HasPrefix(buf.String(), `{"@timestamp":`) || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("document %q is not one line starting with @timestamp", buf.String())
+	}
+
+	document := decodeTestDocument(t, buf.Bytes())
+
+	checkEcsFieldRules(t, document)
+
+	for key, want := range map[string]any{
+		"@timestamp":           "2026-01-02T03:04:05Z",
+		"log.level":            "error",
+		"message":              "charge failed",
+		"ecs.version":          EcsVersion,
+		"service.name":         "billing",
+		"trace.id":             "0af7651916cd43dd8448eb211c80319c",
+		"span.id":              "b7ad6b7169203331",
+		"error.message":        "card declined",
+		"error.type":           "*errors.errorString",
+		"error.stack_trace":    "main.charge",
+		"log.origin.file.name": "billing/charge.go",
+		"log.origin.file.line": json.Number("42"),
+		"order_id":             "A-17",
+	} {
+		if got := document[key]; got != want {
+			t.Errorf("%s = %v (%T), want %v", key, got, got, want)
+		}
+	}
+
+	for _, key := range []string{fieldTime, fieldLevel, fieldAppName, CtxTraceId, CtxSpanId, fieldError, fieldErrorType,
+		fieldErrorStack, fieldCaller} {
+		if _, ok := document[key]; ok {
+			t.Errorf("record key %q was not mapped to ECS", key)
+		}
+	}
+
+	timestamp, _ := document["@timestamp"].(string)
+	if _, err := time.Parse(time.RFC3339Nano, timestamp); err != nil || !strings.HasSuffix(timestamp, "Z") {
+		t.Errorf("@timestamp %q is not an RFC 3339 time in UTC", timestamp)
+	}
+}
+
+func TestEcsErrorDetailOnlyReachesEcs(t *testing.T) {
+	fields := &fieldConfig{}
+
+	var jsonBuf, logfmtBuf, ecsBuf bytes.Buffer
+
+	writers := []io.Writer{
+		newFormatWriter(LogFormatJson, &jsonBuf, fields),
+		newFormatWriter(LogFormatLogfmt, &logfmtBuf, fields),
+		newFormatWriter(LogFormatEcs, &ecsBuf, fields),
+	}
+
+	tl := newTlog("billing", zerolog.MultiLevelWriter(writers...), fields)
+	tl.errorDetail = reportsErrorDetail(writers...)
+
+	// User fields named like the error detail fields are kept by every output.
+	newTevent("ERROR", tl).Err(&stackError{msg: "card declined"}).Str("error_type", "decline").
+		Str(fieldErrorStack, "forged").Msg("charge failed")
+
+	document := decodeTestDocument(t, ecsBuf.Bytes())
+
+	checkEcsFieldRules(t, document)
+
+	for key, want := range map[string]any{
+		"error.type":        "*tlog.stackError",
+		"error.stack_trace": "main.charge\n\tbilling/charge.go:42",
+		"error_type":        "decline",
+		"\uFFFDerror_stack": "forged",
+	} {
+		if got := document[key]; got != want {
+			t.Errorf("ECS %q = %q, want %q", key, got, want)
+		}
+	}
+
+	record := decodeTestDocument(t, jsonBuf.Bytes())
+
+	for key, want := range map[string]any{
+		fieldError:          "card declined",
+		"error_type":        "decline",
+		"\uFFFDerror_stack": "forged",
+	} {
+		if got := record[key]; got != want {
+			t.Errorf("JSON %q = %v, want %v", key, got, want)
+		}
+	}
+
+	for _, key := range []string{fieldErrorType, fieldErrorStack} {
+		if _, ok := record[key]; ok {
+			t.Errorf("JSON record %q has %q", jsonBuf.String(), key)
+		}
+	}
+
+	if !strings.Contains(logfmtBuf.String(), "error_type=decline") || strings.Contains(logfmtBuf.String(), "stackError") {
+		t.Errorf("logfmt record %q, want the user field without the error detail", logfmtBuf.String())
+	}
+}
+
+func TestErrorDetailOnlyRecordedForReporters(t *testing.T) {
+	var buf bytes.Buffer
+
+	writers := []io.Writer{newFormatWriter(LogFormatJson, &buf, &fieldConfig{})}
+
+	if reportsErrorDetail(writers...) {
+		t.Fatal("a JSON writer reports the error detail")
+	}
+
+	tl := newTlog("billing", zerolog.MultiLevelWriter(writers...), &fieldConfig{})
+
+	newTevent("ERROR", tl).Err(&stackError{msg: "card declined"}).Msg("charge failed")
+
+	if strings.Contains(buf.String(), "stackError") {
+		t.Errorf("record %q has the error detail without a writer reporting it", buf.String())
+	}
+
+	for _, writer := range []io.Writer{
+		&router{routes: []routeSink{&routeWriter{out: newFormatWriter(LogFormatEcs, &buf, &fieldConfig{})}}},
+		&splitWriter{low: &buf, high: newFormatWriter(LogFormatEcs, &buf, &fieldConfig{})},
+		&OtlpWriter{},
+	} {
+		if !reportsErrorDetail(writer) {
+			t.Errorf("%T does not report the error detail of its ECS encoder", writer)
+		}
+	}
+}
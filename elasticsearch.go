@@ -0,0 +1,352 @@
+package tlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+)
+
+const (
+	// EsIndexDateFormat is the Go reference layout of the date suffix of Elasticsearch index names.
+	EsIndexDateFormat = "2006.01.02"
+
+	// esBulkPath is the path of the bulk API.
+	esBulkPath = "/_bulk"
+)
+
+// EsWriter indexes records into Elasticsearch or OpenSearch through the _bulk API, in daily indices
+// named <prefix>-<yyyy.MM.dd> after the record time in UTC. Requests that fail as a whole are
+// retried with exponential backoff; items rejected with 429 or a server error are retried on their
+// own, and items that are rejected permanently or still fail after the last attempt are written
+// to the fallback writer, unless a disk spool takes over a batch of which nothing was handled.
+type EsWriter struct {
+	*batchWriter
+
+	// endpoint is the URL of the bulk API.
+	endpoint string
+
+	// indexPrefix is the index name without its date suffix.
+	indexPrefix string
+
+	// encode converts one record to the indexed document.
+	encode func(p []byte) ([]byte, error)
+
+	// errorDetail is set when documents are encoded as ECS, which reports the error detail fields.
+	errorDetail bool
+
+	// username and password enable basic authentication; apiKey enables API key authentication.
+	username string
+	password string
+	apiKey   string
+
+	// fallback receives the original records of failed items.
+	fallback io.Writer
+
+	client *http.Client
+}
+
+// esItem is one record queued for indexing.
+type esItem struct {
+	record []byte
+
+	index    string
+	document []byte
+}
+
+// esBulkResponse holds the fields of a bulk response used for per-item error handling.
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+
+	Items []map[string]struct {
+		Status int `json:"status"`
+
+		Error struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// newEsWriter constructs an EsWriter for the cluster at endpoint. Documents are encoded with
+// format, which must produce JSON: [LogFormatJson], [LogFormatEcs], or [LogFormatGcp]; other
+// formats fall back to JSON. A nil fallback discards failed items. Non-positive timeout,
+// flushSize, and flushInterval values fall back to DefaultSendTimeout, DefaultBatchSize, and
+// DefaultBatchInterval.
+func newEsWriter(endpoint, indexPrefix, format string, fields *fieldConfig, username, password, apiKey string,
+	fallback io.Writer, timeout time.Duration, flushSize int, flushInterval time.Duration) (*EsWriter, error) {
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("tlog elasticsearch: invalid endpoint %q: %w", endpoint, err)
+	}
+
+	if endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https" {
+		return nil, fmt.Errorf("tlog elasticsearch: invalid endpoint %q: scheme must be http or https", endpoint)
+	}
+
+	endpointUrl.Path = strings.TrimSuffix(endpointUrl.Path, "/") + esBulkPath
+
+	if indexPrefix == "" {
+		return nil, errors.New("tlog elasticsearch: index prefix is empty")
+	}
+
+	switch strings.ToUpper(format) {
+	case LogFormatEcs, LogFormatGcp:
+	default:
+		format = LogFormatJson
+	}
+
+	if fallback == nil {
+		fallback = io.Discard
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultSendTimeout
+	}
+
+	esWriter := &EsWriter{
+		endpoint: endpointUrl.String(),
+
+		indexPrefix: strings.ToLower(indexPrefix),
+
+		encode: func(p []byte) ([]byte, error) {
+			var buf bytes.Buffer
+
+			_, err := newFormatWriter(format, &buf, fields).Write(p)
+			if err != nil {
+				return nil, err
+			}
+
+			return bytes.TrimRight(buf.Bytes(), "\n"), nil
+		},
+
+		errorDetail: strings.EqualFold(format, LogFormatEcs),
+
+		username: username,
+		password: password,
+		apiKey:   apiKey,
+
+		fallback: fallback,
+
+		client: &http.Client{Timeout: timeout},
+	}
+
+	esWriter.batchWriter = newBatchWriter("elasticsearch", flushSize, flushInterval, esWriter.bulk)
+
+	return esWriter, nil
+}
+
+// newEsFallback returns the fallback writer named by target: stderr, stdout, discard, or the path
+// of a file opened for appending.
+func newEsFallback(target string) (io.Writer, error) {
+	switch strings.ToLower(target) {
+	case "", "stderr":
+		return os.Stderr, nil
+	case "stdout":
+		return os.Stdout, nil
+	case "discard":
+		return io.Discard, nil
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("tlog elasticsearch: cannot open fallback file %q: %w", target, err)
+	}
+
+	return file, nil
+}
+
+// bulk indexes records, retrying the request or its retryable items, and sends failed items to
+// the fallback writer. A batch is left to the disk spool only while none of its records has been
+// indexed or written to the fallback writer, so that replaying it duplicates nothing; once part of
+// reportsErrorDetail implements errorDetailReporter for documents encoded as ECS.
+func (w *EsWriter) reportsErrorDetail() bool {
+	return w.errorDetail
+}
+
+// the batch has been handled, the remaining items are written to the fallback writer as well.
+func (w *EsWriter) bulk(records [][]byte) error {
+	pending := make([]esItem, 0, len(records))
+
+	var rejected int
+
+	var rejectErr error
+
+	for _, record := range records {
+		item, err := w.buildItem(record)
+		if err != nil {
+			w.writeFallback(record)
+
+			rejected++
+			rejectErr = err
+
+			continue
+		}
+
+		pending = append(pending, item)
+	}
+
+	if len(pending) == 0 {
+		return &rejectedError{rejected: rejected, err: rejectErr}
+	}
+
+	err := sendWithRetry(w.done, func() error {
+		retryItems, failedItems, err := w.post(pending)
+		if err != nil {
+			return err
+		}
+
+		for _, failedItem := range failedItems {
+			w.writeFallback(failedItem.record)
+		}
+
+		if len(failedItems) > 0 {
+			rejected += len(failedItems)
+			rejectErr = errors.New("items were rejected permanently")
+		}
+
+		pending = retryItems
+
+		if len(pending) > 0 {
+			return fmt.Errorf("%d items were rejected temporarily", len(pending))
+		}
+
+		return nil
+	})
+	if err != nil {
+		if w.spool != nil && spoolable(err) && len(pending) == len(records) {
+			return err
+		}
+
+		for _, item := range pending {
+			w.writeFallback(item.record)
+		}
+
+		return &rejectedError{rejected: rejected + len(pending), err: err}
+	}
+
+	if rejected > 0 {
+		return &rejectedError{rejected: rejected, err: rejectErr}
+	}
+
+	return nil
+}
+
+// buildItem determines the index of record and encodes its document.
+func (w *EsWriter) buildItem(record []byte) (esItem, error) {
+	decoded, err := decodeRecord(record)
+	if err != nil {
+		return esItem{}, err
+	}
+
+	recordTime, ok := parseRecordTime(decoded[fieldTime])
+	if !ok {
+		recordTime = time.Now()
+	}
+
+	document, err := w.encode(record)
+	if err != nil {
+		return esItem{}, err
+	}
+
+	return esItem{
+		record: record,
+
+		index:    w.indexPrefix + "-" + recordTime.UTC().Format(EsIndexDateFormat),
+		document: document,
+	}, nil
+}
+
+// post sends one bulk request for items. It returns the items rejected with a retryable status and
+// the items rejected permanently; a non-nil error means the request as a whole failed.
+func (w *EsWriter) post(items []esItem) ([]esItem, []esItem, error) {
+	var body bytes.Buffer
+
+	for _, item := range items {
+		action, err := jsoniter.Marshal(map[string]any{"index": map[string]string{"_index": item.index}})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(item.document)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.endpoint, &body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	if w.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+w.apiKey)
+	} else if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = newStatusError(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bulkResponse esBulkResponse
+
+	err = jsoniter.Unmarshal(data, &bulkResponse)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decode bulk response: %w", err)
+	}
+
+	if !bulkResponse.Errors {
+		return nil, nil, nil
+	}
+
+	var retryItems, failedItems []esItem
+
+	for i, result := range bulkResponse.Items {
+		if i >= len(items) {
+			break
+		}
+
+		for _, itemResult := range result {
+			if itemResult.Status < 300 {
+				continue
+			}
+
+			if retryable(&statusError{statusCode: itemResult.Status}) {
+				retryItems = append(retryItems, items[i])
+			} else {
+				failedItems = append(failedItems, items[i])
+			}
+		}
+	}
+
+	return retryItems, failedItems, nil
+}
+
+// writeFallback writes the original record of a failed item to the fallback writer.
+func (w *EsWriter) writeFallback(record []byte) {
+	_, _ = w.fallback.Write(record)
+}
@@ -0,0 +1,258 @@
+package tlog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/json-iterator/go"
+)
+
+// esStubServer emulates the _bulk API. Each document is answered with the next status listed for
+// its message; the last status of a message repeats.
+type esStubServer struct {
+	*httptest.Server
+
+	statuses map[string][]int
+
+	// received counts the documents received per message.
+	received map[string]int
+
+	// index is the index named by the last action.
+	index string
+
+	sync.Mutex
+}
+
+func newEsStubServer(t *testing.T, statuses map[string][]int) *esStubServer {
+	stub := &esStubServer{
+		statuses: statuses,
+		received: make(map[string]int),
+	}
+
+	stub.Server = httptest.NewServer(http.HandlerFunc(stub.serveBulk))
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+func (s *esStubServer) serveBulk(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != esBulkPath || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var items []map[string]any
+
+	errorsFound := false
+
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var action map[string]map[string]string
+
+		err := jsoniter.Unmarshal(scanner.Bytes(), &action)
+		if err != nil || action["index"]["_index"] == "" || !scanner.Scan() {
+			http.Error(w, "invalid bulk body", http.StatusBadRequest)
+			return
+		}
+
+		s.index = action["index"]["_index"]
+
+		var document map[string]any
+
+		err = jsoniter.Unmarshal(scanner.Bytes(), &document)
+		if err != nil {
+			http.Error(w, "invalid document", http.StatusBadRequest)
+			return
+		}
+
+		message, _ := document[fieldMessage].(string)
+
+		statuses := s.statuses[message]
+
+		status := http.StatusCreated
+		if len(statuses) > 0 {
+			status = statuses[min(s.received[message], len(statuses)-1)]
+		}
+
+		s.received[message]++
+
+		result := map[string]any{"status": status}
+		if status >= 300 {
+			errorsFound = true
+			result["error"] = map[string]string{"type": "stub_exception", "reason": message}
+		}
+
+		items = append(items, map[string]any{"index": result})
+	}
+
+	data, _ := jsoniter.Marshal(map[string]any{"errors": errorsFound, "items": items})
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (s *esStubServer) count(message string) int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.received[message]
+}
+
+func (s *esStubServer) indexName() string {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.index
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	buf bytes.Buffer
+
+	sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.String()
+}
+
+func esTestRecords(messages ...string) [][]byte {
+	records := make([][]byte, len(messages))
+	for i, message := range messages {
+		records[i] = []byte(fmt.Sprintf(`{"level":"info","time":"2026-01-02T03:04:05Z","message":%q}`+"\n", message))
+	}
+
+	return records
+}
+
+func newTestEsWriter(t *testing.T, endpoint string, fallback *syncBuffer) *EsWriter {
+	esWriter, err := newEsWriter(endpoint, "logs", LogFormatJson, nil, "", "", "", fallback, time.Second, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("newEsWriter: %v", err)
+	}
+
+	return esWriter
+}
+
+func TestEsBulkRetriesTemporaryItems(t *testing.T) {
+	stub := newEsStubServer(t, map[string][]int{
+		"rejected":  {http.StatusBadRequest},
+		"throttled": {http.StatusTooManyRequests, http.StatusCreated},
+	})
+
+	fallback := &syncBuffer{}
+
+	esWriter := newTestEsWriter(t, stub.URL, fallback)
+	defer esWriter.Close()
+
+	err := esWriter.bulk(esTestRecords("indexed", "rejected", "throttled"))
+
+	var rejectedErr *rejectedError
+	if !errors.As(err, &rejectedErr) || rejectedErr.rejected != 1 {
+		t.Fatalf("bulk error = %v, want 1 rejected record", err)
+	}
+
+	if spoolable(err) {
+		t.Errorf("bulk error %v is spoolable", err)
+	}
+
+	if got := stub.count("indexed"); got != 1 {
+		t.Errorf("indexed document sent %d times, want 1", got)
+	}
+
+	if got := stub.count("throttled"); got != 2 {
+		t.Errorf("throttled document sent %d times, want 2", got)
+	}
+
+	if got := fallback.String(); !strings.Contains(got, `"rejected"`) || strings.Contains(got, `"indexed"`) ||
+		strings.Contains(got, `"throttled"`) {
+		t.Errorf("fallback = %q, want only the rejected record", got)
+	}
+
+	if got := stub.indexName(); got != "logs-2026.01.02" {
+		t.Errorf("index = %q, want logs-2026.01.02", got)
+	}
+}
+
+func TestEsBulkSpoolsOnlyUnhandledBatches(t *testing.T) {
+	stub := newEsStubServer(t, map[string][]int{
+		"throttled": {http.StatusTooManyRequests},
+	})
+
+	fallback := &syncBuffer{}
+
+	esWriter := newTestEsWriter(t, stub.URL, fallback)
+
+	spool, err := openDiskSpool(t.TempDir(), 0, 0, SpoolDropNewest)
+	if err != nil {
+		t.Fatalf("openDiskSpool: %v", err)
+	}
+
+	defer spool.close()
+
+	// Closing the writer abandons the retries, so the item-level retry runs out at once.
+	esWriter.Close()
+	esWriter.spool = spool
+
+	err = esWriter.bulk(esTestRecords("throttled"))
+	if err == nil || !spoolable(err) {
+		t.Fatalf("bulk error = %v, want a spoolable error for a batch of which nothing was handled", err)
+	}
+
+	if got := fallback.String(); got != "" {
+		t.Errorf("fallback = %q, want nothing for a spooled batch", got)
+	}
+
+	err = esWriter.bulk(esTestRecords("indexed", "throttled"))
+
+	var rejectedErr *rejectedError
+	if !errors.As(err, &rejectedErr) || rejectedErr.rejected != 1 || spoolable(err) {
+		t.Fatalf("bulk error = %v, want 1 rejected record and no spooling after a partial success", err)
+	}
+
+	if got := fallback.String(); !strings.Contains(got, `"throttled"`) || strings.Contains(got, `"indexed"`) {
+		t.Errorf("fallback = %q, want only the throttled record", got)
+	}
+}
+
+func TestEsDeliverCountsRejectedItems(t *testing.T) {
+	stub := newEsStubServer(t, map[string][]int{
+		"rejected": {http.StatusBadRequest},
+	})
+
+	fallback := &syncBuffer{}
+
+	esWriter := newTestEsWriter(t, stub.URL, fallback)
+
+	for _, record := range esTestRecords("first", "rejected", "second") {
+		_, _ = esWriter.Write(record)
+	}
+
+	esWriter.Close()
+
+	health := esWriter.health()
+	if health.Written != 2 || health.Dropped != 1 {
+		t.Errorf("written = %d, dropped = %d, want 2 and 1", health.Written, health.Dropped)
+	}
+}
@@ -0,0 +1,341 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/choveylee/tcfg"
+	"github.com/rs/zerolog"
+)
+
+// Keys of the records tlog hands to its writers. Encoders rename them according to fieldConfig.
+const (
+	fieldTime    = "time"
+	fieldLevel   = "level"
+	fieldMessage = "message"
+	fieldAppName = "app_name"
+	fieldDetail  = "detail"
+	fieldCaller  = "caller"
+	fieldError   = "error"
+
+	// fieldErrorType and fieldErrorStack are only written when a writer of the logger reports them,
+	// and only reach the outputs whose encoders do. Their keys are reserved, so that they never
+	// collide with user fields.
+	fieldErrorType  = fieldReservedPrefix + "error_type"
+	fieldErrorStack = fieldReservedPrefix + "error_stack"
+
+	// fieldReservedPrefix starts the keys of the fields that tlog records for its encoders only.
+	// userKey keeps it out of the keys of user fields.
+	fieldReservedPrefix = "\x00"
+
+	// fieldTruncated lists the keys of the values cut to their byte budget.
+	fieldTruncated = "truncated"
+)
+
+// fieldPriorityKeys lists the keys written first, in order, by encoders that reorder records.
+var fieldPriorityKeys = []string{
+	fieldTime,
+	fieldLevel,
+	fieldAppName,
+	CtxTraceId,
+	CtxSpanId,
+	fieldMessage,
+}
+
+// fieldConfig holds the timestamp layout and output key names of one Tlog. It replaces the
+// process-wide zerolog.TimeFieldFormat and zerolog field name variables.
+type fieldConfig struct {
+	// timeFormat is one of the TimeFormat constants.
+	timeFormat string
+
+	// timeUtc writes timestamps in UTC instead of the local time zone.
+	timeUtc bool
+
+	// names maps record keys to output keys. It only holds keys that are renamed.
+	names map[string]string
+
+	// control is the control character policy of the console and logfmt formats, ControlEscape or
+	// ControlStrip.
+	control string
+}
+
+// loadFieldConfig reads the timestamp and field name configuration through tcfg.
+func loadFieldConfig() *fieldConfig {
+	fields := &fieldConfig{
+		timeFormat: strings.ToUpper(tcfg.DefaultString(tcfg.LocalKey(LogTimeFormat), TimeFormatRFC3339)),
+		timeUtc:    tcfg.DefaultBool(tcfg.LocalKey(LogTimeUtc), false),
+
+		names: make(map[string]string),
+
+		control: strings.ToLower(tcfg.DefaultString(tcfg.LocalKey(LogControlChars), ControlEscape)),
+	}
+
+	fieldKeys := map[string]string{
+		fieldTime:       LogFieldTime,
+		fieldLevel:      LogFieldLevel,
+		fieldMessage:    LogFieldMessage,
+		fieldAppName:    LogFieldAppName,
+		CtxTraceId:      LogFieldTraceId,
+		CtxSpanId:       LogFieldSpanId,
+		CtxTraceSampled: LogFieldTraceSampled,
+		fieldDetail:     LogFieldDetail,
+		fieldCaller:     LogFieldCaller,
+		fieldError:      LogFieldError,
+	}
+
+	for field, configKey := range fieldKeys {
+		name := tcfg.DefaultString(tcfg.LocalKey(configKey), field)
+		if name != "" && name != field {
+			fields.names[field] = name
+		}
+	}
+
+	return fields
+}
+
+// name returns the output key for the record key field.
+func (c *fieldConfig) name(field string) string {
+	if c == nil {
+		return field
+	}
+
+	if name, ok := c.names[field]; ok {
+		return name
+	}
+
+	return field
+}
+
+// controlMode returns the control character policy of the console and logfmt formats.
+func (c *fieldConfig) controlMode() string {
+	if c == nil {
+		return ControlEscape
+	}
+
+	return c.control
+}
+
+// renamed reports whether any output key differs from its record key.
+func (c *fieldConfig) renamed() bool {
+	return c != nil && len(c.names) > 0
+}
+
+// Run implements zerolog.Hook by writing the current time under the time key in the configured layout.
+func (c *fieldConfig) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	curTime := time.Now()
+	if c.timeUtc {
+		curTime = curTime.UTC()
+	}
+
+	switch c.timeFormat {
+	case TimeFormatRFC3339Nano:
+		e.Str(fieldTime, curTime.Format(time.RFC3339Nano))
+	case TimeFormatUnix:
+		e.Int64(fieldTime, curTime.Unix())
+	case TimeFormatUnixMs:
+		e.Int64(fieldTime, curTime.UnixMilli())
+	case TimeFormatUnixMicro:
+		e.Int64(fieldTime, curTime.UnixMicro())
+	case TimeFormatUnixNano:
+		e.Int64(fieldTime, curTime.UnixNano())
+	default:
+		e.Str(fieldTime, curTime.Format(time.RFC3339))
+	}
+}
+
+// parseRecordTime converts a decoded time value back to time.Time. RFC 3339 strings of any
+// precision are accepted; epoch numbers are interpreted as seconds, milliseconds, microseconds, or
+// nanoseconds depending on their magnitude.
+func parseRecordTime(value any) (time.Time, bool) {
+	switch val := value.(type) {
+	case string:
+		recordTime, err := time.Parse(time.RFC3339Nano, val)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		return recordTime, true
+	case json.Number:
+		epoch, err := val.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		switch {
+		case epoch < 1e11:
+			return time.Unix(epoch, 0), true
+		case epoch < 1e14:
+			return time.UnixMilli(epoch), true
+		case epoch < 1e17:
+			return time.UnixMicro(epoch), true
+		default:
+			return time.Unix(0, epoch), true
+		}
+	default:
+		return time.Time{}, false
+	}
+}
+
+// renameWriter re-encodes JSON records with the output keys of a fieldConfig.
+type renameWriter struct {
+	out io.Writer
+
+	fields *fieldConfig
+}
+
+// Write implements io.Writer. It decodes one JSON record, renames its keys, and writes the record
+// to out in a single call.
+func (w *renameWriter) Write(p []byte) (int, error) {
+	record, err := decodeRecord(p)
+	if err != nil {
+		return 0, fmt.Errorf("tlog rename: cannot decode record: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for _, key := range recordKeys(record, fieldPriorityKeys) {
+		err := appendJsonField(&buf, w.fields.name(key), record[key])
+		if err != nil {
+			return 0, fmt.Errorf("tlog rename: %w", err)
+		}
+	}
+
+	buf.WriteString("}\n")
+
+	_, err = w.out.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// userKey returns key with a leading fieldReservedPrefix replaced by U+FFFD, so that user fields
+// cannot take the keys of the fields that tlog records for its encoders.
+func userKey(key string) string {
+	if strings.HasPrefix(key, fieldReservedPrefix) {
+		return "\uFFFD" + key[len(fieldReservedPrefix):]
+	}
+
+	return key
+}
+
+// errorDetailReporter is implemented by writers whose encoders report the error_type and
+// error_stack fields, such as the ECS format and the OTLP exporter, and by writers that pass
+// records to such encoders.
+type errorDetailReporter interface {
+	reportsErrorDetail() bool
+}
+
+// reportsErrorDetail reports whether any of writers reports the error detail fields.
+func reportsErrorDetail(writers ...io.Writer) bool {
+	for _, writer := range writers {
+		reporter, ok := writer.(errorDetailReporter)
+		if ok && reporter.reportsErrorDetail() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errorDetailFilter removes the error_type and error_stack fields from the records written to an
+// output whose encoder does not report them. They are only recorded while another writer of the
+// logger reports them, such as an ECS file or the OTLP exporter.
+type errorDetailFilter struct {
+	out io.Writer
+}
+
+// withoutErrorDetail wraps out in an errorDetailFilter.
+func withoutErrorDetail(out io.Writer) io.Writer {
+	return &errorDetailFilter{out: out}
+}
+
+// Write implements io.Writer.
+func (w *errorDetailFilter) Write(p []byte) (int, error) {
+	_, err := w.out.Write(stripReservedFields(p))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *errorDetailFilter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	levelWriter, ok := w.out.(zerolog.LevelWriter)
+	if !ok {
+		return w.Write(p)
+	}
+
+	_, err := levelWriter.WriteLevel(level, stripReservedFields(p))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close closes out when it is an io.Closer.
+func (w *errorDetailFilter) Close() error {
+	closer, ok := w.out.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	return closer.Close()
+}
+
+// reservedFieldMarker starts a field with a reserved key as zerolog encodes it.
+var reservedFieldMarker = []byte(`,"\u0000`)
+
+// stripReservedFields returns p without the fields whose keys start with fieldReservedPrefix.
+// zerolog writes them as string fields after the first field of the record, and the marker of
+// their keys cannot occur unescaped inside a string value, so each is removed from its marker up
+// to the closing quote of its value.
+func stripReservedFields(p []byte) []byte {
+	for {
+		start := bytes.Index(p, reservedFieldMarker)
+		if start < 0 {
+			return p
+		}
+
+		keyEnd := jsonStringEnd(p, start+len(`,"`))
+		if keyEnd < 0 || !bytes.HasPrefix(p[keyEnd:], []byte(`:"`)) {
+			return p
+		}
+
+		end := jsonStringEnd(p, keyEnd+len(`:"`))
+		if end < 0 {
+			return p
+		}
+
+		// p belongs to zerolog, so the record is copied rather than edited in place.
+		stripped := make([]byte, 0, len(p)-(end-start))
+		stripped = append(stripped, p[:start]...)
+		stripped = append(stripped, p[end:]...)
+
+		p = stripped
+	}
+}
+
+// jsonStringEnd returns the index after the closing quote of the JSON string whose contents start
+// at start in p, or -1 when the string is not terminated.
+func jsonStringEnd(p []byte, start int) int {
+	for i := start; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+
+	return -1
+}
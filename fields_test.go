@@ -0,0 +1,110 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestFieldTimeFormats(t *testing.T) {
+	for _, test := range []struct {
+		timeFormat string
+		check      func(value any) (time.Time, bool)
+		precision  time.Duration
+	}{
+		{TimeFormatRFC3339, parseTestTimeString(time.RFC3339), time.Second},
+		{"", parseTestTimeString(time.RFC3339), time.Second},
+		{TimeFormatRFC3339Nano, parseTestTimeString(time.RFC3339Nano), time.Nanosecond},
+		{TimeFormatUnix, parseTestTimeNumber(func(n int64) time.Time { return time.Unix(n, 0) }), time.Second},
+		{TimeFormatUnixMs, parseTestTimeNumber(time.UnixMilli), time.Millisecond},
+		{TimeFormatUnixMicro, parseTestTimeNumber(time.UnixMicro), time.Microsecond},
+		{TimeFormatUnixNano, parseTestTimeNumber(func(n int64) time.Time { return time.Unix(0, n) }), time.Nanosecond},
+	} {
+		var buf bytes.Buffer
+
+		tl := newTlog("billing", zerolog.MultiLevelWriter(&buf), &fieldConfig{timeFormat: test.timeFormat, timeUtc: true})
+
+		before := time.Now().Truncate(test.precision)
+
+		newTevent("INFO", tl).Msg("started")
+
+		after := time.Now()
+
+		record := decodeTestDocument(t, buf.Bytes())
+
+		recordTime, ok := test.check(record[fieldTime])
+		if !ok || recordTime.Before(before) || recordTime.After(after) {
+			t.Errorf("%q: time = %v, want a %s timestamp between %v and %v", test.timeFormat, record[fieldTime],
+				test.timeFormat, before, after)
+		}
+
+		if str, ok := record[fieldTime].(string); ok && !strings.HasSuffix(str, "Z") {
+			t.Errorf("%q: time = %s, want UTC", test.timeFormat, str)
+		}
+	}
+}
+
+// parseTestTimeString returns a function that parses a time string written in exactly layout.
+func parseTestTimeString(layout string) func(value any) (time.Time, bool) {
+	return func(value any) (time.Time, bool) {
+		str, ok := value.(string)
+		if !ok {
+			return time.Time{}, false
+		}
+
+		parsed, err := time.Parse(layout, str)
+
+		return parsed, err == nil && parsed.Format(layout) == str
+	}
+}
+
+// parseTestTimeNumber returns a function that converts an epoch number with convert.
+func parseTestTimeNumber(convert func(int64) time.Time) func(value any) (time.Time, bool) {
+	return func(value any) (time.Time, bool) {
+		number, ok := value.(json.Number)
+		if !ok {
+			return time.Time{}, false
+		}
+
+		epoch, err := number.Int64()
+
+		return convert(epoch), err == nil
+	}
+}
+
+func TestRenameWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	fields := &fieldConfig{names: map[string]string{
+		fieldTime:    "@timestamp",
+		fieldLevel:   "severity",
+		fieldMessage: "msg",
+	}}
+
+	renameWriter := newFormatWriter(LogFormatJson, &buf, fields)
+
+	_, err := renameWriter.Write([]byte(`{"level":"info","app_name":"billing","time":"2026-01-02T03:04:05Z","message":"started","count":3}` + "\n"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	want := `{"@timestamp":"2026-01-02T03:04:05Z","severity":"info","app_name":"billing","msg":"started","count":3}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("renamed record = %s, want %s", got, want)
+	}
+
+	// Without renamed keys, JSON records are written unchanged.
+	buf.Reset()
+
+	record := `{"level":"info","message":"started"}` + "\n"
+
+	_, _ = newFormatWriter(LogFormatJson, &buf, &fieldConfig{}).Write([]byte(record))
+
+	if got := buf.String(); got != record {
+		t.Errorf("record = %s, want it unchanged", got)
+	}
+}
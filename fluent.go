@@ -0,0 +1,372 @@
+package tlog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultFluentAddress is the default address of a Fluentd or Fluent Bit forward input.
+	DefaultFluentAddress = "tcp://127.0.0.1:24224"
+
+	// fluentDialTimeout bounds connection attempts to the forward input.
+	fluentDialTimeout = 5 * time.Second
+)
+
+// FluentWriter sends records to a Fluentd or Fluent Bit forward input with the Forward protocol
+// v1 over TCP or a unix socket. Records are sent in batches as PackedForward messages, one per tag
+// <app_name>.<level>. When acknowledgements are enabled, every message carries a chunk id and is
+// only considered delivered once the server has acknowledged it, so that no record is lost when a
+// connection breaks (records may be delivered twice instead). When a shared key is configured,
+// the client authenticates with the handshake of the protocol after connecting.
+type FluentWriter struct {
+	*batchWriter
+
+	// network is tcp or unix.
+	network string
+	address string
+
+	// ack enables acknowledgements of every message.
+	ack bool
+
+	// sharedKey enables the handshake; username and password add user authentication.
+	sharedKey string
+	username  string
+	password  string
+
+	// hostname is the self hostname sent in the handshake.
+	hostname string
+
+	timeout time.Duration
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newFluentWriter constructs a FluentWriter for address, written as tcp://host:port,
+// unix:///path, or host:port. The connection is established on the first send. Non-positive
+// timeout, batchSize, and batchInterval values fall back to DefaultSendTimeout, DefaultBatchSize,
+// and DefaultBatchInterval.
+func newFluentWriter(address string, ack bool, sharedKey, username, password string, timeout time.Duration, batchSize int, batchInterval time.Duration) (*FluentWriter, error) {
+	network := "tcp"
+
+	if scheme, rest, ok := strings.Cut(address, "://"); ok {
+		network = strings.ToLower(scheme)
+		address = rest
+	}
+
+	if network != "tcp" && network != "unix" {
+		return nil, fmt.Errorf("tlog fluent: invalid address scheme %q: must be tcp or unix", network)
+	}
+
+	if address == "" {
+		return nil, errors.New("tlog fluent: address is empty")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultSendTimeout
+	}
+
+	fluentWriter := &FluentWriter{
+		network: network,
+		address: address,
+
+		ack: ack,
+
+		sharedKey: sharedKey,
+		username:  username,
+		password:  password,
+
+		hostname: hostname,
+
+		timeout: timeout,
+	}
+
+	fluentWriter.batchWriter = newBatchWriter("fluent", batchSize, batchInterval, fluentWriter.forward)
+
+	return fluentWriter, nil
+}
+
+// Close sends the records that are still queued and closes the connection.
+func (w *FluentWriter) Close() error {
+	err := w.batchWriter.Close()
+
+	w.disconnect()
+
+	return err
+}
+
+// forward groups records by tag and sends one PackedForward message per tag with retries.
+func (w *FluentWriter) forward(records [][]byte) error {
+	var tags []string
+
+	entries := make(map[string][]byte)
+	counts := make(map[string]int)
+
+	for _, p := range records {
+		record, err := decodeRecord(p)
+		if err != nil {
+			continue
+		}
+
+		recordTime, ok := parseRecordTime(record[fieldTime])
+		if !ok {
+			recordTime = time.Now()
+		}
+
+		delete(record, fieldTime)
+
+		tag := fluentTag(record)
+		if _, ok := entries[tag]; !ok {
+			tags = append(tags, tag)
+		}
+
+		// Entry: [EventTime, record].
+		entry := appendMsgpackArrayHeader(entries[tag], 2)
+		entry = appendMsgpackEventTime(entry, recordTime)
+		entry = appendMsgpack(entry, record)
+
+		entries[tag] = entry
+		counts[tag]++
+	}
+
+	var errs []error
+
+	for _, tag := range tags {
+		message, chunk, err := w.buildMessage(tag, entries[tag], counts[tag])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		err = sendWithRetry(w.done, func() error {
+			return w.send(message, chunk)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tag %s: %w", tag, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// buildMessage encodes a PackedForward message [tag, entries, option] and returns it with its
+// chunk id, which is empty when acknowledgements are disabled.
+func (w *FluentWriter) buildMessage(tag string, entries []byte, count int) ([]byte, string, error) {
+	option := map[string]any{"size": count}
+
+	var chunk string
+
+	if w.ack {
+		chunkId := make([]byte, 16)
+
+		_, err := rand.Read(chunkId)
+		if err != nil {
+			return nil, "", err
+		}
+
+		chunk = base64.StdEncoding.EncodeToString(chunkId)
+		option["chunk"] = chunk
+	}
+
+	message := appendMsgpackArrayHeader(nil, 3)
+	message = appendMsgpackString(message, tag)
+	message = appendMsgpackBin(message, entries)
+	message = appendMsgpack(message, option)
+
+	return message, chunk, nil
+}
+
+// send writes one message, connecting first when necessary, and waits for its acknowledgement
+// when chunk is not empty. The connection is closed on any failure so that the next attempt
+// starts with a new one.
+func (w *FluentWriter) send(message []byte, chunk string) error {
+	err := w.sendConn(message, chunk)
+	if err != nil {
+		w.disconnect()
+
+		return err
+	}
+
+	return nil
+}
+
+// sendConn performs send on the current connection.
+func (w *FluentWriter) sendConn(message []byte, chunk string) error {
+	if w.conn == nil {
+		err := w.connect()
+		if err != nil {
+			return err
+		}
+	}
+
+	_ = w.conn.SetDeadline(time.Now().Add(w.timeout))
+
+	_, err := w.conn.Write(message)
+	if err != nil {
+		return err
+	}
+
+	if chunk == "" {
+		return nil
+	}
+
+	response, err := readMsgpack(w.reader)
+	if err != nil {
+		return fmt.Errorf("cannot read acknowledgement: %w", err)
+	}
+
+	responseMap, _ := response.(map[string]any)
+	if ack, _ := responseMap["ack"].(string); ack != chunk {
+		return fmt.Errorf("unexpected acknowledgement %v for chunk %s", response, chunk)
+	}
+
+	return nil
+}
+
+// connect dials the forward input and performs the handshake when a shared key is configured.
+func (w *FluentWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, fluentDialTimeout)
+	if err != nil {
+		return err
+	}
+
+	w.conn = conn
+	w.reader = bufio.NewReader(conn)
+
+	if w.sharedKey == "" {
+		return nil
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(w.timeout))
+
+	err = w.handshake()
+	if err != nil {
+		return fmt.Errorf("handshake with %s://%s failed: %w", w.network, w.address, err)
+	}
+
+	return nil
+}
+
+// handshake answers the HELO message of the server with a PING message and verifies its PONG:
+//
+//	HELO: ["HELO", {"nonce": nonce, "auth": authSalt, "keepalive": bool}]
+//	PING: ["PING", hostname, sharedKeySalt, hex(sha512(sharedKeySalt + hostname + nonce + sharedKey)),
+//	       username, hex(sha512(authSalt + username + password))]
+//	PONG: ["PONG", authResult, reason, serverHostname,
+//	       hex(sha512(sharedKeySalt + serverHostname + nonce + sharedKey))]
+func (w *FluentWriter) handshake() error {
+	helo, err := readMsgpack(w.reader)
+	if err != nil {
+		return fmt.Errorf("cannot read HELO: %w", err)
+	}
+
+	heloArray, _ := helo.([]any)
+	if len(heloArray) < 2 || heloArray[0] != "HELO" {
+		return fmt.Errorf("unexpected message %v instead of HELO", helo)
+	}
+
+	heloOptions, _ := heloArray[1].(map[string]any)
+
+	nonce, _ := heloOptions["nonce"].(string)
+	authSalt, _ := heloOptions["auth"].(string)
+
+	sharedKeySalt := make([]byte, 16)
+
+	_, err = rand.Read(sharedKeySalt)
+	if err != nil {
+		return err
+	}
+
+	var passwordDigest string
+	if authSalt != "" {
+		passwordDigest = fluentDigest(authSalt, w.username, w.password)
+	}
+
+	ping := appendMsgpackArrayHeader(nil, 6)
+	ping = appendMsgpackString(ping, "PING")
+	ping = appendMsgpackString(ping, w.hostname)
+	ping = appendMsgpackBin(ping, sharedKeySalt)
+	ping = appendMsgpackString(ping, fluentDigest(string(sharedKeySalt), w.hostname, nonce, w.sharedKey))
+	ping = appendMsgpackString(ping, w.username)
+	ping = appendMsgpackString(ping, passwordDigest)
+
+	_, err = w.conn.Write(ping)
+	if err != nil {
+		return err
+	}
+
+	pong, err := readMsgpack(w.reader)
+	if err != nil {
+		return fmt.Errorf("cannot read PONG: %w", err)
+	}
+
+	pongArray, _ := pong.([]any)
+	if len(pongArray) < 5 || pongArray[0] != "PONG" {
+		return fmt.Errorf("unexpected message %v instead of PONG", pong)
+	}
+
+	if authResult, _ := pongArray[1].(bool); !authResult {
+		return fmt.Errorf("authentication failed: %v", pongArray[2])
+	}
+
+	serverHostname, _ := pongArray[3].(string)
+
+	if pongArray[4] != fluentDigest(string(sharedKeySalt), serverHostname, nonce, w.sharedKey) {
+		return errors.New("server shared key digest mismatch")
+	}
+
+	return nil
+}
+
+// disconnect closes the current connection, if any.
+func (w *FluentWriter) disconnect() {
+	if w.conn == nil {
+		return
+	}
+
+	_ = w.conn.Close()
+
+	w.conn = nil
+	w.reader = nil
+}
+
+// fluentTag returns the tag <app_name>.<level> of record.
+func fluentTag(record map[string]any) string {
+	appName, _ := record[fieldAppName].(string)
+	if appName == "" {
+		appName = "tlog"
+	}
+
+	level, _ := record[fieldLevel].(string)
+	if level == "" {
+		level = "nolevel"
+	}
+
+	return appName + "." + level
+}
+
+// fluentDigest returns the hex-encoded SHA-512 digest of the concatenated parts.
+func fluentDigest(parts ...string) string {
+	hash := sha512.New()
+
+	for _, part := range parts {
+		hash.Write([]byte(part))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,340 @@
+package tlog
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fluentTestForward is one PackedForward message received by a fluentTestServer.
+type fluentTestForward struct {
+	tag     string
+	records []map[string]any
+	option  map[string]any
+}
+
+// fluentTestServer accepts one connection on a local TCP listener and passes it to serve, which
+// runs in its own goroutine. It returns the address of the listener and a channel that receives
+// the error returned by serve.
+func fluentTestServer(t *testing.T, serve func(conn net.Conn, reader *bufio.Reader) error) (string, <-chan error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on tcp: %v", err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	served := make(chan error, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			served <- err
+			return
+		}
+
+		defer conn.Close()
+
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		served <- serve(conn, bufio.NewReader(conn))
+	}()
+
+	return "tcp://" + listener.Addr().String(), served
+}
+
+// readFluentTestForward reads and decodes one PackedForward message [tag, entries, option]. The
+// entries are [EventTime, record] arrays, whose EventTime the decoder skips.
+func readFluentTestForward(reader *bufio.Reader) (*fluentTestForward, error) {
+	message, err := readMsgpack(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	messageArray, _ := message.([]any)
+	if len(messageArray) != 3 {
+		return nil, fmt.Errorf("message %v is not a PackedForward message", message)
+	}
+
+	forward := &fluentTestForward{}
+
+	forward.tag, _ = messageArray[0].(string)
+	forward.option, _ = messageArray[2].(map[string]any)
+
+	entries, _ := messageArray[1].(string)
+	entryReader := bufio.NewReader(strings.NewReader(entries))
+
+	for {
+		entry, err := readMsgpack(entryReader)
+		if err != nil {
+			break
+		}
+
+		entryArray, _ := entry.([]any)
+		if len(entryArray) != 2 || entryArray[0] != nil {
+			return nil, fmt.Errorf("entry %v is not an [EventTime, record] array", entry)
+		}
+
+		record, _ := entryArray[1].(map[string]any)
+		forward.records = append(forward.records, record)
+	}
+
+	return forward, nil
+}
+
+// fluentTestRecords returns JSON records of billing with the given level and messages.
+func fluentTestRecords(level string, messages ...string) [][]byte {
+	records := make([][]byte, len(messages))
+	for i, message := range messages {
+		records[i] = []byte(fmt.Sprintf(`{"level":%q,"app_name":"billing","time":"2026-01-02T03:04:05Z","message":%q,"count":%d}`+"\n",
+			level, message, i))
+	}
+
+	return records
+}
+
+func newTestFluentWriter(t *testing.T, address string, ack bool, sharedKey, username, password string) *FluentWriter {
+	t.Helper()
+
+	fluentWriter, err := newFluentWriter(address, ack, sharedKey, username, password, time.Second, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("newFluentWriter: %v", err)
+	}
+
+	t.Cleanup(func() { fluentWriter.Close() })
+
+	return fluentWriter
+}
+
+func TestFluentForwardWithAck(t *testing.T) {
+	forwards := make(chan *fluentTestForward, 2)
+
+	address, served := fluentTestServer(t, func(conn net.Conn, reader *bufio.Reader) error {
+		for i := 0; i < 2; i++ {
+			forward, err := readFluentTestForward(reader)
+			if err != nil {
+				return err
+			}
+
+			forwards <- forward
+
+			chunk, _ := forward.option["chunk"].(string)
+
+			_, err = conn.Write(appendMsgpack(nil, map[string]any{"ack": chunk}))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	fluentWriter := newTestFluentWriter(t, address, true, "", "", "")
+
+	records := append(fluentTestRecords("info", "started", "ready"), fluentTestRecords("error", "failed")...)
+
+	err := fluentWriter.forward(records)
+	if err != nil {
+		t.Fatalf("forward: %v", err)
+	}
+
+	if err := <-served; err != nil {
+		t.Fatalf("server: %v", err)
+	}
+
+	for _, want := range []struct {
+		tag      string
+		messages string
+	}{
+		{"billing.info", "started ready"},
+		{"billing.error", "failed"},
+	} {
+		forward := <-forwards
+
+		if forward.tag != want.tag {
+			t.Errorf("tag = %q, want %q", forward.tag, want.tag)
+		}
+
+		var messages []string
+		for _, record := range forward.records {
+			if _, ok := record[fieldTime]; ok {
+				t.Errorf("record %v keeps its time field, want it sent as the EventTime", record)
+			}
+
+			message, _ := record[fieldMessage].(string)
+			messages = append(messages, message)
+		}
+
+		if got := strings.Join(messages, " "); got != want.messages {
+			t.Errorf("%s messages = %q, want %q", want.tag, got, want.messages)
+		}
+
+		if size := forward.option["size"]; size != int64(len(forward.records)) {
+			t.Errorf("%s size option = %v, want %d", want.tag, size, len(forward.records))
+		}
+
+		if chunk, _ := forward.option["chunk"].(string); len(chunk) != 24 {
+			t.Errorf("%s chunk option = %q, want a base64 chunk id", want.tag, chunk)
+		}
+	}
+}
+
+func TestFluentRejectsWrongAck(t *testing.T) {
+	address, _ := fluentTestServer(t, func(conn net.Conn, reader *bufio.Reader) error {
+		_, err := readFluentTestForward(reader)
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.Write(appendMsgpack(nil, map[string]any{"ack": "another chunk"}))
+
+		return err
+	})
+
+	fluentWriter := newTestFluentWriter(t, address, true, "", "", "")
+
+	message, chunk, err := fluentWriter.buildMessage("billing.info", nil, 0)
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+
+	err = fluentWriter.send(message, chunk)
+	if err == nil || !strings.Contains(err.Error(), "unexpected acknowledgement") {
+		t.Errorf("send error = %v, want the acknowledgement rejected", err)
+	}
+
+	if fluentWriter.conn != nil {
+		t.Error("connection was kept after the failed acknowledgement")
+	}
+}
+
+const (
+	fluentTestNonce    = "server-nonce"
+	fluentTestAuthSalt = "server-auth-salt"
+)
+
+// readFluentTestPing sends a HELO message with a nonce and an authentication salt and returns the
+// PING message of the client.
+func readFluentTestPing(conn net.Conn, reader *bufio.Reader) ([]any, error) {
+	helo := appendMsgpack(nil, []any{"HELO", map[string]any{"nonce": fluentTestNonce, "auth": fluentTestAuthSalt, "keepalive": true}})
+
+	_, err := conn.Write(helo)
+	if err != nil {
+		return nil, err
+	}
+
+	ping, err := readMsgpack(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	pingArray, _ := ping.([]any)
+	if len(pingArray) != 6 || pingArray[0] != "PING" {
+		return nil, fmt.Errorf("message %v is not a PING message", ping)
+	}
+
+	return pingArray, nil
+}
+
+// writeFluentTestPong answers ping with a PONG message whose digest uses sharedKey.
+func writeFluentTestPong(conn net.Conn, ping []any, authResult bool, sharedKey string) error {
+	sharedKeySalt, _ := ping[2].(string)
+
+	pong := appendMsgpack(nil, []any{"PONG", authResult, "access denied", "collector",
+		fluentDigest(sharedKeySalt, "collector", fluentTestNonce, sharedKey)})
+
+	_, err := conn.Write(pong)
+
+	return err
+}
+
+func TestFluentHandshake(t *testing.T) {
+	forwards := make(chan *fluentTestForward, 1)
+
+	address, served := fluentTestServer(t, func(conn net.Conn, reader *bufio.Reader) error {
+		ping, err := readFluentTestPing(conn, reader)
+		if err != nil {
+			return err
+		}
+
+		hostname, _ := ping[1].(string)
+		sharedKeySalt, _ := ping[2].(string)
+
+		if ping[3] != fluentDigest(sharedKeySalt, hostname, fluentTestNonce, "shared-key") {
+			return fmt.Errorf("PING shared key digest %v is wrong", ping[3])
+		}
+
+		if ping[4] != "fluent" || ping[5] != fluentDigest(fluentTestAuthSalt, "fluent", "secret") {
+			return fmt.Errorf("PING credentials %v, %v are wrong", ping[4], ping[5])
+		}
+
+		err = writeFluentTestPong(conn, ping, true, "shared-key")
+		if err != nil {
+			return err
+		}
+
+		forward, err := readFluentTestForward(reader)
+		if err != nil {
+			return err
+		}
+
+		forwards <- forward
+
+		return nil
+	})
+
+	fluentWriter := newTestFluentWriter(t, address, false, "shared-key", "fluent", "secret")
+
+	err := fluentWriter.forward(fluentTestRecords("warn", "slow"))
+	if err != nil {
+		t.Fatalf("forward: %v", err)
+	}
+
+	if err := <-served; err != nil {
+		t.Fatalf("server: %v", err)
+	}
+
+	forward := <-forwards
+	if forward.tag != "billing.warn" || len(forward.records) != 1 {
+		t.Errorf("forward = %+v, want the warn record", forward)
+	}
+
+	if _, ok := forward.option["chunk"]; ok {
+		t.Errorf("option = %v, want no chunk without acknowledgements", forward.option)
+	}
+}
+
+func TestFluentHandshakeFailures(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		authResult bool
+		serverKey  string
+		want       string
+	}{
+		{"rejected", false, "shared-key", "authentication failed: access denied"},
+		{"wrong server key", true, "other-key", "server shared key digest mismatch"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			address, _ := fluentTestServer(t, func(conn net.Conn, reader *bufio.Reader) error {
+				ping, err := readFluentTestPing(conn, reader)
+				if err != nil {
+					return err
+				}
+
+				return writeFluentTestPong(conn, ping, test.authResult, test.serverKey)
+			})
+
+			fluentWriter := newTestFluentWriter(t, address, false, "shared-key", "fluent", "secret")
+
+			err := fluentWriter.connect()
+			if err == nil || !strings.Contains(err.Error(), "handshake") || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("connect error = %v, want the handshake to fail with %q", err, test.want)
+			}
+		})
+	}
+}
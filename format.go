@@ -0,0 +1,124 @@
+package tlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/json-iterator/go"
+)
+
+// newFormatWriter wraps out with the encoder for format. JSON and unrecognized format names write
+// the records produced by zerolog unchanged unless fields renames keys. Formats other than ECS do
+// not report the dynamic type and stack trace of errors, so those fields are removed.
+func newFormatWriter(format string, out io.Writer, fields *fieldConfig) io.Writer {
+	switch strings.ToUpper(format) {
+	case LogFormatConsole:
+		return withoutErrorDetail(newConsoleWriter(out, fields))
+	case LogFormatLogfmt:
+		return withoutErrorDetail(&logfmtWriter{out: out, fields: fields})
+	case LogFormatEcs:
+		return &ecsWriter{out: out}
+	case LogFormatGcp:
+		return withoutErrorDetail(newGcpWriter(out))
+	default:
+		if fields.renamed() {
+			return withoutErrorDetail(&renameWriter{out: out, fields: fields})
+		}
+
+		return withoutErrorDetail(out)
+	}
+}
+
+// decodeRecord decodes one JSON record written by zerolog. Numbers are kept as json.Number so that
+// encoders can reproduce them without float conversion.
+func decodeRecord(p []byte) (map[string]any, error) {
+	var record map[string]any
+
+	decoder := jsoniter.ConfigCompatibleWithStandardLibrary.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// appendJsonField appends "key":value to buf, preceded by a comma unless buf only holds the
+// opening brace of the object.
+func appendJsonField(buf *bytes.Buffer, key string, value any) error {
+	name, err := jsoniter.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("cannot encode key %q: %w", key, err)
+	}
+
+	data, err := jsoniter.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot encode field %q: %w", key, err)
+	}
+
+	if buf.Len() > 1 {
+		buf.WriteByte(',')
+	}
+
+	buf.Write(name)
+	buf.WriteByte(':')
+	buf.Write(data)
+
+	return nil
+}
+
+// splitCaller splits a caller value written as file:line into its file path and line number.
+func splitCaller(value any) (string, int, bool) {
+	caller, ok := value.(string)
+	if !ok {
+		return "", 0, false
+	}
+
+	index := strings.LastIndexByte(caller, ':')
+	if index <= 0 {
+		return "", 0, false
+	}
+
+	line, err := strconv.Atoi(caller[index+1:])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return caller[:index], line, true
+}
+
+// recordKeys returns the keys of record with the keys listed in priority first, in that order,
+// followed by the remaining keys sorted lexically.
+func recordKeys(record map[string]any, priority []string) []string {
+	keys := make([]string, 0, len(record))
+
+	ordered := make(map[string]bool, len(priority))
+
+	for _, key := range priority {
+		ordered[key] = true
+
+		if _, ok := record[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+
+	var remainKeys []string
+
+	for key := range record {
+		if ordered[key] {
+			continue
+		}
+
+		remainKeys = append(remainKeys, key)
+	}
+
+	sort.Strings(remainKeys)
+
+	return append(keys, remainKeys...)
+}
@@ -0,0 +1,148 @@
+package tlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/choveylee/tcfg"
+)
+
+// Special fields recognized by Google Cloud Logging in structured JSON written to standard output.
+const (
+	gcpFieldSeverity       = "severity"
+	gcpFieldTrace          = "logging.googleapis.com/trace"
+	gcpFieldSpanId         = "logging.googleapis.com/spanId"
+	gcpFieldTraceSampled   = "logging.googleapis.com/trace_sampled"
+	gcpFieldSourceLocation = "logging.googleapis.com/sourceLocation"
+)
+
+// gcpSeverities maps zerolog level names to Cloud Logging LogSeverity names.
+var gcpSeverities = map[string]string{
+	"trace": "DEBUG",
+	"debug": "DEBUG",
+	"info":  "INFO",
+	"warn":  "WARNING",
+	"error": "ERROR",
+	"fatal": "CRITICAL",
+	"panic": "ALERT",
+}
+
+// gcpProjectCheck reports a missing project once, when the first gcpWriter is constructed.
+var gcpProjectCheck sync.Once
+
+// gcpPriorityKeys lists the record keys written first, in order, by the GCP format.
+var gcpPriorityKeys = []string{
+	fieldTime,
+	fieldLevel,
+	fieldMessage,
+	fieldAppName,
+	CtxTraceId,
+	CtxSpanId,
+	CtxTraceSampled,
+	fieldCaller,
+}
+
+// gcpWriter re-encodes JSON records from tlog with the structured logging conventions of Google
+// Cloud Logging, so that container platforms parsing standard output show the correct severity,
+// trace link, and source location.
+type gcpWriter struct {
+	out io.Writer
+
+	// project is the Google Cloud project used to qualify trace identifiers; empty writes them as is.
+	project string
+}
+
+// newGcpWriter constructs a gcpWriter that reads the project identifier through tcfg. Without a
+// project, Cloud Logging cannot link records to their traces, which is reported as an internal
+// error.
+func newGcpWriter(out io.Writer) *gcpWriter {
+	project := tcfg.DefaultString(tcfg.LocalKey(LogGcpProject), "")
+	if project == "" {
+		gcpProjectCheck.Do(func() {
+			reportError("gcp", OpInit, "", fmt.Errorf("%s is not set, so trace identifiers cannot be linked to traces",
+				LogGcpProject))
+		})
+	}
+
+	return &gcpWriter{
+		out: out,
+
+		project: project,
+	}
+}
+
+// Write implements io.Writer. It decodes one JSON record and writes the converted record to out in
+// a single call. Fields without a Cloud Logging counterpart keep their record keys.
+func (w *gcpWriter) Write(p []byte) (int, error) {
+	record, err := decodeRecord(p)
+	if err != nil {
+		return 0, fmt.Errorf("tlog gcp: cannot decode record: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for _, key := range recordKeys(record, gcpPriorityKeys) {
+		value := record[key]
+
+		switch key {
+		case fieldTime:
+			recordTime, ok := parseRecordTime(value)
+			if !ok {
+				continue
+			}
+
+			err = appendJsonField(&buf, "time", recordTime.UTC().Format(time.RFC3339Nano))
+		case fieldLevel:
+			severity, ok := gcpSeverities[fmt.Sprintf("%v", value)]
+			if !ok {
+				severity = "DEFAULT"
+			}
+
+			err = appendJsonField(&buf, gcpFieldSeverity, severity)
+		case CtxTraceId:
+			trace := fmt.Sprintf("%v", value)
+			if w.project != "" {
+				trace = "projects/" + w.project + "/traces/" + trace
+			}
+
+			err = appendJsonField(&buf, gcpFieldTrace, trace)
+		case CtxSpanId:
+			err = appendJsonField(&buf, gcpFieldSpanId, value)
+		case CtxTraceSampled:
+			err = appendJsonField(&buf, gcpFieldTraceSampled, value)
+		case fieldCaller:
+			file, line, ok := splitCaller(value)
+			if !ok {
+				err = appendJsonField(&buf, gcpFieldSourceLocation, map[string]any{"file": value})
+				break
+			}
+
+			// LogEntrySourceLocation.line is an int64, which the JSON mapping encodes as a string.
+			err = appendJsonField(&buf, gcpFieldSourceLocation, map[string]any{
+				"file": file,
+				"line": strconv.Itoa(line),
+			})
+		default:
+			err = appendJsonField(&buf, key, value)
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("tlog gcp: %w", err)
+		}
+	}
+
+	buf.WriteString("}\n")
+
+	_, err = w.out.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,101 @@
+package tlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGcpRecord(t *testing.T) {
+	var buf bytes.Buffer
+
+	gcpWriter := &gcpWriter{out: &buf, project: "billing-prod"}
+
+	record := `{"level":"warn","app_name":"billing","trace_id":"0af7651916cd43dd8448eb211c80319c",` +
+		`"caller":"billing/charge.go:42","order_id":"A-17","time":"2026-01-02T04:04:05+01:00",` +
+		`"message":"card declined"}` + "\n"
+
+	_, err := gcpWriter.Write([]byte(record))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	document := decodeTestDocument(t, buf.Bytes())
+
+	for key, want := range map[string]any{
+		"time":           "2026-01-02T03:04:05Z",
+		gcpFieldSeverity: "WARNING",
+		fieldMessage:     "card declined",
+		fieldAppName:     "billing",
+		gcpFieldTrace:    "projects/billing-prod/traces/0af7651916cd43dd8448eb211c80319c",
+		"order_id":       "A-17",
+	} {
+		if got := document[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+
+	location, _ := document[gcpFieldSourceLocation].(map[string]any)
+	if location["file"] != "billing/charge.go" || location["line"] != "42" {
+		t.Errorf("sourceLocation = %v, want file billing/charge.go and line \"42\"", location)
+	}
+
+	for _, key := range []string{fieldLevel, CtxTraceId, fieldCaller} {
+		if _, ok := document[key]; ok {
+			t.Errorf("record key %q was not mapped", key)
+		}
+	}
+}
+
+func TestGcpReportsMissingProject(t *testing.T) {
+	var buf bytes.Buffer
+
+	gcpWriter := newGcpWriter(&buf)
+	if gcpWriter.project != "" {
+		t.Skipf("%s is set", LogGcpProject)
+	}
+
+	internalErr := lastError("gcp")
+	if internalErr == nil || internalErr.Op != OpInit || !strings.Contains(internalErr.Err.Error(), LogGcpProject) {
+		t.Errorf("last gcp error = %v, want a report of the missing project", internalErr)
+	}
+
+	_, err := gcpWriter.Write([]byte(`{"level":"info","trace_id":"0af7651916cd43dd8448eb211c80319c"}` + "\n"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if got := decodeTestDocument(t, buf.Bytes())[gcpFieldTrace]; got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("trace = %v, want the bare trace identifier", got)
+	}
+}
+
+func TestGcpSpanFields(t *testing.T) {
+	var buf bytes.Buffer
+
+	gcpWriter := &gcpWriter{out: &buf, project: "billing-prod"}
+
+	record := `{"level":"info","trace_id":"0af7651916cd43dd8448eb211c80319c","span_id":"b7ad6b7169203331",` +
+		`"trace_sampled":true,"message":"charged"}` + "\n"
+
+	_, err := gcpWriter.Write([]byte(record))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	document := decodeTestDocument(t, buf.Bytes())
+
+	if got := document[gcpFieldSpanId]; got != "b7ad6b7169203331" {
+		t.Errorf("spanId = %v, want b7ad6b7169203331", got)
+	}
+
+	if got := document[gcpFieldTraceSampled]; got != true {
+		t.Errorf("trace_sampled = %v, want true", got)
+	}
+
+	for _, key := range []string{CtxSpanId, CtxTraceSampled} {
+		if _, ok := document[key]; ok {
+			t.Errorf("record key %q was not mapped", key)
+		}
+	}
+}
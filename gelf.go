@@ -0,0 +1,332 @@
+package tlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// GelfCompressionGzip selects gzip compression of UDP messages.
+	GelfCompressionGzip = "GZIP"
+	// GelfCompressionZlib selects zlib compression of UDP messages.
+	GelfCompressionZlib = "ZLIB"
+	// GelfCompressionNone disables compression of UDP messages.
+	GelfCompressionNone = "NONE"
+
+	// DefaultGelfChunkSize is the default maximum size of one UDP datagram, chosen to fit common
+	// WAN path MTUs. Networks with jumbo frames may use up to 8192 bytes.
+	DefaultGelfChunkSize = 1420
+
+	// gelfVersion is the GELF specification version of the emitted messages.
+	gelfVersion = "1.1"
+
+	// gelfChunkHeaderLen is the size of the header of a chunked UDP datagram: magic bytes,
+	// message id, sequence number, and sequence count.
+	gelfChunkHeaderLen = 12
+	// gelfMaxChunks is the maximum number of chunks of one message accepted by GELF servers.
+	gelfMaxChunks = 128
+)
+
+// gelfChunkMagic starts every chunked UDP datagram.
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// GelfWriter implements zerolog.LevelWriter by sending records to a Graylog server in the GELF 1.1
+// format, either as compressed and, when necessary, chunked UDP datagrams or as null-delimited
+// messages over TCP. A failed connection is re-established on a later write, with exponential
+// backoff between attempts; records written while waiting are dropped.
+type GelfWriter struct {
+	// network is udp or tcp.
+	network string
+	address string
+
+	// compression is GelfCompressionGzip, GelfCompressionZlib, or GelfCompressionNone; it only
+	// applies to UDP, as GELF over TCP does not support compression.
+	compression string
+
+	// chunkSize is the maximum size of one UDP datagram.
+	chunkSize int
+
+	conn reconnectingConn
+
+	sync.Mutex
+}
+
+// newGelfWriter constructs a GelfWriter. The connection is established on the first write. An
+// empty network selects UDP; a chunkSize below the chunk header size falls back to
+// DefaultGelfChunkSize.
+func newGelfWriter(network, address, compression string, chunkSize int) (*GelfWriter, error) {
+	network = strings.ToLower(network)
+	if network == "" {
+		network = "udp"
+	}
+
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("tlog gelf: invalid network %q: must be udp or tcp", network)
+	}
+
+	if address == "" {
+		return nil, errors.New("tlog gelf: address is empty")
+	}
+
+	compression = strings.ToUpper(compression)
+
+	switch compression {
+	case GelfCompressionZlib, GelfCompressionNone:
+	default:
+		compression = GelfCompressionGzip
+	}
+
+	if chunkSize <= gelfChunkHeaderLen {
+		chunkSize = DefaultGelfChunkSize
+	}
+
+	gelfWriter := &GelfWriter{
+		network: network,
+		address: address,
+
+		compression: compression,
+
+		chunkSize: chunkSize,
+	}
+
+	gelfWriter.conn = newReconnectingConn(network, address)
+
+	return gelfWriter, nil
+}
+
+// Write implements io.Writer for records whose level is only known from their level field.
+func (w *GelfWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter. It converts one JSON record to a GELF message and
+// sends it, reconnecting once when the existing connection fails.
+func (w *GelfWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	record, err := decodeRecord(p)
+	if err != nil {
+		return 0, fmt.Errorf("tlog gelf: cannot decode record: %w", err)
+	}
+
+	if level == zerolog.NoLevel {
+		if levelName, ok := record[fieldLevel].(string); ok {
+			level, _ = zerolog.ParseLevel(levelName)
+		}
+	}
+
+	message, err := buildGelfMessage(level, record)
+	if err != nil {
+		return 0, fmt.Errorf("tlog gelf: cannot encode record: %w", err)
+	}
+
+	var datagrams [][]byte
+
+	if w.network == "udp" {
+		datagrams, err = w.buildDatagrams(message)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		datagrams = [][]byte{append(message, 0)}
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	err = w.conn.send(func(conn net.Conn) error {
+		return w.writeConn(conn, datagrams)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("tlog gelf: %w", err)
+	}
+
+	return len(p), nil
+}
+
+// Close closes the connection to the GELF server.
+func (w *GelfWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.conn.Close()
+}
+
+// writeConn writes packets to conn.
+func (w *GelfWriter) writeConn(conn net.Conn, packets [][]byte) error {
+	if w.network == "tcp" {
+		_ = conn.SetWriteDeadline(time.Now().Add(connWriteTimeout))
+	}
+
+	for _, packet := range packets {
+		_, err := conn.Write(packet)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildDatagrams compresses message and splits it into chunks when it does not fit into one
+// datagram.
+func (w *GelfWriter) buildDatagrams(message []byte) ([][]byte, error) {
+	var buf bytes.Buffer
+
+	switch w.compression {
+	case GelfCompressionGzip:
+		gzipWriter := gzip.NewWriter(&buf)
+		_, _ = gzipWriter.Write(message)
+		_ = gzipWriter.Close()
+
+		message = buf.Bytes()
+	case GelfCompressionZlib:
+		zlibWriter := zlib.NewWriter(&buf)
+		_, _ = zlibWriter.Write(message)
+		_ = zlibWriter.Close()
+
+		message = buf.Bytes()
+	}
+
+	if len(message) <= w.chunkSize {
+		return [][]byte{message}, nil
+	}
+
+	dataSize := w.chunkSize - gelfChunkHeaderLen
+
+	chunkCount := (len(message) + dataSize - 1) / dataSize
+	if chunkCount > gelfMaxChunks {
+		return nil, fmt.Errorf("tlog gelf: message of %d bytes exceeds %d chunks", len(message), gelfMaxChunks)
+	}
+
+	messageId := rand.Uint64()
+
+	chunks := make([][]byte, 0, chunkCount)
+
+	for i := 0; i < chunkCount; i++ {
+		data := message[i*dataSize : min((i+1)*dataSize, len(message))]
+
+		chunk := make([]byte, 0, gelfChunkHeaderLen+len(data))
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = binary.BigEndian.AppendUint64(chunk, messageId)
+		chunk = append(chunk, byte(i), byte(chunkCount))
+		chunk = append(chunk, data...)
+
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// buildGelfMessage converts record to a GELF 1.1 message. The message becomes short_message, the
+// detail becomes full_message, app_name becomes host and _app, the level becomes a syslog
+// severity, the caller becomes _file and _line, and all other fields become additional fields
+// prefixed with an underscore.
+func buildGelfMessage(level zerolog.Level, record map[string]any) ([]byte, error) {
+	message := map[string]any{
+		"version": gelfVersion,
+		"level":   syslogSeverity(level),
+	}
+
+	recordTime, ok := parseRecordTime(record[fieldTime])
+	if !ok {
+		recordTime = time.Now()
+	}
+
+	// Seconds since the epoch with millisecond precision.
+	message["timestamp"] = json.Number(strconv.FormatFloat(float64(recordTime.UnixMilli())/1000, 'f', 3, 64))
+
+	shortMessage, _ := record[fieldMessage].(string)
+	if shortMessage == "" {
+		// GELF requires a non-empty short_message.
+		shortMessage = "-"
+	}
+
+	message["short_message"] = shortMessage
+
+	host, _ := record[fieldAppName].(string)
+	if host == "" {
+		host = "-"
+	}
+
+	message["host"] = host
+
+	for key, value := range record {
+		switch key {
+		case fieldTime, fieldLevel, fieldMessage:
+			continue
+		case fieldAppName:
+			message["_app"] = value
+		case fieldDetail:
+			message["full_message"] = gelfValue(value)
+		case fieldCaller:
+			file, line, ok := splitCaller(value)
+			if !ok {
+				message["_file"] = gelfValue(value)
+				break
+			}
+
+			message["_file"] = file
+			message["_line"] = line
+		default:
+			message[gelfFieldName(key)] = gelfValue(value)
+		}
+	}
+
+	return jsoniter.Marshal(message)
+}
+
+// gelfFieldName converts a record key to an additional field name matching ^_[\w\.\-]*$. The
+// reserved name _id is written as _id_.
+func gelfFieldName(key string) string {
+	var buf strings.Builder
+
+	buf.WriteByte('_')
+
+	for _, r := range key {
+		switch {
+		case r == '_', r == '.', r == '-', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			buf.WriteRune(r)
+		default:
+			buf.WriteByte('_')
+		}
+	}
+
+	if buf.String() == "_id" {
+		return "_id_"
+	}
+
+	return buf.String()
+}
+
+// gelfValue converts a decoded JSON value to a GELF field value, which must be a string or a
+// number. Other values are written as their JSON encoding.
+func gelfValue(value any) any {
+	switch val := value.(type) {
+	case string, json.Number:
+		return val
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		data, err := jsoniter.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+
+		return string(data)
+	}
+}
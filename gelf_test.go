@@ -0,0 +1,204 @@
+package tlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const gelfTestRecord = `{"level":"error","app_name":"billing","time":"2026-01-02T03:04:05.250Z","message":"card declined",` +
+	`"caller":"billing/charge.go:42","id":"A-17","customer email":"bob@example.com"}` + "\n"
+
+// listenGelfUdp returns a UDP socket for the GELF writer to send to.
+func listenGelfUdp(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	return conn
+}
+
+// readDatagram reads one datagram from conn.
+func readDatagram(t *testing.T, conn net.PacketConn) []byte {
+	t.Helper()
+
+	buf := make([]byte, 65536)
+
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+
+	return buf[:n]
+}
+
+func checkGelfMessage(t *testing.T, data []byte) {
+	t.Helper()
+
+	message := decodeTestDocument(t, data)
+
+	// ERROR is syslog severity 3.
+	for key, want := range map[string]any{
+		"version":         "1.1",
+		"level":           json.Number("3"),
+		"host":            "billing",
+		"short_message":   "card declined",
+		"timestamp":       json.Number("1767323045.250"),
+		"_app":            "billing",
+		"_file":           "billing/charge.go",
+		"_line":           json.Number("42"),
+		"_id_":            "A-17",
+		"_customer_email": "bob@example.com",
+	} {
+		if message[key] != want {
+			t.Errorf("%s = %v, want %v", key, message[key], want)
+		}
+	}
+}
+
+func TestGelfUdpGzip(t *testing.T) {
+	conn := listenGelfUdp(t)
+
+	gelfWriter, err := newGelfWriter("udp", conn.LocalAddr().String(), "", 0)
+	if err != nil {
+		t.Fatalf("newGelfWriter: %v", err)
+	}
+
+	defer gelfWriter.Close()
+
+	_, err = gelfWriter.WriteLevel(zerolog.ErrorLevel, []byte(gelfTestRecord))
+	if err != nil {
+		t.Fatalf("WriteLevel: %v", err)
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(readDatagram(t, conn)))
+	if err != nil {
+		t.Fatalf("datagram is not gzip compressed: %v", err)
+	}
+
+	data, err := io.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatalf("cannot decompress datagram: %v", err)
+	}
+
+	checkGelfMessage(t, data)
+}
+
+func TestGelfUdpChunking(t *testing.T) {
+	conn := listenGelfUdp(t)
+
+	gelfWriter, err := newGelfWriter("udp", conn.LocalAddr().String(), GelfCompressionNone, 64)
+	if err != nil {
+		t.Fatalf("newGelfWriter: %v", err)
+	}
+
+	defer gelfWriter.Close()
+
+	_, err = gelfWriter.WriteLevel(zerolog.ErrorLevel, []byte(gelfTestRecord))
+	if err != nil {
+		t.Fatalf("WriteLevel: %v", err)
+	}
+
+	var (
+		message   []byte
+		messageId uint64
+		count     int
+	)
+
+	for i := 0; i == 0 || i < count; i++ {
+		chunk := readDatagram(t, conn)
+
+		if len(chunk) > 64 || len(chunk) <= gelfChunkHeaderLen || !bytes.Equal(chunk[:2], gelfChunkMagic) {
+			t.Fatalf("chunk %d = %x, want a chunk header and data within 64 bytes", i, chunk)
+		}
+
+		id := binary.BigEndian.Uint64(chunk[2:10])
+		if i == 0 {
+			messageId = id
+			count = int(chunk[11])
+		}
+
+		// UDP on the loopback interface keeps the order of the chunks.
+		if id != messageId || int(chunk[10]) != i || int(chunk[11]) != count {
+			t.Fatalf("chunk %d has id %x, sequence %d of %d, want id %x, sequence %d of %d",
+				i, id, chunk[10], chunk[11], messageId, i, count)
+		}
+
+		message = append(message, chunk[gelfChunkHeaderLen:]...)
+	}
+
+	if count < 2 {
+		t.Errorf("message was sent in %d chunks, want several", count)
+	}
+
+	checkGelfMessage(t, message)
+}
+
+func TestGelfChunkLimit(t *testing.T) {
+	gelfWriter, err := newGelfWriter("udp", "127.0.0.1:12201", GelfCompressionNone, gelfChunkHeaderLen+1)
+	if err != nil {
+		t.Fatalf("newGelfWriter: %v", err)
+	}
+
+	chunks, err := gelfWriter.buildDatagrams(bytes.Repeat([]byte("a"), gelfMaxChunks))
+	if err != nil || len(chunks) != gelfMaxChunks {
+		t.Errorf("buildDatagrams of %d bytes = %d chunks, %v, want %d chunks", gelfMaxChunks, len(chunks), err, gelfMaxChunks)
+	}
+
+	_, err = gelfWriter.buildDatagrams(bytes.Repeat([]byte("a"), gelfMaxChunks+1))
+	if err == nil || !strings.Contains(err.Error(), "exceeds 128 chunks") {
+		t.Errorf("buildDatagrams of %d bytes error = %v, want the chunk limit", gelfMaxChunks+1, err)
+	}
+}
+
+func TestGelfTcpNullDelimited(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on tcp: %v", err)
+	}
+
+	defer listener.Close()
+
+	received := acceptOne(t, listener)
+
+	// Compression does not apply to TCP.
+	gelfWriter, err := newGelfWriter("tcp", listener.Addr().String(), GelfCompressionGzip, 0)
+	if err != nil {
+		t.Fatalf("newGelfWriter: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = gelfWriter.WriteLevel(zerolog.ErrorLevel, []byte(gelfTestRecord))
+		if err != nil {
+			t.Fatalf("WriteLevel: %v", err)
+		}
+	}
+
+	gelfWriter.Close()
+
+	data := <-received
+
+	messages := strings.Split(data, "\x00")
+	if len(messages) != 3 || messages[2] != "" {
+		t.Fatalf("received %q, want two null-terminated messages", data)
+	}
+
+	for _, message := range messages[:2] {
+		checkGelfMessage(t, []byte(message))
+	}
+}
@@ -0,0 +1,463 @@
+package tlog
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/choveylee/tcfg"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultSinkQueueSize is the default number of records queued for one isolated sink.
+	DefaultSinkQueueSize = 1024
+	// DefaultSinkTimeout is the default time one write to an isolated sink may take before it
+	// counts as failed.
+	DefaultSinkTimeout = 5 * time.Second
+
+	// SinkStateClosed reports a sink that receives records.
+	SinkStateClosed = "closed"
+	// SinkStateOpen reports a sink disabled by its circuit breaker after repeated failures.
+	SinkStateOpen = "open"
+	// SinkStateHalfOpen reports a sink whose circuit breaker lets a trial record through.
+	SinkStateHalfOpen = "half-open"
+)
+
+// errSinkTimeout is returned for a write that did not complete within the sink timeout.
+var errSinkTimeout = errors.New("write timed out")
+
+// errSinkBusy is returned for records that reach a sink whose previous write has timed out and
+// is still blocked.
+var errSinkBusy = errors.New("previous write is still blocked")
+
+// SinkHealth is a snapshot of the state of one sink returned by [Health].
+type SinkHealth struct {
+	// Name identifies the sink, for example stdout, syslog, or otlp.
+	Name string
+
+	// State is the state of the circuit breaker of an isolated sink: [SinkStateClosed],
+	// [SinkStateOpen], or [SinkStateHalfOpen]. Sinks without a breaker report SinkStateClosed.
+	State string
+
+	// Queued is the number of records waiting to be written.
+	Queued int
+
+	// Written counts the records written successfully, Dropped the records discarded because
+	// the queue was full or the breaker was open, and Failures the writes that failed or timed out.
+	Written  uint64
+	Dropped  uint64
+	Failures uint64
+
+	// LastError is the last internal error reported for the sink; nil when there is none.
+	LastError *InternalError
+}
+
+// healthReporter is implemented by the sinks reported by Health.
+type healthReporter interface {
+	health() SinkHealth
+}
+
+// isolationConfig holds the settings of isolated sinks.
+type isolationConfig struct {
+	queueSize int
+	timeout   time.Duration
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+// loadIsolationConfig reads the isolation settings from the LOG_SINK_* configuration keys. It
+// returns nil when sink isolation is disabled.
+func loadIsolationConfig() *isolationConfig {
+	if !tcfg.DefaultBool(tcfg.LocalKey(LogSinkIsolation), false) {
+		return nil
+	}
+
+	return &isolationConfig{
+		queueSize: tcfg.DefaultInt(tcfg.LocalKey(LogSinkQueueSize), DefaultSinkQueueSize),
+		timeout:   tcfg.DefaultDuration(tcfg.LocalKey(LogSinkTimeout), DefaultSinkTimeout),
+
+		breakerThreshold: tcfg.DefaultInt(tcfg.LocalKey(LogSinkBreakerThreshold), DefaultBreakerThreshold),
+		breakerCooldown:  tcfg.DefaultDuration(tcfg.LocalKey(LogSinkBreakerCooldown), DefaultBreakerCooldown),
+	}
+}
+
+// isolate wraps out in an isolatedWriter named name, or returns out unchanged when config is nil.
+func isolate(config *isolationConfig, name string, out io.Writer) io.Writer {
+	if config == nil {
+		return out
+	}
+
+	return newIsolatedWriter(name, out, config)
+}
+
+// isolatedRecord is one record queued for an isolated sink.
+type isolatedRecord struct {
+	p []byte
+
+	// level is the level of the record; leveled is false for records written through Write.
+	level   zerolog.Level
+	leveled bool
+
+	// written is closed once the record has been handled; nil when nobody waits for it.
+	written chan struct{}
+}
+
+// isolatedWriter decouples a sink from the goroutines that log. Records are queued and written
+// by a worker goroutine, so that a sink that blocks, for example on a stalled socket, delays
+// neither the caller nor the other sinks. Records written while the queue is full are dropped.
+//
+// A write that takes longer than the timeout counts as failed and the records that follow it are
+// failed as well until it returns. After repeated failures a circuit breaker disables the sink
+// for its cooldown period and its records are dropped. FATAL and PANIC records are waited for,
+// because the process ends right after they have been logged.
+type isolatedWriter struct {
+	name string
+
+	out io.Writer
+
+	timeout time.Duration
+	breaker *circuitBreaker
+
+	queue chan isolatedRecord
+
+	// calls passes records to the goroutine that writes to out, which answers on results.
+	calls   chan isolatedRecord
+	results chan error
+
+	// blocked is set by the worker while a timed out write is still running.
+	blocked bool
+
+	written  atomic.Uint64
+	dropped  atomic.Uint64
+	failures atomic.Uint64
+
+	// callDone is closed when the writing goroutine has returned.
+	callDone chan struct{}
+
+	done      chan struct{}
+	flushDone chan struct{}
+
+	// closeLock is held for reading while a record is queued and for writing while done is
+	// closed, so that no record is queued after the worker has drained the queue.
+	closeLock sync.RWMutex
+	closeOnce sync.Once
+}
+
+// newIsolatedWriter constructs an isolatedWriter for out, starts its goroutines, and registers it
+// with [Health].
+func newIsolatedWriter(name string, out io.Writer, config *isolationConfig) *isolatedWriter {
+	queueSize := config.queueSize
+	if queueSize <= 0 {
+		queueSize = DefaultSinkQueueSize
+	}
+
+	timeout := config.timeout
+	if timeout <= 0 {
+		timeout = DefaultSinkTimeout
+	}
+
+	isolatedWriter := &isolatedWriter{
+		name: name,
+
+		out: out,
+
+		timeout: timeout,
+		breaker: newCircuitBreaker(config.breakerThreshold, config.breakerCooldown),
+
+		queue: make(chan isolatedRecord, queueSize),
+
+		calls:   make(chan isolatedRecord),
+		results: make(chan error, 1),
+
+		callDone: make(chan struct{}),
+
+		done:      make(chan struct{}),
+		flushDone: make(chan struct{}),
+	}
+
+	go isolatedWriter.call()
+	go isolatedWriter.run()
+
+	registerSink(isolatedWriter)
+
+	return isolatedWriter
+}
+
+// Write implements io.Writer.
+func (w *isolatedWriter) Write(p []byte) (int, error) {
+	return w.enqueue(isolatedRecord{p: p})
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *isolatedWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	return w.enqueue(isolatedRecord{p: p, level: level, leveled: true})
+}
+
+// enqueue queues a copy of the record, because zerolog reuses the buffer after Write returns. It
+// waits for FATAL and PANIC records to be written, for at most the sink timeout.
+func (w *isolatedWriter) enqueue(record isolatedRecord) (int, error) {
+	n := len(record.p)
+
+	record.p = append([]byte(nil), record.p...)
+
+	final := record.leveled && record.level >= zerolog.FatalLevel && record.level != zerolog.NoLevel
+	if final {
+		record.written = make(chan struct{})
+	}
+
+	w.closeLock.RLock()
+
+	select {
+	case <-w.done:
+		w.closeLock.RUnlock()
+
+		return 0, errors.New("tlog " + w.name + ": writer is closed")
+	default:
+	}
+
+	select {
+	case w.queue <- record:
+		w.closeLock.RUnlock()
+	default:
+		w.closeLock.RUnlock()
+
+		w.dropped.Add(1)
+
+		reportError(w.name, OpWrite, "", errQueueFull)
+
+		return n, nil
+	}
+
+	if final {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+
+		select {
+		case <-record.written:
+		case <-timer.C:
+		}
+	}
+
+	return n, nil
+}
+
+// Close stops the worker after writing the records that are still queued and closes the sink.
+// When a timed out write is still blocked, the sink is closed once that write returns.
+func (w *isolatedWriter) Close() error {
+	w.closeOnce.Do(func() {
+		w.closeLock.Lock()
+		close(w.done)
+		w.closeLock.Unlock()
+	})
+
+	<-w.flushDone
+
+	unregisterSink(w)
+
+	closer, ok := w.out.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	if w.blocked {
+		go func() {
+			<-w.callDone
+
+			_ = closer.Close()
+		}()
+
+		return nil
+	}
+
+	<-w.callDone
+
+	return closer.Close()
+}
+
+// run writes queued records until Close is called.
+func (w *isolatedWriter) run() {
+	defer close(w.flushDone)
+
+	for {
+		select {
+		case record := <-w.queue:
+			w.handle(record)
+		case <-w.done:
+			for {
+				select {
+				case record := <-w.queue:
+					w.handle(record)
+				default:
+					close(w.calls)
+
+					return
+				}
+			}
+		}
+	}
+}
+
+// handle writes one record unless the breaker is open, and reports changes of the breaker state.
+func (w *isolatedWriter) handle(record isolatedRecord) {
+	if record.written != nil {
+		defer close(record.written)
+	}
+
+	before := w.breaker.current()
+
+	err := w.breaker.call(func() error {
+		return w.write(record)
+	})
+
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		w.dropped.Add(1)
+	case err != nil:
+		w.failures.Add(1)
+		w.dropped.Add(1)
+
+		reportError(w.name, OpWrite, "", err)
+
+		if before != breakerOpen && w.breaker.current() == breakerOpen {
+			reportError(w.name, OpDisable, "", err)
+		}
+	default:
+		w.written.Add(1)
+
+		if before != breakerClosed {
+			reportError(w.name, OpRecover, "", errSinkRecovered)
+		}
+	}
+}
+
+// write passes record to the writing goroutine and waits at most the sink timeout for the result.
+func (w *isolatedWriter) write(record isolatedRecord) error {
+	if w.blocked {
+		select {
+		case <-w.results:
+			w.blocked = false
+		default:
+			return errSinkBusy
+		}
+	}
+
+	w.calls <- record
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-w.results:
+		return err
+	case <-timer.C:
+		w.blocked = true
+		return errSinkTimeout
+	}
+}
+
+// call writes the records passed by the worker to the sink. It runs in its own goroutine, so that
+// the worker can give up on a write that blocks.
+func (w *isolatedWriter) call() {
+	defer close(w.callDone)
+
+	for record := range w.calls {
+		var err error
+
+		if levelWriter, ok := w.out.(zerolog.LevelWriter); ok && record.leveled {
+			_, err = levelWriter.WriteLevel(record.level, record.p)
+		} else {
+			_, err = w.out.Write(record.p)
+		}
+
+		w.results <- err
+	}
+}
+
+// reportsErrorDetail implements errorDetailReporter for the writer it isolates.
+func (w *isolatedWriter) reportsErrorDetail() bool {
+	return reportsErrorDetail(w.out)
+}
+
+// health returns a snapshot of the state of the sink.
+func (w *isolatedWriter) health() SinkHealth {
+	return SinkHealth{
+		Name: w.name,
+
+		State: w.breaker.current().String(),
+
+		Queued: len(w.queue),
+
+		Written:  w.written.Load(),
+		Dropped:  w.dropped.Load(),
+		Failures: w.failures.Load(),
+	}
+}
+
+// sinks holds the sinks reported by Health, in the order they were constructed.
+var sinks struct {
+	list []healthReporter
+
+	sync.Mutex
+}
+
+// registerSink adds w to the sinks reported by Health.
+func registerSink(w healthReporter) {
+	sinks.Lock()
+	defer sinks.Unlock()
+
+	sinks.list = append(sinks.list, w)
+}
+
+// unregisterSink removes w from the sinks reported by Health.
+func unregisterSink(w healthReporter) {
+	sinks.Lock()
+	defer sinks.Unlock()
+
+	for i, sink := range sinks.list {
+		if sink == w {
+			sinks.list = append(sinks.list[:i], sinks.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// Health returns a snapshot of the state of the sinks of the default logger: the isolated sinks
+// enabled with [LogSinkIsolation], the batching remote sinks, and any other sink for which an
+// internal error has been reported, each with its last error.
+func Health() []SinkHealth {
+	sinks.Lock()
+
+	health := make([]SinkHealth, 0, len(sinks.list))
+	for _, sink := range sinks.list {
+		health = append(health, sink.health())
+	}
+
+	sinks.Unlock()
+
+	reported := make(map[string]bool, len(health))
+
+	for i := range health {
+		health[i].LastError = lastError(health[i].Name)
+
+		reported[health[i].Name] = true
+	}
+
+	for _, name := range erroredSinks() {
+		if reported[name] {
+			continue
+		}
+
+		health = append(health, SinkHealth{
+			Name:  name,
+			State: SinkStateClosed,
+
+			LastError: lastError(name),
+		})
+	}
+
+	return health
+}
@@ -0,0 +1,139 @@
+package tlog
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// countingSink counts the records written to it. While gate is not nil, writes wait for it to be
+// closed.
+type countingSink struct {
+	gate chan struct{}
+
+	records atomic.Int64
+	closed  atomic.Bool
+}
+
+func (s *countingSink) Write(p []byte) (int, error) {
+	if s.gate != nil {
+		<-s.gate
+	}
+
+	s.records.Add(1)
+
+	return len(p), nil
+}
+
+func (s *countingSink) Close() error {
+	s.closed.Store(true)
+
+	return nil
+}
+
+func newTestIsolatedWriter(out *countingSink, timeout time.Duration) *isolatedWriter {
+	return newIsolatedWriter("test", out, &isolationConfig{queueSize: 1 << 16, timeout: timeout})
+}
+
+func TestIsolatedWriterKeepsRecordsQueuedDuringClose(t *testing.T) {
+	sink := &countingSink{}
+
+	isolatedWriter := newTestIsolatedWriter(sink, time.Second)
+
+	// Stand in for an enqueue that has seen the writer open and is about to queue its record.
+	isolatedWriter.closeLock.RLock()
+
+	closed := make(chan struct{})
+
+	go func() {
+		defer close(closed)
+
+		isolatedWriter.Close()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+
+	select {
+	case <-isolatedWriter.done:
+		t.Fatal("Close stopped the worker while a record was being queued")
+	default:
+	}
+
+	isolatedWriter.queue <- isolatedRecord{p: []byte("late\n")}
+	isolatedWriter.closeLock.RUnlock()
+
+	<-closed
+
+	if got := sink.records.Load(); got != 1 {
+		t.Errorf("sink received %d records, want the record queued during Close", got)
+	}
+
+	_, err := isolatedWriter.Write([]byte("after\n"))
+	if err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
+
+func TestIsolatedWriterFatalRecordIsWrittenBeforeClose(t *testing.T) {
+	sink := &countingSink{}
+
+	isolatedWriter := newTestIsolatedWriter(sink, 5*time.Second)
+
+	start := time.Now()
+
+	_, err := isolatedWriter.WriteLevel(zerolog.FatalLevel, []byte("fatal\n"))
+	if err != nil {
+		t.Fatalf("WriteLevel: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("FATAL record took %v, want it written without waiting for the timeout", elapsed)
+	}
+
+	if got := sink.records.Load(); got != 1 {
+		t.Errorf("sink received %d records before WriteLevel returned, want 1", got)
+	}
+
+	isolatedWriter.Close()
+}
+
+func TestIsolatedWriterClosesBlockedSinkWhenWriteReturns(t *testing.T) {
+	sink := &countingSink{gate: make(chan struct{})}
+
+	isolatedWriter := newTestIsolatedWriter(sink, 20*time.Millisecond)
+
+	_, _ = isolatedWriter.Write([]byte("stalled\n"))
+	_, _ = isolatedWriter.Write([]byte("busy\n"))
+
+	err := isolatedWriter.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if sink.closed.Load() {
+		t.Fatal("sink was closed while a write was blocked")
+	}
+
+	if health := isolatedWriter.health(); health.Failures != 2 {
+		t.Errorf("failures = %d, want 2 for the timed out and the busy write", health.Failures)
+	}
+
+	close(sink.gate)
+
+	select {
+	case <-isolatedWriter.callDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writing goroutine did not return after the blocked write")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !sink.closed.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if !sink.closed.Load() {
+		t.Error("sink was not closed after the blocked write returned")
+	}
+}
@@ -0,0 +1,210 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/json-iterator/go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultJournaldSocket is the path of the systemd-journald native protocol socket.
+	DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+	// journaldMaxNameLen is the maximum length of a journal field name.
+	journaldMaxNameLen = 64
+)
+
+// JournaldWriter implements zerolog.LevelWriter by sending records to systemd-journald over its
+// native datagram protocol, so that the journal keeps the priority and fields of every record.
+// Entries too large for one datagram are passed through a sealed memory file descriptor where the
+// platform supports it.
+type JournaldWriter struct {
+	// socket is the path of the journald socket.
+	socket string
+
+	conn *net.UnixConn
+
+	sync.Mutex
+}
+
+// newJournaldWriter constructs a JournaldWriter for socket. The connection is established on the
+// first write.
+func newJournaldWriter(socket string) *JournaldWriter {
+	if socket == "" {
+		socket = DefaultJournaldSocket
+	}
+
+	return &JournaldWriter{socket: socket}
+}
+
+// Write implements io.Writer for records whose level is only known from their level field.
+func (w *JournaldWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter. The level becomes PRIORITY, the message becomes
+// MESSAGE, app_name becomes SYSLOG_IDENTIFIER, the caller becomes CODE_FILE and CODE_LINE, and all
+// other fields except the time, which journald records itself, become upper-case journal fields.
+func (w *JournaldWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	record, err := decodeRecord(p)
+	if err != nil {
+		return 0, fmt.Errorf("tlog journald: cannot decode record: %w", err)
+	}
+
+	if level == zerolog.NoLevel {
+		if levelName, ok := record[fieldLevel].(string); ok {
+			level, _ = zerolog.ParseLevel(levelName)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	appendJournaldField(&buf, "PRIORITY", strconv.Itoa(syslogSeverity(level)))
+
+	for _, key := range recordKeys(record, fieldPriorityKeys) {
+		value := record[key]
+
+		switch key {
+		case fieldTime, fieldLevel:
+			continue
+		case fieldMessage:
+			appendJournaldField(&buf, "MESSAGE", journaldValue(value))
+		case fieldAppName:
+			appendJournaldField(&buf, "SYSLOG_IDENTIFIER", journaldValue(value))
+		case fieldCaller:
+			file, line, ok := splitCaller(value)
+			if !ok {
+				appendJournaldField(&buf, "CODE_FILE", journaldValue(value))
+				break
+			}
+
+			appendJournaldField(&buf, "CODE_FILE", file)
+			appendJournaldField(&buf, "CODE_LINE", strconv.Itoa(line))
+		default:
+			appendJournaldField(&buf, journaldName(key), journaldValue(value))
+		}
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	err = w.send(buf.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("tlog journald: cannot send to %q: %w", w.socket, err)
+	}
+
+	return len(p), nil
+}
+
+// Close closes the connection to journald.
+func (w *JournaldWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+
+	return err
+}
+
+// send writes one entry, redialing once when the connection fails and falling back to
+// sendJournaldFd when the entry exceeds the datagram size limit. The caller must hold the lock.
+func (w *JournaldWriter) send(data []byte) error {
+	var err error
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			w.conn, err = net.DialUnix("unixgram", nil, &net.UnixAddr{Name: w.socket, Net: "unixgram"})
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = w.conn.Write(data)
+		if err == nil {
+			return nil
+		}
+
+		if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+			return sendJournaldFd(w.conn, data)
+		}
+
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	return err
+}
+
+// appendJournaldField appends one field in the native protocol: NAME=value for single-line
+// values, or NAME, a newline, the little-endian 64-bit value length, and the value otherwise.
+func appendJournaldField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+
+	if strings.ContainsRune(value, '\n') {
+		buf.WriteByte('\n')
+
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+
+		buf.Write(size[:])
+	} else {
+		buf.WriteByte('=')
+	}
+
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journaldName converts a record key to a valid journal field name: upper case, characters other
+// than letters, digits, and underscores replaced by underscores, no leading underscore, which
+// journald reserves for trusted fields, no leading digit, and at most 64 characters.
+func journaldName(key string) string {
+	var buf strings.Builder
+
+	for _, r := range strings.ToUpper(key) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+
+	name := strings.TrimLeft(buf.String(), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "X" + name
+	}
+
+	if len(name) > journaldMaxNameLen {
+		name = name[:journaldMaxNameLen]
+	}
+
+	return name
+}
+
+// journaldValue formats a decoded JSON value as a journal field value.
+func journaldValue(value any) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+
+	data, err := jsoniter.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(data)
+}
@@ -0,0 +1,48 @@
+package tlog
+
+import (
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// sendJournaldFd passes data to journald through a sealed memfd, as the native protocol expects
+// for entries that do not fit in one datagram.
+func sendJournaldFd(conn *net.UnixConn, data []byte) error {
+	fd, err := unix.MemfdCreate("tlog-journal", unix.MFD_ALLOW_SEALING|unix.MFD_CLOEXEC)
+	if err != nil {
+		return err
+	}
+
+	file := os.NewFile(uintptr(fd), "tlog-journal")
+	defer file.Close()
+
+	_, err = file.Write(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = unix.FcntlInt(file.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL)
+	if err != nil {
+		return err
+	}
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	// net.UnixConn refuses WriteMsgUnix on connected datagram sockets, so the descriptor is sent
+	// with sendmsg directly.
+	var sendErr error
+
+	err = rawConn.Control(func(connFd uintptr) {
+		sendErr = unix.Sendmsg(int(connFd), nil, unix.UnixRights(int(file.Fd())), nil, 0)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendErr
+}
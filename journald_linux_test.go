@@ -0,0 +1,221 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+// journaldListener is a stand-in for the journald native protocol socket.
+type journaldListener struct {
+	socket string
+
+	conn *net.UnixConn
+}
+
+func newJournaldListener(t *testing.T) *journaldListener {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "socket")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("cannot listen on %s: %v", socket, err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return &journaldListener{socket: socket, conn: conn}
+}
+
+// receive reads one entry, from the datagram itself or from the memory file descriptor passed
+// with it, and reports whether it came through a descriptor.
+func (l *journaldListener) receive(t *testing.T) ([]byte, bool) {
+	t.Helper()
+
+	_ = l.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, unix.CmsgSpace(4))
+
+	n, oobn, _, _, err := l.conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatalf("ReadMsgUnix: %v", err)
+	}
+
+	if oobn == 0 {
+		return buf[:n], false
+	}
+
+	messages, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("cannot parse control message: %v", err)
+	}
+
+	fds, err := unix.ParseUnixRights(&messages[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("cannot parse descriptors: %v", err)
+	}
+
+	file := os.NewFile(uintptr(fds[0]), "journal-entry")
+	defer file.Close()
+
+	seals, err := unix.FcntlInt(file.Fd(), unix.F_GET_SEALS, 0)
+	if err != nil || seals&unix.F_SEAL_WRITE == 0 {
+		t.Errorf("descriptor seals = %#x, %v, want a sealed memfd", seals, err)
+	}
+
+	// The descriptor shares its offset with the sender; journald maps the file from the start.
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<30))
+	if err != nil {
+		t.Fatalf("cannot read descriptor: %v", err)
+	}
+
+	return data, true
+}
+
+// parseJournaldEntry decodes the fields of one native protocol entry.
+func parseJournaldEntry(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	fields := make(map[string]string)
+
+	for len(data) > 0 {
+		end := bytes.IndexAny(data, "=\n")
+		if end < 0 {
+			t.Fatalf("truncated field %q", data)
+		}
+
+		name := string(data[:end])
+
+		if data[end] == '=' {
+			data = data[end+1:]
+
+			line := bytes.IndexByte(data, '\n')
+			if line < 0 {
+				t.Fatalf("field %s is not terminated", name)
+			}
+
+			fields[name] = string(data[:line])
+			data = data[line+1:]
+
+			continue
+		}
+
+		data = data[end+1:]
+		if len(data) < 8 {
+			t.Fatalf("field %s has no length", name)
+		}
+
+		size := int(binary.LittleEndian.Uint64(data))
+		data = data[8:]
+
+		if len(data) < size+1 || data[size] != '\n' {
+			t.Fatalf("field %s of %d bytes is not terminated", name, size)
+		}
+
+		fields[name] = string(data[:size])
+		data = data[size+1:]
+	}
+
+	return fields
+}
+
+func TestJournaldFieldMapping(t *testing.T) {
+	listener := newJournaldListener(t)
+
+	journaldWriter := newJournaldWriter(listener.socket)
+	defer journaldWriter.Close()
+
+	record := `{"level":"error","app_name":"billing","time":"2026-01-02T03:04:05Z","caller":"billing/charge.go:42",` +
+		`"message":"charge failed\nsecond line","order-id":"A-17","_private":true,"attempt":3}` + "\n"
+
+	_, err := journaldWriter.WriteLevel(zerolog.ErrorLevel, []byte(record))
+	if err != nil {
+		t.Fatalf("WriteLevel: %v", err)
+	}
+
+	data, viaFd := listener.receive(t)
+	if viaFd {
+		t.Error("small entry was passed through a descriptor")
+	}
+
+	fields := parseJournaldEntry(t, data)
+
+	want := map[string]string{
+		"PRIORITY":          "3",
+		"MESSAGE":           "charge failed\nsecond line",
+		"SYSLOG_IDENTIFIER": "billing",
+		"CODE_FILE":         "billing/charge.go",
+		"CODE_LINE":         "42",
+		"ORDER_ID":          "A-17",
+		"PRIVATE":           "true",
+		"ATTEMPT":           "3",
+	}
+
+	for name, value := range want {
+		if got, ok := fields[name]; !ok || got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	for name := range fields {
+		if _, ok := want[name]; !ok {
+			t.Errorf("unexpected field %s=%q", name, fields[name])
+		}
+	}
+}
+
+func TestJournaldLevelFromRecord(t *testing.T) {
+	listener := newJournaldListener(t)
+
+	journaldWriter := newJournaldWriter(listener.socket)
+	defer journaldWriter.Close()
+
+	_, err := journaldWriter.Write([]byte(`{"level":"warn","message":"disk almost full"}` + "\n"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	data, _ := listener.receive(t)
+
+	fields := parseJournaldEntry(t, data)
+	if fields["PRIORITY"] != "4" || fields["MESSAGE"] != "disk almost full" {
+		t.Errorf("fields = %q, want PRIORITY 4 and the message", fields)
+	}
+}
+
+func TestJournaldLargeEntryUsesMemfd(t *testing.T) {
+	listener := newJournaldListener(t)
+
+	journaldWriter := newJournaldWriter(listener.socket)
+	defer journaldWriter.Close()
+
+	// Larger than the maximum datagram size, so that the write fails with EMSGSIZE.
+	message := strings.Repeat("x", 4<<20)
+
+	_, err := journaldWriter.WriteLevel(zerolog.InfoLevel, []byte(`{"message":"`+message+`"}`+"\n"))
+	if err != nil {
+		t.Fatalf("WriteLevel: %v", err)
+	}
+
+	data, viaFd := listener.receive(t)
+	if !viaFd {
+		t.Fatal("large entry was not passed through a descriptor")
+	}
+
+	fields := parseJournaldEntry(t, data)
+	if fields["PRIORITY"] != "6" || fields["MESSAGE"] != message {
+		t.Errorf("PRIORITY = %q, MESSAGE of %d bytes, want 6 and %d bytes", fields["PRIORITY"], len(fields["MESSAGE"]),
+			len(message))
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package tlog
+
+import (
+	"errors"
+	"net"
+)
+
+// sendJournaldFd reports that large entries cannot be passed to journald, which only runs on Linux.
+func sendJournaldFd(_ *net.UnixConn, _ []byte) error {
+	return errors.New("entry exceeds the datagram size limit and memfd is not supported on this platform")
+}
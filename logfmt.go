@@ -0,0 +1,114 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/json-iterator/go"
+)
+
+// logfmtWriter re-encodes JSON records from tlog as logfmt key=value lines.
+type logfmtWriter struct {
+	out io.Writer
+
+	fields *fieldConfig
+}
+
+// Write implements io.Writer. It decodes one JSON record and writes the logfmt line to out in a
+// single call. The time, level, app_name, trace_id, and message keys come first and the remaining
+// keys follow in lexical order, so lines for the same event shape are stable. It returns len(p)
+// on success so the zerolog pipeline does not report a short write.
+func (w *logfmtWriter) Write(p []byte) (int, error) {
+	record, err := decodeRecord(p)
+	if err != nil {
+		return 0, fmt.Errorf("tlog logfmt: cannot decode record: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	for i, key := range recordKeys(record, fieldPriorityKeys) {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(logfmtKey(w.fields.name(key)))
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(w.fields.controlMode(), record[key]))
+	}
+
+	buf.WriteByte('\n')
+
+	_, err = w.out.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// logfmtKey replaces characters that cannot appear in an unquoted logfmt key with underscores.
+func logfmtKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+
+	var buf bytes.Buffer
+
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			buf.WriteByte('_')
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+
+	return buf.String()
+}
+
+// logfmtValue formats a decoded JSON value. Strings are quoted when required, numbers and booleans
+// are written verbatim, null becomes null, and objects and arrays are written as quoted JSON.
+// Control characters in strings are escaped by quoting, or removed first under ControlStrip.
+func logfmtValue(control string, value any) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		if control == ControlStrip {
+			val = sanitizeControl(control, val)
+		}
+
+		return logfmtString(val)
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		data, err := jsoniter.Marshal(val)
+		if err != nil {
+			return logfmtString(fmt.Sprintf("%v", val))
+		}
+
+		return logfmtString(string(data))
+	}
+}
+
+// logfmtString returns value unchanged when it is safe to write unquoted, or as a Go-quoted string
+// with escaped quotes, backslashes, and control characters otherwise.
+func logfmtString(value string) string {
+	if value == "" {
+		return `""`
+	}
+
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return strconv.Quote(value)
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,75 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestLogfmtKeyOrder(t *testing.T) {
+	var buf bytes.Buffer
+
+	logfmtWriter := newFormatWriter(LogFormatLogfmt, &buf, &fieldConfig{})
+
+	record := `{"zone":"eu","message":"card declined","span_id":"b7ad6b7169203331","level":"warn","amount":12.5,` +
+		`"trace_id":"0af7651916cd43dd8448eb211c80319c","app_name":"billing","time":"2026-01-02T03:04:05Z","customer":"bob"}` + "\n"
+
+	_, err := logfmtWriter.Write([]byte(record))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	want := `time=2026-01-02T03:04:05Z level=warn app_name=billing trace_id=0af7651916cd43dd8448eb211c80319c ` +
+		`span_id=b7ad6b7169203331 message="card declined" amount=12.5 customer=bob zone=eu` + "\n"
+
+	if got := buf.String(); got != want {
+		t.Errorf("logfmt line =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLogfmtValues(t *testing.T) {
+	for _, test := range []struct {
+		control string
+		value   any
+		want    string
+	}{
+		{ControlEscape, "plain", "plain"},
+		{ControlEscape, "", `""`},
+		{ControlEscape, "two words", `"two words"`},
+		{ControlEscape, "a=b", `"a=b"`},
+		{ControlEscape, `say "hi"`, `"say \"hi\""`},
+		{ControlEscape, `C:\temp`, `"C:\\temp"`},
+		{ControlEscape, "line\nbreak", `"line\nbreak"`},
+		{ControlEscape, "\x1b[31mred", `"\x1b[31mred"`},
+		{ControlStrip, "line\nbreak", "linebreak"},
+		{ControlEscape, "héllo", "héllo"},
+		{ControlEscape, json.Number("42"), "42"},
+		{ControlEscape, json.Number("-0.5"), "-0.5"},
+		{ControlEscape, true, "true"},
+		{ControlEscape, nil, "null"},
+		{ControlEscape, []any{"a", json.Number("1")}, `"[\"a\",1]"`},
+		{ControlEscape, map[string]any{"id": "A 17"}, `"{\"id\":\"A 17\"}"`},
+	} {
+		if got := logfmtValue(test.control, test.value); got != test.want {
+			t.Errorf("logfmtValue(%s, %#v) = %s, want %s", test.control, test.value, got, test.want)
+		}
+	}
+}
+
+func TestLogfmtKeys(t *testing.T) {
+	for _, test := range []struct {
+		key  string
+		want string
+	}{
+		{"order_id", "order_id"},
+		{"", "_"},
+		{"user name", "user_name"},
+		{"a=b", "a_b"},
+		{`say"`, "say_"},
+		{"line\nbreak", "line_break"},
+	} {
+		if got := logfmtKey(test.key); got != test.want {
+			t.Errorf("logfmtKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
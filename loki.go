@@ -0,0 +1,340 @@
+package tlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/json-iterator/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// LokiEncodingProtobuf selects snappy-compressed protobuf push requests.
+	LokiEncodingProtobuf = "PROTOBUF"
+	// LokiEncodingJson selects JSON push requests.
+	LokiEncodingJson = "JSON"
+
+	// lokiPushPath is the path of the Loki push API.
+	lokiPushPath = "/loki/api/v1/push"
+
+	// lokiUnknownApp is the app_name label of records without an app_name field.
+	lokiUnknownApp = "unknown"
+)
+
+// DefaultLokiLabels lists the record keys used as Loki stream labels by default. Labels should be
+// limited to low-cardinality fields, as every distinct combination creates a stream. The app_name
+// label is always added.
+var DefaultLokiLabels = []string{fieldAppName, fieldLevel}
+
+// LokiWriter pushes records to the push API of Grafana Loki in batches. The configured label keys
+// select the stream of each record and the remaining fields form the JSON log line. Failed pushes
+// are retried with exponential backoff, honoring the Retry-After header of 429 responses.
+type LokiWriter struct {
+	*batchWriter
+
+	// endpoint is the URL of the push API.
+	endpoint string
+
+	// labels lists the record keys used as stream labels.
+	labels []string
+
+	// encoding is LokiEncodingProtobuf or LokiEncodingJson.
+	encoding string
+
+	// tenant is sent in the X-Scope-OrgID header when not empty.
+	tenant string
+
+	client *http.Client
+}
+
+// lokiStream collects the entries of one label set.
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+// lokiEntry is one log line and its timestamp.
+type lokiEntry struct {
+	time time.Time
+	line string
+}
+
+// newLokiWriter constructs a LokiWriter for endpoint. An endpoint without a path receives requests
+// at /loki/api/v1/push. Empty labels fall back to DefaultLokiLabels; non-positive timeout,
+// batchSize, and batchAge values fall back to DefaultSendTimeout, DefaultBatchSize, and
+// DefaultBatchInterval.
+func newLokiWriter(endpoint string, labels []string, encoding, tenant string, timeout time.Duration, batchSize int, batchAge time.Duration) (*LokiWriter, error) {
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("tlog loki: invalid endpoint %q: %w", endpoint, err)
+	}
+
+	if endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https" {
+		return nil, fmt.Errorf("tlog loki: invalid endpoint %q: scheme must be http or https", endpoint)
+	}
+
+	if endpointUrl.Path == "" || endpointUrl.Path == "/" {
+		endpointUrl.Path = lokiPushPath
+	}
+
+	if len(labels) == 0 {
+		labels = DefaultLokiLabels
+	}
+
+	encoding = strings.ToUpper(encoding)
+	if encoding != LokiEncodingJson {
+		encoding = LokiEncodingProtobuf
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultSendTimeout
+	}
+
+	lokiWriter := &LokiWriter{
+		endpoint: endpointUrl.String(),
+
+		labels: labels,
+
+		encoding: encoding,
+		tenant:   tenant,
+
+		client: &http.Client{Timeout: timeout},
+	}
+
+	lokiWriter.batchWriter = newBatchWriter("loki", batchSize, batchAge, lokiWriter.push)
+
+	return lokiWriter, nil
+}
+
+// push groups records into streams and posts them with retries.
+func (w *LokiWriter) push(records [][]byte) error {
+	streams := w.buildStreams(records)
+	if len(streams) == 0 {
+		return nil
+	}
+
+	var body []byte
+	var contentType string
+	var err error
+
+	if w.encoding == LokiEncodingJson {
+		body, err = buildLokiJson(streams)
+		contentType = "application/json"
+	} else {
+		body = snappy.Encode(nil, buildLokiProtobuf(streams))
+		contentType = "application/x-protobuf"
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return sendWithRetry(w.done, func() error {
+		return w.post(body, contentType)
+	})
+}
+
+// post sends one push request.
+func (w *LokiWriter) post(body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	if w.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", w.tenant)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return newStatusError(resp)
+}
+
+// buildStreams decodes records and groups them by label set. Within each stream, entries are
+// ordered by timestamp as Loki requires. Records that cannot be decoded are skipped.
+func (w *LokiWriter) buildStreams(records [][]byte) []*lokiStream {
+	var streams []*lokiStream
+
+	streamIndex := make(map[string]*lokiStream)
+
+	isLabel := make(map[string]bool, len(w.labels))
+	for _, label := range w.labels {
+		isLabel[label] = true
+	}
+
+	for _, p := range records {
+		record, err := decodeRecord(p)
+		if err != nil {
+			continue
+		}
+
+		recordTime, ok := parseRecordTime(record[fieldTime])
+		if !ok {
+			recordTime = time.Now()
+		}
+
+		labels := make(map[string]string, len(w.labels))
+
+		var buf bytes.Buffer
+
+		buf.WriteByte('{')
+
+		for _, key := range recordKeys(record, fieldPriorityKeys) {
+			if isLabel[key] {
+				labels[lokiLabelName(key)] = fmt.Sprintf("%v", record[key])
+				continue
+			}
+
+			if key == fieldTime {
+				continue
+			}
+
+			_ = appendJsonField(&buf, key, record[key])
+		}
+
+		buf.WriteByte('}')
+
+		// Loki rejects streams without labels, so every stream carries the app_name label, even
+		// when it is not configured or the record lacks it.
+		if _, ok := labels[fieldAppName]; !ok {
+			appName, _ := record[fieldAppName].(string)
+			if appName == "" {
+				appName = lokiUnknownApp
+			}
+
+			labels[fieldAppName] = appName
+		}
+
+		streamKey := lokiLabelString(labels)
+
+		stream, ok := streamIndex[streamKey]
+		if !ok {
+			stream = &lokiStream{labels: labels}
+
+			streamIndex[streamKey] = stream
+			streams = append(streams, stream)
+		}
+
+		stream.entries = append(stream.entries, lokiEntry{time: recordTime, line: buf.String()})
+	}
+
+	for _, stream := range streams {
+		sort.SliceStable(stream.entries, func(i, j int) bool {
+			return stream.entries[i].time.Before(stream.entries[j].time)
+		})
+	}
+
+	return streams
+}
+
+// buildLokiJson encodes streams as a JSON push request.
+func buildLokiJson(streams []*lokiStream) ([]byte, error) {
+	jsonStreams := make([]map[string]any, 0, len(streams))
+
+	for _, stream := range streams {
+		values := make([][]string, 0, len(stream.entries))
+		for _, entry := range stream.entries {
+			values = append(values, []string{strconv.FormatInt(entry.time.UnixNano(), 10), entry.line})
+		}
+
+		jsonStreams = append(jsonStreams, map[string]any{
+			"stream": stream.labels,
+			"values": values,
+		})
+	}
+
+	return jsoniter.Marshal(map[string]any{"streams": jsonStreams})
+}
+
+// buildLokiProtobuf encodes streams as a logproto.PushRequest:
+//
+//	message PushRequest { repeated StreamAdapter streams = 1; }
+//	message StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	message EntryAdapter { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func buildLokiProtobuf(streams []*lokiStream) []byte {
+	var request []byte
+
+	for _, stream := range streams {
+		var streamAdapter []byte
+
+		streamAdapter = protowire.AppendTag(streamAdapter, 1, protowire.BytesType)
+		streamAdapter = protowire.AppendString(streamAdapter, lokiLabelString(stream.labels))
+
+		for _, entry := range stream.entries {
+			var timestamp []byte
+
+			timestamp = protowire.AppendTag(timestamp, 1, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(entry.time.Unix()))
+			timestamp = protowire.AppendTag(timestamp, 2, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(entry.time.Nanosecond()))
+
+			var entryAdapter []byte
+
+			entryAdapter = protowire.AppendTag(entryAdapter, 1, protowire.BytesType)
+			entryAdapter = protowire.AppendBytes(entryAdapter, timestamp)
+			entryAdapter = protowire.AppendTag(entryAdapter, 2, protowire.BytesType)
+			entryAdapter = protowire.AppendString(entryAdapter, entry.line)
+
+			streamAdapter = protowire.AppendTag(streamAdapter, 2, protowire.BytesType)
+			streamAdapter = protowire.AppendBytes(streamAdapter, entryAdapter)
+		}
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, streamAdapter)
+	}
+
+	return request
+}
+
+// lokiLabelString formats labels in the Prometheus label set syntax, sorted by name.
+func lokiLabelString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+strconv.Quote(labels[name]))
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// lokiLabelName converts a record key to a valid label name matching [a-zA-Z_][a-zA-Z0-9_]*.
+func lokiLabelName(key string) string {
+	var buf strings.Builder
+
+	for i, r := range key {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			buf.WriteRune(r)
+		case r >= '0' && r <= '9' && i > 0:
+			buf.WriteRune(r)
+		default:
+			buf.WriteByte('_')
+		}
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,277 @@
+package tlog
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/json-iterator/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// lokiServer is a stand-in for the Loki push API that records the requests it receives.
+type lokiServer struct {
+	*httptest.Server
+
+	requests []lokiRequest
+
+	sync.Mutex
+}
+
+// lokiRequest is one push request received by lokiServer.
+type lokiRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newLokiServer(t *testing.T) *lokiServer {
+	server := &lokiServer{}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != lokiPushPath {
+			http.NotFound(w, r)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		server.Lock()
+		server.requests = append(server.requests, lokiRequest{header: r.Header.Clone(), body: body})
+		server.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *lokiServer) received() []lokiRequest {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]lokiRequest(nil), s.requests...)
+}
+
+// pushTestRecords writes records to a new LokiWriter and closes it, so that they are pushed in one
+// request.
+func pushTestRecords(t *testing.T, endpoint string, labels []string, encoding string, records ...string) {
+	t.Helper()
+
+	lokiWriter, err := newLokiWriter(endpoint, labels, encoding, "tenant-a", time.Second, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("newLokiWriter: %v", err)
+	}
+
+	for _, record := range records {
+		_, _ = lokiWriter.Write([]byte(record + "\n"))
+	}
+
+	err = lokiWriter.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// decodeLokiJson returns the values of a JSON push request by label string.
+func decodeLokiJson(t *testing.T, body []byte) map[string][][]string {
+	t.Helper()
+
+	var request struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]string        `json:"values"`
+		} `json:"streams"`
+	}
+
+	err := jsoniter.Unmarshal(body, &request)
+	if err != nil {
+		t.Fatalf("cannot decode push request %q: %v", body, err)
+	}
+
+	streams := make(map[string][][]string)
+	for _, stream := range request.Streams {
+		streams[lokiLabelString(stream.Stream)] = stream.Values
+	}
+
+	return streams
+}
+
+func TestLokiJsonPush(t *testing.T) {
+	server := newLokiServer(t)
+
+	pushTestRecords(t, server.URL, DefaultLokiLabels, LokiEncodingJson,
+		`{"level":"info","app_name":"billing","time":"2026-01-02T03:04:06Z","message":"second"}`,
+		`{"level":"error","app_name":"billing","time":"2026-01-02T03:04:07Z","message":"failed","order_id":"A-17"}`,
+		`{"level":"info","app_name":"billing","time":"2026-01-02T03:04:05Z","message":"first"}`,
+	)
+
+	requests := server.received()
+	if len(requests) != 1 {
+		t.Fatalf("server received %d requests, want 1", len(requests))
+	}
+
+	header := requests[0].header
+
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	if got := header.Get("X-Scope-OrgID"); got != "tenant-a" {
+		t.Errorf("X-Scope-OrgID = %q, want the tenant", got)
+	}
+
+	streams := decodeLokiJson(t, requests[0].body)
+
+	info := streams[`{app_name="billing", level="info"}`]
+	if len(info) != 2 {
+		t.Fatalf("streams = %q, want 2 entries for the info stream", streams)
+	}
+
+	// Entries are ordered by timestamp within their stream.
+	if info[0][0] != "1767323045000000000" || info[0][1] != `{"message":"first"}` {
+		t.Errorf("first info entry = %q", info[0])
+	}
+
+	if info[1][0] != "1767323046000000000" || info[1][1] != `{"message":"second"}` {
+		t.Errorf("second info entry = %q", info[1])
+	}
+
+	errorEntries := streams[`{app_name="billing", level="error"}`]
+	if len(errorEntries) != 1 || errorEntries[0][1] != `{"message":"failed","order_id":"A-17"}` {
+		t.Errorf("error stream = %q", errorEntries)
+	}
+}
+
+func TestLokiStreamsAlwaysHaveAppName(t *testing.T) {
+	server := newLokiServer(t)
+
+	pushTestRecords(t, server.URL, []string{"region"}, LokiEncodingJson,
+		`{"level":"info","app_name":"billing","time":"2026-01-02T03:04:05Z","message":"no region"}`,
+		`{"level":"info","time":"2026-01-02T03:04:05Z","message":"no app"}`,
+	)
+
+	requests := server.received()
+	if len(requests) != 1 {
+		t.Fatalf("server received %d requests, want 1", len(requests))
+	}
+
+	streams := decodeLokiJson(t, requests[0].body)
+
+	for _, labels := range []string{`{app_name="billing"}`, `{app_name="unknown"}`} {
+		if len(streams[labels]) != 1 {
+			t.Errorf("streams = %q, want one entry with labels %s", streams, labels)
+		}
+	}
+
+	if _, ok := streams["{}"]; ok {
+		t.Error("push request has a stream without labels")
+	}
+}
+
+func TestLokiProtobufPush(t *testing.T) {
+	server := newLokiServer(t)
+
+	pushTestRecords(t, server.URL, nil, LokiEncodingProtobuf,
+		`{"level":"warn","app_name":"billing","time":"2026-01-02T03:04:05.5Z","message":"slow"}`,
+	)
+
+	requests := server.received()
+	if len(requests) != 1 {
+		t.Fatalf("server received %d requests, want 1", len(requests))
+	}
+
+	if got := requests[0].header.Get("Content-Type"); got != "application/x-protobuf" {
+		t.Errorf("Content-Type = %q, want application/x-protobuf", got)
+	}
+
+	body, err := snappy.Decode(nil, requests[0].body)
+	if err != nil {
+		t.Fatalf("body is not snappy-compressed: %v", err)
+	}
+
+	// PushRequest.streams (1) -> StreamAdapter.labels (1) and entries (2) -> EntryAdapter.timestamp
+	// (1) and line (2).
+	stream := protoField(t, body, 1)
+
+	if got := string(protoField(t, stream, 1)); got != `{app_name="billing", level="warn"}` {
+		t.Errorf("labels = %s", got)
+	}
+
+	entry := protoField(t, stream, 2)
+
+	if got := string(protoField(t, entry, 2)); got != `{"message":"slow"}` {
+		t.Errorf("line = %s", got)
+	}
+
+	timestamp := protoField(t, entry, 1)
+
+	seconds, nanos := protoVarint(t, timestamp, 1), protoVarint(t, timestamp, 2)
+	if seconds != 1767323045 || nanos != 500000000 {
+		t.Errorf("timestamp = %d.%09d, want 1767323045.500000000", seconds, nanos)
+	}
+}
+
+// protoField returns the first length-delimited field with the given number of a protobuf
+// message.
+func protoField(t *testing.T, message []byte, number protowire.Number) []byte {
+	t.Helper()
+
+	value, _ := findProtoField(t, message, number, protowire.BytesType)
+
+	return value
+}
+
+// protoVarint returns the first varint field with the given number of a protobuf message.
+func protoVarint(t *testing.T, message []byte, number protowire.Number) uint64 {
+	t.Helper()
+
+	_, value := findProtoField(t, message, number, protowire.VarintType)
+
+	return value
+}
+
+func findProtoField(t *testing.T, message []byte, number protowire.Number, wireType protowire.Type) ([]byte, uint64) {
+	t.Helper()
+
+	for len(message) > 0 {
+		fieldNumber, fieldType, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+
+		message = message[n:]
+
+		if fieldNumber == number && fieldType == wireType {
+			switch wireType {
+			case protowire.BytesType:
+				value, n := protowire.ConsumeBytes(message)
+				if n >= 0 {
+					return value, 0
+				}
+			case protowire.VarintType:
+				value, n := protowire.ConsumeVarint(message)
+				if n >= 0 {
+					return nil, value
+				}
+			}
+
+			t.Fatalf("invalid field %d", number)
+		}
+
+		n = protowire.ConsumeFieldValue(fieldNumber, fieldType, message)
+		if n < 0 {
+			t.Fatalf("invalid field %d: %v", fieldNumber, protowire.ParseError(n))
+		}
+
+		message = message[n:]
+	}
+
+	t.Fatalf("message has no field %d", number)
+
+	return nil, 0
+}
@@ -0,0 +1,390 @@
+package tlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// msgpackMaxLen bounds the length of strings, binaries, arrays, and maps accepted by readMsgpack,
+// so that a corrupt or hostile peer cannot make the decoder allocate unbounded memory.
+const msgpackMaxLen = 1 << 20
+
+// appendMsgpack appends the MessagePack encoding of a decoded JSON value to buf. Objects are
+// written with sorted keys; values of other types are written as their fmt representation.
+func appendMsgpack(buf []byte, value any) []byte {
+	switch val := value.(type) {
+	case nil:
+		return append(buf, 0xc0)
+	case bool:
+		return appendMsgpackBool(buf, val)
+	case string:
+		return appendMsgpackString(buf, val)
+	case []byte:
+		return appendMsgpackBin(buf, val)
+	case int:
+		return appendMsgpackInt(buf, int64(val))
+	case int64:
+		return appendMsgpackInt(buf, val)
+	case uint64:
+		return appendMsgpackUint(buf, val)
+	case float64:
+		return appendMsgpackFloat(buf, val)
+	case json.Number:
+		if intValue, err := val.Int64(); err == nil {
+			return appendMsgpackInt(buf, intValue)
+		}
+
+		if floatValue, err := val.Float64(); err == nil {
+			return appendMsgpackFloat(buf, floatValue)
+		}
+
+		return appendMsgpackString(buf, val.String())
+	case []any:
+		buf = appendMsgpackArrayHeader(buf, len(val))
+		for _, item := range val {
+			buf = appendMsgpack(buf, item)
+		}
+
+		return buf
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		buf = appendMsgpackMapHeader(buf, len(val))
+		for _, key := range keys {
+			buf = appendMsgpackString(buf, key)
+			buf = appendMsgpack(buf, val[key])
+		}
+
+		return buf
+	default:
+		return appendMsgpackString(buf, fmt.Sprintf("%v", val))
+	}
+}
+
+// appendMsgpackBool appends a boolean.
+func appendMsgpackBool(buf []byte, value bool) []byte {
+	if value {
+		return append(buf, 0xc3)
+	}
+
+	return append(buf, 0xc2)
+}
+
+// appendMsgpackInt appends a signed integer in its shortest encoding.
+func appendMsgpackInt(buf []byte, value int64) []byte {
+	switch {
+	case value >= 0:
+		return appendMsgpackUint(buf, uint64(value))
+	case value >= -32:
+		return append(buf, byte(value))
+	case value >= math.MinInt8:
+		return append(buf, 0xd0, byte(value))
+	case value >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(value))
+	case value >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(value))
+	}
+}
+
+// appendMsgpackUint appends an unsigned integer in its shortest encoding.
+func appendMsgpackUint(buf []byte, value uint64) []byte {
+	switch {
+	case value <= 0x7f:
+		return append(buf, byte(value))
+	case value <= math.MaxUint8:
+		return append(buf, 0xcc, byte(value))
+	case value <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(value))
+	case value <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), value)
+	}
+}
+
+// appendMsgpackFloat appends a 64-bit float.
+func appendMsgpackFloat(buf []byte, value float64) []byte {
+	return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(value))
+}
+
+// appendMsgpackString appends a UTF-8 string.
+func appendMsgpackString(buf []byte, value string) []byte {
+	switch n := len(value); {
+	case n <= 31:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+
+	return append(buf, value...)
+}
+
+// appendMsgpackBin appends a byte array.
+func appendMsgpackBin(buf []byte, value []byte) []byte {
+	switch n := len(value); {
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xc5), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xc6), uint32(n))
+	}
+
+	return append(buf, value...)
+}
+
+// appendMsgpackArrayHeader appends the header of an array of n elements.
+func appendMsgpackArrayHeader(buf []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, 0xdd), uint32(n))
+	}
+}
+
+// appendMsgpackMapHeader appends the header of a map of n key-value pairs.
+func appendMsgpackMapHeader(buf []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, 0xdf), uint32(n))
+	}
+}
+
+// appendMsgpackEventTime appends t as the EventTime extension of the Fluentd Forward protocol: a
+// fixext 8 of type 0 holding the seconds and nanoseconds as big-endian 32-bit integers.
+func appendMsgpackEventTime(buf []byte, t time.Time) []byte {
+	buf = append(buf, 0xd7, 0x00)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(t.Unix()))
+
+	return binary.BigEndian.AppendUint32(buf, uint32(t.Nanosecond()))
+}
+
+// readMsgpack decodes one MessagePack value from r. Integers are returned as int64 or uint64,
+// strings and binaries as string, arrays as []any, and maps as map[string]any with keys formatted
+// by fmt when they are not strings. Extension values are skipped and returned as nil.
+func readMsgpack(r *bufio.Reader) (any, error) {
+	code, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80:
+		return readMsgpackMap(r, int(code&0x0f))
+	case code&0xf0 == 0x90:
+		return readMsgpackArray(r, int(code&0x0f))
+	case code&0xe0 == 0xa0:
+		return readMsgpackBytes(r, int(code&0x1f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9:
+		n, err := readMsgpackUint(r, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		return readMsgpackBytes(r, int(n))
+	case 0xc5, 0xda:
+		n, err := readMsgpackUint(r, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		return readMsgpackBytes(r, int(n))
+	case 0xc6, 0xdb:
+		n, err := readMsgpackUint(r, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		return readMsgpackBytes(r, int(n))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readMsgpackUint(r, 1<<(code-0xc7))
+		if err != nil {
+			return nil, err
+		}
+
+		// The extension type byte precedes the data.
+		return nil, readMsgpackSkip(r, int(n)+1)
+	case 0xca:
+		bits, err := readMsgpackUint(r, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		return float64(math.Float32frombits(uint32(bits))), nil
+	case 0xcb:
+		bits, err := readMsgpackUint(r, 8)
+		if err != nil {
+			return nil, err
+		}
+
+		return math.Float64frombits(bits), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return readMsgpackUint(r, 1<<(code-0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+
+		value, err := readMsgpackUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+
+		// Sign-extend the big-endian value of size bytes.
+		shift := 64 - 8*size
+
+		return int64(value<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return nil, readMsgpackSkip(r, 1+1<<(code-0xd4))
+	case 0xdc:
+		n, err := readMsgpackUint(r, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		return readMsgpackArray(r, int(n))
+	case 0xdd:
+		n, err := readMsgpackUint(r, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		return readMsgpackArray(r, int(n))
+	case 0xde:
+		n, err := readMsgpackUint(r, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		return readMsgpackMap(r, int(n))
+	case 0xdf:
+		n, err := readMsgpackUint(r, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		return readMsgpackMap(r, int(n))
+	default:
+		return nil, fmt.Errorf("msgpack: invalid type code 0x%02x", code)
+	}
+}
+
+// readMsgpackUint reads a big-endian unsigned integer of size bytes.
+func readMsgpackUint(r *bufio.Reader, size int) (uint64, error) {
+	var data [8]byte
+
+	_, err := io.ReadFull(r, data[8-size:])
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(data[:]), nil
+}
+
+// readMsgpackBytes reads n bytes as a string.
+func readMsgpackBytes(r *bufio.Reader, n int) (string, error) {
+	if n > msgpackMaxLen {
+		return "", fmt.Errorf("msgpack: length %d exceeds the limit", n)
+	}
+
+	data := make([]byte, n)
+
+	_, err := io.ReadFull(r, data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// readMsgpackSkip discards n bytes.
+func readMsgpackSkip(r *bufio.Reader, n int) error {
+	_, err := r.Discard(n)
+
+	return err
+}
+
+// readMsgpackArray reads the n elements of an array.
+func readMsgpackArray(r *bufio.Reader, n int) ([]any, error) {
+	if n > msgpackMaxLen {
+		return nil, fmt.Errorf("msgpack: length %d exceeds the limit", n)
+	}
+
+	values := make([]any, 0, n)
+
+	for i := 0; i < n; i++ {
+		value, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// readMsgpackMap reads the n key-value pairs of a map.
+func readMsgpackMap(r *bufio.Reader, n int) (map[string]any, error) {
+	if n > msgpackMaxLen {
+		return nil, fmt.Errorf("msgpack: length %d exceeds the limit", n)
+	}
+
+	values := make(map[string]any, n)
+
+	for i := 0; i < n; i++ {
+		key, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+
+		keyString, ok := key.(string)
+		if !ok {
+			keyString = fmt.Sprintf("%v", key)
+		}
+
+		values[keyString] = value
+	}
+
+	return values, nil
+}
@@ -0,0 +1,125 @@
+package tlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeTestMsgpack decodes one MessagePack value from data.
+func decodeTestMsgpack(t *testing.T, data []byte) any {
+	t.Helper()
+
+	value, err := readMsgpack(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("readMsgpack(%x): %v", data, err)
+	}
+
+	return value
+}
+
+func TestAppendMsgpackEncoding(t *testing.T) {
+	for _, test := range []struct {
+		value any
+		want  string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{false, "c2"},
+		{7, "07"},
+		{-3, "fd"},
+		{-100, "d09c"},
+		{200, "ccc8"},
+		{-1000, "d1fc18"},
+		{70000, "ce00011170"},
+		{uint64(1) << 40, "cf0000010000000000"},
+		{1.5, "cb3ff8000000000000"},
+		{json.Number("42"), "2a"},
+		{json.Number("0.25"), "cb3fd0000000000000"},
+		{"abc", "a3616263"},
+		{strings.Repeat("x", 32), "d920" + strings.Repeat("78", 32)},
+		{[]byte("ab"), "c4026162"},
+		{[]any{1, "a"}, "9201a161"},
+		// Keys are sorted.
+		{map[string]any{"b": 1, "a": -1}, "82a161ffa16201"},
+		{time.Second, "a2" + hex.EncodeToString([]byte("1s"))},
+	} {
+		if got := hex.EncodeToString(appendMsgpack(nil, test.value)); got != test.want {
+			t.Errorf("appendMsgpack(%#v) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestReadMsgpackRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		value any
+		want  any
+	}{
+		{nil, nil},
+		{true, true},
+		{-3, int64(-3)},
+		{-40000, int64(-40000)},
+		{200, uint64(200)},
+		{uint64(1) << 40, uint64(1) << 40},
+		{2.5, 2.5},
+		{strings.Repeat("s", 300), strings.Repeat("s", 300)},
+		{strings.Repeat("m", 70000), strings.Repeat("m", 70000)},
+		// Binaries are decoded as strings.
+		{[]byte("salt"), "salt"},
+		{[]any{"PONG", true, "", nil}, []any{"PONG", true, "", nil}},
+		{map[string]any{"ack": "chunk", "size": 2}, map[string]any{"ack": "chunk", "size": int64(2)}},
+	} {
+		if got := decodeTestMsgpack(t, appendMsgpack(nil, test.value)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("readMsgpack(appendMsgpack(%.40v)) = %#.40v, want %#.40v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestMsgpackEventTime(t *testing.T) {
+	eventTime := time.Date(2026, 1, 2, 3, 4, 5, 250000000, time.UTC)
+
+	data := appendMsgpackEventTime(nil, eventTime)
+
+	want := "d700" + "695735a5" + "0ee6b280"
+	if got := hex.EncodeToString(data); got != want {
+		t.Errorf("appendMsgpackEventTime = %s, want %s", got, want)
+	}
+
+	// The extension is skipped by the decoder, which continues with the next value.
+	data = appendMsgpackString(data, "next")
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+
+	for _, want := range []any{nil, "next"} {
+		value, err := readMsgpack(reader)
+		if err != nil || value != want {
+			t.Errorf("readMsgpack = %v, %v, want %v", value, err, want)
+		}
+	}
+}
+
+func TestReadMsgpackRejectsInvalidData(t *testing.T) {
+	for _, data := range []string{
+		"db7fffffff",   // str 32
+		"c67fffffff",   // bin 32
+		"dd7fffffff",   // array 32
+		"df7fffffff",   // map 32
+		"c1",           // never used
+		"d9",           // truncated length
+		"a5616263",     // truncated string
+		"92a161",       // truncated array
+		"82a16101a162", // truncated map
+	} {
+		raw, _ := hex.DecodeString(data)
+
+		_, err := readMsgpack(bufio.NewReader(bytes.NewReader(raw)))
+		if err == nil {
+			t.Errorf("readMsgpack(%s) succeeded, want an error", data)
+		}
+	}
+}
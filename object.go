@@ -0,0 +1,387 @@
+package tlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/json-iterator/go"
+)
+
+const (
+	// ObjectTag is the struct tag that controls how [Tevent.Object] logs the fields of a struct:
+	// tlog:"name" renames a field, tlog:"-" omits it, and the options redact, hash, pseudonymize,
+	// and omitempty, as in tlog:"name,hash" or tlog:",redact", replace its value with
+	// [RedactedValue], a hash, or its [Pseudonym], or omit it when empty. Fields without the tag
+	// use the name of their json tag. Pseudonymized fields are redacted when no pseudonym key is
+	// configured.
+	ObjectTag = "tlog"
+
+	// objectHashPrefix and objectHashLen define hashed values: the prefix followed by the first
+	// objectHashLen hex digits of the SHA-256 digest of the value.
+	objectHashPrefix = "sha256:"
+	objectHashLen    = 16
+
+	// objectMaxDepth bounds the nesting of logged values.
+	objectMaxDepth = 32
+)
+
+// LogMarshaler is implemented by values that control their own representation in [Tevent.Object].
+// MarshalLog returns the value to log in place of the receiver, typically a map or a string; the
+// returned value is logged without reflecting over the fields of the receiver.
+type LogMarshaler interface {
+	MarshalLog() any
+}
+
+var (
+	logMarshalerType  = reflect.TypeFor[LogMarshaler]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	errorType         = reflect.TypeFor[error]()
+)
+
+// objectFieldMode is the handling of a struct field selected by its tag.
+type objectFieldMode int
+
+const (
+	objectFieldPlain objectFieldMode = iota
+	objectFieldRedact
+	objectFieldHash
+	objectFieldPseudonymize
+)
+
+// objectField describes one logged field of a struct type.
+type objectField struct {
+	name  string
+	index []int
+	mode  objectFieldMode
+
+	omitEmpty bool
+}
+
+// objectFields caches the logged fields of struct types, keyed by reflect.Type.
+var objectFields sync.Map
+
+// cachedObjectFields returns the logged fields of the struct type t, reflecting over t only the
+// first time it is logged.
+func cachedObjectFields(t reflect.Type) []objectField {
+	if fields, ok := objectFields.Load(t); ok {
+		return fields.([]objectField)
+	}
+
+	fields, _ := objectFields.LoadOrStore(t, buildObjectFields(t, nil))
+
+	return fields.([]objectField)
+}
+
+// buildObjectFields lists the exported fields of the struct type t in declaration order. Fields of
+// embedded structs without a tag are listed as if they were fields of t.
+func buildObjectFields(t reflect.Type, index []int) []objectField {
+	var fields []objectField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag, tagged := field.Tag.Lookup(ObjectTag)
+		if tag == "-" {
+			continue
+		}
+
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		if field.Anonymous && !tagged {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+
+			if fieldType.Kind() == reflect.Struct {
+				fields = append(fields, buildObjectFields(fieldType, fieldIndex)...)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+
+		if !tagged {
+			jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if jsonName == "-" {
+				continue
+			}
+
+			name = jsonName
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		objectField := objectField{
+			name:  name,
+			index: fieldIndex,
+		}
+
+		for _, option := range strings.Split(options, ",") {
+			switch strings.TrimSpace(option) {
+			case "redact":
+				objectField.mode = objectFieldRedact
+			case "hash":
+				objectField.mode = objectFieldHash
+			case "pseudonymize":
+				objectField.mode = objectFieldPseudonymize
+			case "omitempty":
+				objectField.omitEmpty = true
+			}
+		}
+
+		fields = append(fields, objectField)
+	}
+
+	return fields
+}
+
+// objectMember is one member of a logObject.
+type objectMember struct {
+	name  string
+	value any
+}
+
+// logObject is a logged struct whose members are encoded in declaration order.
+type logObject []objectMember
+
+// MarshalJSON implements json.Marshaler.
+func (o logObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for i, member := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		name, err := jsoniter.Marshal(member.name)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := jsoniter.Marshal(member.value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// objectEncoder converts values passed to Tevent.Object to values encoded as JSON, applying the
+// struct tags and the redactor of the logger.
+type objectEncoder struct {
+	redactor *redactor
+
+	// path holds the pointers being encoded, to stop reference cycles.
+	path map[uintptr]bool
+}
+
+// encode returns the logged form of v at nesting depth.
+func (e objectEncoder) encode(v reflect.Value, depth int) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if depth > objectMaxDepth {
+		return "[max depth exceeded]"
+	}
+
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+	}
+
+	if v.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(v.Type()).Implements(logMarshalerType) {
+		v = v.Addr()
+	}
+
+	if v.Type().Implements(logMarshalerType) {
+		return e.encode(reflect.ValueOf(v.Interface().(LogMarshaler).MarshalLog()), depth+1)
+	}
+
+	if v.Type().Implements(errorType) {
+		return e.redactor.redactString(v.Interface().(error).Error())
+	}
+
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return e.encodeMarshaler(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		pointer := v.Pointer()
+		if e.path[pointer] {
+			return "[cycle]"
+		}
+
+		e.path[pointer] = true
+		defer delete(e.path, pointer)
+
+		return e.encode(v.Elem(), depth+1)
+	case reflect.Interface:
+		return e.encode(v.Elem(), depth+1)
+	case reflect.String:
+		return e.redactor.redactString(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.redactor.redactNumber(strconv.FormatInt(v.Int(), 10), v.Interface())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return e.redactor.redactNumber(strconv.FormatUint(v.Uint(), 10), v.Interface())
+	case reflect.Struct:
+		return e.encodeStruct(v, depth)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		members := make(map[string]any, v.Len())
+
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+
+			switch {
+			case e.redactor.pseudonymous(key):
+				members[key] = e.redactor.pseudonym(string(objectValueText(iter.Value())))
+			case e.redactor.sensitive(key):
+				members[key] = RedactedValue
+			default:
+				members[key] = e.encode(iter.Value(), depth+1)
+			}
+		}
+
+		return members
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+
+		elements := make([]any, v.Len())
+		for i := range elements {
+			elements[i] = e.encode(v.Index(i), depth+1)
+		}
+
+		return elements
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return fmt.Sprintf("%T", v.Interface())
+	default:
+		return v.Interface()
+	}
+}
+
+// encodeMarshaler returns the logged form of v, whose type implements json.Marshaler or
+// encoding.TextMarshaler. Its encoding is redacted as Tevent.Any redacts values, and v itself is
+// logged when no redaction rule changes the encoding.
+func (e objectEncoder) encodeMarshaler(v reflect.Value) any {
+	if e.redactor == nil {
+		return v.Interface()
+	}
+
+	data, err := jsoniter.Marshal(v.Interface())
+	if err != nil {
+		return RedactedValue
+	}
+
+	decoded, err := decodeJsonValue(data)
+	if err != nil {
+		return RedactedValue
+	}
+
+	redacted := e.redactor.redactValue(decoded)
+	if reflect.DeepEqual(redacted, decoded) {
+		return v.Interface()
+	}
+
+	return redacted
+}
+
+// encodeStruct returns the logged form of the struct v.
+func (e objectEncoder) encodeStruct(v reflect.Value, depth int) logObject {
+	fields := cachedObjectFields(v.Type())
+
+	object := make(logObject, 0, len(fields))
+
+	for _, field := range fields {
+		fieldValue, err := v.FieldByIndexErr(field.index)
+		if err != nil || !fieldValue.CanInterface() {
+			// The field belongs to an embedded struct pointer that is nil or to an unexported
+			// embedded struct.
+			continue
+		}
+
+		if field.omitEmpty && fieldValue.IsZero() {
+			continue
+		}
+
+		var value any
+
+		switch {
+		case field.mode == objectFieldPseudonymize || e.redactor.pseudonymous(field.name):
+			value = e.redactor.pseudonym(string(objectValueText(fieldValue)))
+		case field.mode == objectFieldRedact || e.redactor.sensitive(field.name):
+			value = RedactedValue
+		case field.mode == objectFieldHash:
+			value = hashObjectValue(fieldValue)
+		default:
+			value = e.encode(fieldValue, depth+1)
+		}
+
+		object = append(object, objectMember{name: field.name, value: value})
+	}
+
+	return object
+}
+
+// objectValueText returns the text that is hashed or pseudonymized in place of v: strings as they
+// are, other values as their JSON encoding, and null when v holds no value.
+func objectValueText(v reflect.Value) []byte {
+	if !v.IsValid() {
+		return []byte("null")
+	}
+
+	if v.Kind() == reflect.String {
+		return []byte(v.String())
+	}
+
+	data, err := jsoniter.Marshal(v.Interface())
+	if err != nil {
+		return []byte(fmt.Sprint(v.Interface()))
+	}
+
+	return data
+}
+
+// hashObjectValue returns the hash of a field tagged with the hash option.
+func hashObjectValue(v reflect.Value) string {
+	sum := sha256.Sum256(objectValueText(v))
+
+	return objectHashPrefix + hex.EncodeToString(sum[:])[:objectHashLen]
+}
@@ -0,0 +1,73 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// emailAddress is a TextMarshaler holding an email address.
+type emailAddress struct {
+	local  string
+	domain string
+}
+
+func (a emailAddress) MarshalText() ([]byte, error) {
+	return []byte(a.local + "@" + a.domain), nil
+}
+
+func TestObjectRedactsMarshalers(t *testing.T) {
+	var buf bytes.Buffer
+
+	tl := newTestRedactingLog(t, &buf)
+
+	type contact struct {
+		Plain  string          `json:"plain"`
+		Raw    json.RawMessage `json:"raw"`
+		Text   emailAddress    `json:"text"`
+		Nested json.RawMessage `json:"nested"`
+
+		// Marshalers that no rule matches are logged as they are.
+		When  time.Time       `json:"when"`
+		Extra json.RawMessage `json:"extra"`
+	}
+
+	newTevent("INFO", tl).Object("contact", contact{
+		Plain:  "bob@example.com",
+		Raw:    json.RawMessage(`"bob@example.com"`),
+		Text:   emailAddress{local: "bob", domain: "example.com"},
+		Nested: json.RawMessage(`{"owner":"bob@example.com","password":"hunter2"}`),
+		When:   time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Extra:  json.RawMessage(`{"count":3}`),
+	}).Msg("updated")
+
+	if strings.Contains(buf.String(), "bob@example.com") || strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("record %q contains the redacted values", buf.String())
+	}
+
+	record := decodeTestDocument(t, buf.Bytes())
+
+	object, _ := record["contact"].(map[string]any)
+
+	for _, key := range []string{"plain", "raw", "text"} {
+		if got := object[key]; got != RedactedValue {
+			t.Errorf("%s = %v, want %s", key, got, RedactedValue)
+		}
+	}
+
+	nested, _ := object["nested"].(map[string]any)
+	if nested["owner"] != RedactedValue || nested["password"] != RedactedValue {
+		t.Errorf("nested = %v, want both members redacted", object["nested"])
+	}
+
+	if got := object["when"]; got != "2026-01-02T03:04:05Z" {
+		t.Errorf("when = %v, want the time unchanged", got)
+	}
+
+	extra, _ := object["extra"].(map[string]any)
+	if extra["count"] != json.Number("3") {
+		t.Errorf("extra = %v, want the raw message unchanged", object["extra"])
+	}
+}
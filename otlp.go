@@ -0,0 +1,292 @@
+package tlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+)
+
+const (
+	// otlpLogsPath is the default OTLP/HTTP path for log export requests.
+	otlpLogsPath = "/v1/logs"
+
+	// otlpScopeName is the instrumentation scope reported for exported records.
+	otlpScopeName = "github.com/choveylee/tlog"
+)
+
+// otlpSeverityNumbers maps zerolog level names to OpenTelemetry severity numbers.
+var otlpSeverityNumbers = map[string]int{
+	"trace": 1,
+	"debug": 5,
+	"info":  9,
+	"warn":  13,
+	"error": 17,
+	"fatal": 21,
+	"panic": 24,
+}
+
+// otlpAttributeNames maps record keys to OpenTelemetry semantic convention attribute names.
+var otlpAttributeNames = map[string]string{
+	fieldError:      "exception.message",
+	fieldErrorType:  "exception.type",
+	fieldErrorStack: "exception.stacktrace",
+}
+
+// OtlpWriter exports records to an OpenTelemetry collector with the OTLP/HTTP protocol using the
+// JSON encoding. Records are converted to the OpenTelemetry log data model and sent in batches;
+// failed requests are retried with exponential backoff.
+type OtlpWriter struct {
+	*batchWriter
+
+	// endpoint is the URL that receives export requests.
+	endpoint string
+
+	// headers are added to every export request, for example for authentication.
+	headers map[string]string
+
+	client *http.Client
+}
+
+// newOtlpWriter constructs an OtlpWriter for endpoint. An endpoint without a path receives
+// requests at /v1/logs. Non-positive timeout, batchSize, and batchInterval values fall back to
+// DefaultSendTimeout, DefaultBatchSize, and DefaultBatchInterval.
+func newOtlpWriter(endpoint string, headers map[string]string, timeout time.Duration, batchSize int, batchInterval time.Duration) (*OtlpWriter, error) {
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("tlog otlp: invalid endpoint %q: %w", endpoint, err)
+	}
+
+	if endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https" {
+		return nil, fmt.Errorf("tlog otlp: invalid endpoint %q: scheme must be http or https", endpoint)
+	}
+
+	if endpointUrl.Path == "" || endpointUrl.Path == "/" {
+		endpointUrl.Path = otlpLogsPath
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultSendTimeout
+	}
+
+	otlpWriter := &OtlpWriter{
+		endpoint: endpointUrl.String(),
+
+		headers: headers,
+
+		client: &http.Client{Timeout: timeout},
+	}
+
+	otlpWriter.batchWriter = newBatchWriter("otlp", batchSize, batchInterval, otlpWriter.export)
+
+	return otlpWriter, nil
+}
+
+// reportsErrorDetail implements errorDetailReporter; log records hold exception.type and
+// exception.stacktrace.
+func (w *OtlpWriter) reportsErrorDetail() bool {
+	return true
+}
+
+// export converts records to one OTLP export request and posts it with retries.
+func (w *OtlpWriter) export(records [][]byte) error {
+	body, err := buildOtlpRequest(records, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return sendWithRetry(w.done, func() error {
+		return w.post(body)
+	})
+}
+
+// post sends one export request.
+func (w *OtlpWriter) post(body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return newStatusError(resp)
+}
+
+// buildOtlpRequest encodes records as an ExportLogsServiceRequest in the OTLP JSON encoding. The
+// records are grouped into one resource per app_name, reported as service.name. Records that
+// cannot be decoded are skipped.
+func buildOtlpRequest(records [][]byte, observedTime time.Time) ([]byte, error) {
+	var appNames []string
+
+	logRecords := make(map[string][]map[string]any)
+
+	for _, p := range records {
+		record, err := decodeRecord(p)
+		if err != nil {
+			continue
+		}
+
+		appName, _ := record[fieldAppName].(string)
+		if _, ok := logRecords[appName]; !ok {
+			appNames = append(appNames, appName)
+		}
+
+		logRecords[appName] = append(logRecords[appName], buildOtlpLogRecord(record, observedTime))
+	}
+
+	resourceLogs := make([]map[string]any, 0, len(appNames))
+
+	for _, appName := range appNames {
+		resourceLogs = append(resourceLogs, map[string]any{
+			"resource": map[string]any{
+				"attributes": []map[string]any{otlpAttribute("service.name", appName)},
+			},
+			"scopeLogs": []map[string]any{
+				{
+					"scope":      map[string]any{"name": otlpScopeName},
+					"logRecords": logRecords[appName],
+				},
+			},
+		})
+	}
+
+	return jsoniter.Marshal(map[string]any{"resourceLogs": resourceLogs})
+}
+
+// buildOtlpLogRecord converts one decoded record to a LogRecord of the OpenTelemetry log data
+// model. The message becomes the body, the trace and span identifiers and the sampled flag become
+// traceId, spanId, and flags, the caller becomes
+// the code.file.path and code.line.number attributes, and all other fields become attributes.
+func buildOtlpLogRecord(record map[string]any, observedTime time.Time) map[string]any {
+	logRecord := map[string]any{
+		"observedTimeUnixNano": strconv.FormatInt(observedTime.UnixNano(), 10),
+	}
+
+	if recordTime, ok := parseRecordTime(record[fieldTime]); ok {
+		logRecord["timeUnixNano"] = strconv.FormatInt(recordTime.UnixNano(), 10)
+	}
+
+	if level, ok := record[fieldLevel].(string); ok {
+		logRecord["severityText"] = strings.ToUpper(level)
+
+		if severityNumber, ok := otlpSeverityNumbers[level]; ok {
+			logRecord["severityNumber"] = severityNumber
+		}
+	}
+
+	if message, ok := record[fieldMessage]; ok {
+		logRecord["body"] = otlpValue(message)
+	}
+
+	var attributes []map[string]any
+
+	for _, key := range recordKeys(record, nil) {
+		value := record[key]
+
+		switch key {
+		case fieldTime, fieldLevel, fieldMessage, fieldAppName:
+			continue
+		case CtxTraceId:
+			logRecord["traceId"] = value
+		case CtxSpanId:
+			logRecord["spanId"] = value
+		case CtxTraceSampled:
+			// W3C trace flags, of which bit 0 is the sampled flag.
+			if sampled, _ := value.(bool); sampled {
+				logRecord["flags"] = 1
+			}
+		case fieldCaller:
+			file, line, ok := splitCaller(value)
+			if !ok {
+				attributes = append(attributes, otlpAttribute("code.file.path", value))
+				break
+			}
+
+			attributes = append(attributes,
+				otlpAttribute("code.file.path", file),
+				otlpAttribute("code.line.number", json.Number(strconv.Itoa(line))),
+			)
+		default:
+			name, ok := otlpAttributeNames[key]
+			if !ok {
+				name = key
+			}
+
+			attributes = append(attributes, otlpAttribute(name, value))
+		}
+	}
+
+	if len(attributes) > 0 {
+		logRecord["attributes"] = attributes
+	}
+
+	return logRecord
+}
+
+// otlpAttribute returns a KeyValue with the given key and value.
+func otlpAttribute(key string, value any) map[string]any {
+	return map[string]any{
+		"key":   key,
+		"value": otlpValue(value),
+	}
+}
+
+// otlpValue converts a decoded JSON value to an AnyValue. Integers are written as strings, as the
+// OTLP JSON encoding requires for 64-bit values; objects and arrays become kvlistValue and arrayValue.
+func otlpValue(value any) map[string]any {
+	switch val := value.(type) {
+	case nil:
+		return map[string]any{}
+	case string:
+		return map[string]any{"stringValue": val}
+	case bool:
+		return map[string]any{"boolValue": val}
+	case json.Number:
+		if intValue, err := val.Int64(); err == nil {
+			return map[string]any{"intValue": strconv.FormatInt(intValue, 10)}
+		}
+
+		if floatValue, err := val.Float64(); err == nil {
+			return map[string]any{"doubleValue": floatValue}
+		}
+
+		return map[string]any{"stringValue": val.String()}
+	case []any:
+		values := make([]map[string]any, 0, len(val))
+		for _, item := range val {
+			values = append(values, otlpValue(item))
+		}
+
+		return map[string]any{"arrayValue": map[string]any{"values": values}}
+	case map[string]any:
+		values := make([]map[string]any, 0, len(val))
+		for _, key := range recordKeys(val, nil) {
+			values = append(values, otlpAttribute(key, val[key]))
+		}
+
+		return map[string]any{"kvlistValue": map[string]any{"values": values}}
+	default:
+		return map[string]any{"stringValue": fmt.Sprintf("%v", val)}
+	}
+}
@@ -0,0 +1,302 @@
+package tlog
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/json-iterator/go"
+)
+
+// otlpCollector is a stand-in for an OpenTelemetry collector. It answers export requests with the
+// listed responses in turn and with 200 OK once they are used up.
+type otlpCollector struct {
+	*httptest.Server
+
+	responses []otlpResponse
+
+	requests []otlpRequest
+
+	sync.Mutex
+}
+
+// otlpResponse is one canned response of otlpCollector.
+type otlpResponse struct {
+	status     int
+	retryAfter string
+}
+
+// otlpRequest is one export request received by otlpCollector.
+type otlpRequest struct {
+	header http.Header
+	body   map[string]any
+	time   time.Time
+}
+
+func newOtlpCollector(t *testing.T, responses ...otlpResponse) *otlpCollector {
+	collector := &otlpCollector{responses: responses}
+
+	collector.Server = httptest.NewServer(http.HandlerFunc(collector.serveExport))
+	t.Cleanup(collector.Close)
+
+	return collector
+}
+
+func (c *otlpCollector) serveExport(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+
+	var body map[string]any
+	_ = jsoniter.Unmarshal(data, &body)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if r.URL.Path != otlpLogsPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.requests = append(c.requests, otlpRequest{header: r.Header.Clone(), body: body, time: time.Now()})
+
+	if len(c.responses) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+		return
+	}
+
+	response := c.responses[0]
+	c.responses = c.responses[1:]
+
+	if response.retryAfter != "" {
+		w.Header().Set("Retry-After", response.retryAfter)
+	}
+
+	w.WriteHeader(response.status)
+}
+
+func (c *otlpCollector) received() []otlpRequest {
+	c.Lock()
+	defer c.Unlock()
+
+	return append([]otlpRequest(nil), c.requests...)
+}
+
+// waitRequests waits until the collector has received n requests.
+func (c *otlpCollector) waitRequests(t *testing.T, n int, timeout time.Duration) []otlpRequest {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		requests := c.received()
+		if len(requests) >= n {
+			return requests
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("collector received %d requests, want %d", len(requests), n)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// jsonPath returns the element of a decoded JSON document at the given map keys and slice indices.
+func jsonPath(t *testing.T, value any, elements ...any) any {
+	t.Helper()
+
+	for _, element := range elements {
+		switch element := element.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				t.Fatalf("%v is not an object", value)
+			}
+
+			value = object[element]
+		case int:
+			array, ok := value.([]any)
+			if !ok || element >= len(array) {
+				t.Fatalf("%v has no element %d", value, element)
+			}
+
+			value = array[element]
+		}
+	}
+
+	return value
+}
+
+// otlpAttributes returns the attributes of a resource or log record by key.
+func otlpAttributes(t *testing.T, value any) map[string]any {
+	t.Helper()
+
+	attributes := make(map[string]any)
+
+	list, _ := jsonPath(t, value, "attributes").([]any)
+	for _, attribute := range list {
+		key, _ := jsonPath(t, attribute, "key").(string)
+		attributes[key] = jsonPath(t, attribute, "value")
+	}
+
+	return attributes
+}
+
+func TestOtlpExportPayload(t *testing.T) {
+	collector := newOtlpCollector(t)
+
+	otlpWriter, err := newOtlpWriter(collector.URL, map[string]string{"Authorization": "Bearer token"}, time.Second, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("newOtlpWriter: %v", err)
+	}
+
+	records := []string{
+		`{"level":"error","app_name":"billing","time":"2026-01-02T03:04:05Z","message":"charge failed",` +
+			`"trace_id":"0af7651916cd43dd8448eb211c80319c","span_id":"b7ad6b7169203331","trace_sampled":true,` +
+			`"caller":"billing/charge.go:42","error":"card declined","attempt":3}`,
+		`{"level":"info","app_name":"billing","time":"2026-01-02T03:04:06Z","message":"retrying"}`,
+	}
+
+	for _, record := range records {
+		_, _ = otlpWriter.Write([]byte(record + "\n"))
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if requests := collector.received(); len(requests) != 0 {
+		t.Fatalf("collector received %d requests before Close, want 0", len(requests))
+	}
+
+	// Close flushes the records that are still queued.
+	err = otlpWriter.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	requests := collector.received()
+	if len(requests) != 1 {
+		t.Fatalf("collector received %d requests, want 1", len(requests))
+	}
+
+	request := requests[0]
+
+	if got := request.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	if got := request.header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q, want the configured header", got)
+	}
+
+	resourceLogs := jsonPath(t, request.body, "resourceLogs", 0)
+
+	if got := jsonPath(t, otlpAttributes(t, jsonPath(t, resourceLogs, "resource"))["service.name"], "stringValue"); got != "billing" {
+		t.Errorf("service.name = %v, want billing", got)
+	}
+
+	scopeLogs := jsonPath(t, resourceLogs, "scopeLogs", 0)
+
+	if got := jsonPath(t, scopeLogs, "scope", "name"); got != otlpScopeName {
+		t.Errorf("scope name = %v, want %s", got, otlpScopeName)
+	}
+
+	if got := len(jsonPath(t, scopeLogs, "logRecords").([]any)); got != 2 {
+		t.Fatalf("got %d log records, want 2", got)
+	}
+
+	logRecord := jsonPath(t, scopeLogs, "logRecords", 0)
+
+	for key, want := range map[string]any{
+		"severityText":   "ERROR",
+		"severityNumber": float64(17),
+		"timeUnixNano":   "1767323045000000000",
+		"traceId":        "0af7651916cd43dd8448eb211c80319c",
+		"spanId":         "b7ad6b7169203331",
+		"flags":          float64(1),
+	} {
+		if got := jsonPath(t, logRecord, key); got != want {
+			t.Errorf("%s = %v (%T), want %v", key, got, got, want)
+		}
+	}
+
+	if got := jsonPath(t, logRecord, "body", "stringValue"); got != "charge failed" {
+		t.Errorf("body = %v, want the message", got)
+	}
+
+	attributes := otlpAttributes(t, logRecord)
+
+	for key, want := range map[string]map[string]any{
+		"exception.message": {"stringValue": "card declined"},
+		"code.file.path":    {"stringValue": "billing/charge.go"},
+		"code.line.number":  {"intValue": "42"},
+		"attempt":           {"intValue": "3"},
+	} {
+		got, _ := attributes[key].(map[string]any)
+		if len(got) != 1 || jsonString(got) != jsonString(want) {
+			t.Errorf("attribute %s = %v, want %v", key, attributes[key], want)
+		}
+	}
+}
+
+func TestOtlpRetriesThrottledExports(t *testing.T) {
+	collector := newOtlpCollector(t,
+		otlpResponse{status: http.StatusTooManyRequests, retryAfter: "1"},
+		otlpResponse{status: http.StatusServiceUnavailable, retryAfter: "1"},
+	)
+
+	otlpWriter, err := newOtlpWriter(collector.URL, nil, time.Second, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("newOtlpWriter: %v", err)
+	}
+
+	defer otlpWriter.Close()
+
+	_, _ = otlpWriter.Write([]byte(`{"level":"info","app_name":"billing","message":"retried"}` + "\n"))
+
+	requests := collector.waitRequests(t, 3, 10*time.Second)
+
+	for i := 1; i < len(requests); i++ {
+		if gap := requests[i].time.Sub(requests[i-1].time); gap < 900*time.Millisecond {
+			t.Errorf("attempt %d followed the previous one after %v, want the Retry-After delay of 1s", i+1, gap)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for otlpWriter.health().Written != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if health := otlpWriter.health(); health.Written != 1 || health.Dropped != 0 {
+		t.Errorf("written = %d, dropped = %d, want 1 and 0", health.Written, health.Dropped)
+	}
+}
+
+func TestOtlpDropsRejectedExports(t *testing.T) {
+	collector := newOtlpCollector(t, otlpResponse{status: http.StatusBadRequest})
+
+	otlpWriter, err := newOtlpWriter(collector.URL, nil, time.Second, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("newOtlpWriter: %v", err)
+	}
+
+	_, _ = otlpWriter.Write([]byte(`{"level":"info","app_name":"billing","message":"rejected"}` + "\n"))
+
+	otlpWriter.Close()
+
+	if got := len(collector.received()); got != 1 {
+		t.Errorf("collector received %d requests, want 1 without retries", got)
+	}
+
+	if health := otlpWriter.health(); health.Dropped != 1 || health.Failures != 1 {
+		t.Errorf("dropped = %d, failures = %d, want 1 and 1", health.Dropped, health.Failures)
+	}
+}
+
+func jsonString(value any) string {
+	data, _ := jsoniter.Marshal(value)
+
+	return string(data)
+}
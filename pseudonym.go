@@ -0,0 +1,129 @@
+package tlog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/choveylee/tcfg"
+)
+
+const (
+	// PseudonymPrefix starts every pseudonym, which is written as <prefix><key id>:<token>.
+	PseudonymPrefix = "pn:"
+
+	// PseudonymTokenLen is the number of hex digits of the HMAC-SHA256 digest kept in a pseudonym.
+	PseudonymTokenLen = 20
+)
+
+// Pseudonym returns the pseudonym of value under the key identified by keyId: PseudonymPrefix,
+// the key id, a colon, and the first PseudonymTokenLen hex digits of HMAC-SHA256(key, value). The
+// same value always yields the same pseudonym under the same key, so that the events of one user
+// can be correlated without logging the identifier. Pseudonym is the offline helper for
+// investigations: given the key of a key id from [LogPseudonymKeys], it computes the pseudonym of
+// a known identifier to search the logs for.
+func Pseudonym(keyId string, key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+
+	return PseudonymPrefix + keyId + ":" + hex.EncodeToString(mac.Sum(nil))[:PseudonymTokenLen]
+}
+
+// ParsePseudonymKeys parses keys written as in [LogPseudonymKeys]: a comma-separated list of
+// <key id>:<base64 key> pairs. It returns the keys by key id and the key ids in the order listed.
+func ParsePseudonymKeys(value string) (map[string][]byte, []string, error) {
+	keys := make(map[string][]byte)
+
+	var keyIds []string
+
+	for i, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		// Errors name malformed entries by position rather than by content, because an entry
+		// without a key id may be the secret key itself.
+		keyId, encoded, ok := strings.Cut(pair, ":")
+		if !ok || keyId == "" {
+			return nil, nil, fmt.Errorf("invalid pseudonym key at position %d: want <key id>:<base64 key>", i+1)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid pseudonym key %q: %w", keyId, err)
+		}
+
+		if len(key) == 0 {
+			return nil, nil, fmt.Errorf("invalid pseudonym key %q: key is empty", keyId)
+		}
+
+		if _, ok := keys[keyId]; ok {
+			return nil, nil, fmt.Errorf("duplicate pseudonym key %q", keyId)
+		}
+
+		keys[keyId] = key
+		keyIds = append(keyIds, keyId)
+	}
+
+	return keys, keyIds, nil
+}
+
+// pseudonymizer replaces identifiers with pseudonyms under the active key.
+type pseudonymizer struct {
+	keyId string
+	key   []byte
+
+	// fields holds the lower-case names of the fields whose values are always pseudonymized.
+	fields map[string]bool
+}
+
+// loadPseudonymizer reads the pseudonymization configuration through tcfg. It returns nil when no
+// key is configured.
+func loadPseudonymizer() (*pseudonymizer, error) {
+	value := tcfg.DefaultString(tcfg.LocalKey(LogPseudonymKeys), "")
+	if value == "" {
+		return nil, nil
+	}
+
+	keys, keyIds, err := ParsePseudonymKeys(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyIds) == 0 {
+		return nil, errors.New("no pseudonym key is configured")
+	}
+
+	keyId := tcfg.DefaultString(tcfg.LocalKey(LogPseudonymKeyId), keyIds[0])
+
+	key, ok := keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("active pseudonym key %q is not configured", keyId)
+	}
+
+	p := &pseudonymizer{
+		keyId: keyId,
+		key:   key,
+
+		fields: make(map[string]bool),
+	}
+
+	for _, field := range tcfg.DefaultStrings(tcfg.LocalKey(LogPseudonymFields), ",", nil) {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field != "" {
+			p.fields[field] = true
+		}
+	}
+
+	return p, nil
+}
+
+// pseudonym returns the pseudonym of value under the active key.
+func (p *pseudonymizer) pseudonym(value string) string {
+	return Pseudonym(p.keyId, p.key, value)
+}
@@ -0,0 +1,146 @@
+package tlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Keys of the pseudonym tests: base64 of key-2025 and key-2026.
+const (
+	pseudonymTestKey2025 = "a2V5LTIwMjU="
+	pseudonymTestKey2026 = "a2V5LTIwMjY="
+)
+
+func TestPseudonymKnownAnswers(t *testing.T) {
+	for _, test := range []struct {
+		keyId string
+		key   string
+		value string
+		want  string
+	}{
+		{"k2025", "key-2025", "user-42", "pn:k2025:f45ce3166ab5a45fb6f8"},
+		{"k2026", "key-2026", "user-42", "pn:k2026:1c0f4952e997ed9b47d3"},
+		{"k2026", "key-2026", "", "pn:k2026:ac1909ecdad7c8b816d6"},
+	} {
+		got := Pseudonym(test.keyId, []byte(test.key), test.value)
+		if got != test.want {
+			t.Errorf("Pseudonym(%s, %q) = %s, want %s", test.keyId, test.value, got, test.want)
+		}
+
+		if len(got) != len(PseudonymPrefix+test.keyId+":")+PseudonymTokenLen {
+			t.Errorf("Pseudonym(%s, %q) = %s, want a %d digit token", test.keyId, test.value, got, PseudonymTokenLen)
+		}
+	}
+}
+
+func TestParsePseudonymKeys(t *testing.T) {
+	keys, keyIds, err := ParsePseudonymKeys(" k2026:" + pseudonymTestKey2026 + ", ,k2025:" + pseudonymTestKey2025)
+	if err != nil {
+		t.Fatalf("ParsePseudonymKeys: %v", err)
+	}
+
+	if strings.Join(keyIds, ",") != "k2026,k2025" {
+		t.Errorf("key ids = %v, want k2026 and k2025 in the order listed", keyIds)
+	}
+
+	if string(keys["k2026"]) != "key-2026" || string(keys["k2025"]) != "key-2025" {
+		t.Errorf("keys = %q, want the decoded keys", keys)
+	}
+
+	for _, test := range []struct {
+		value string
+		want  string
+	}{
+		{pseudonymTestKey2026, "invalid pseudonym key at position 1"},
+		{"k2026:" + pseudonymTestKey2026 + ",:" + pseudonymTestKey2025, "invalid pseudonym key at position 2"},
+		{"k2026:not base64", `invalid pseudonym key "k2026"`},
+		{"k2026:", `invalid pseudonym key "k2026": key is empty`},
+		{"k2026:" + pseudonymTestKey2026 + ",k2026:" + pseudonymTestKey2025, `duplicate pseudonym key "k2026"`},
+	} {
+		_, _, err := ParsePseudonymKeys(test.value)
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("ParsePseudonymKeys(%q) error = %v, want %s", test.value, err, test.want)
+		}
+
+		// Malformed entries may hold the secret key, which errors must not repeat.
+		if err != nil && (strings.Contains(err.Error(), pseudonymTestKey2026) || strings.Contains(err.Error(), pseudonymTestKey2025)) {
+			t.Errorf("ParsePseudonymKeys(%q) error %q contains a key", test.value, err)
+		}
+	}
+}
+
+func TestLoadPseudonymizerSelectsKey(t *testing.T) {
+	keys := "k2026:" + pseudonymTestKey2026 + ",k2025:" + pseudonymTestKey2025
+
+	t.Setenv(LogPseudonymKeys, keys)
+	t.Setenv(LogPseudonymFields, " User_Id ,")
+
+	pseudonymizer, err := loadPseudonymizer()
+	if err != nil {
+		t.Fatalf("loadPseudonymizer: %v", err)
+	}
+
+	// The first key is active by default.
+	if got := pseudonymizer.pseudonym("user-42"); got != "pn:k2026:1c0f4952e997ed9b47d3" {
+		t.Errorf("pseudonym = %s, want it under k2026", got)
+	}
+
+	if !pseudonymizer.fields["user_id"] || len(pseudonymizer.fields) != 1 {
+		t.Errorf("fields = %v, want user_id", pseudonymizer.fields)
+	}
+
+	// Rolling back to an older key that is still listed.
+	t.Setenv(LogPseudonymKeyId, "k2025")
+
+	pseudonymizer, err = loadPseudonymizer()
+	if err != nil {
+		t.Fatalf("loadPseudonymizer: %v", err)
+	}
+
+	if got := pseudonymizer.pseudonym("user-42"); got != "pn:k2025:f45ce3166ab5a45fb6f8" {
+		t.Errorf("pseudonym = %s, want it under k2025", got)
+	}
+
+	t.Setenv(LogPseudonymKeyId, "k2027")
+
+	_, err = loadPseudonymizer()
+	if err == nil || !strings.Contains(err.Error(), `active pseudonym key "k2027" is not configured`) {
+		t.Errorf("loadPseudonymizer error = %v, want the unknown active key reported", err)
+	}
+
+	for _, value := range []string{",", "k2026"} {
+		t.Setenv(LogPseudonymKeys, value)
+
+		_, err = loadPseudonymizer()
+		if err == nil {
+			t.Errorf("loadPseudonymizer with keys %q succeeded, want an error", value)
+		}
+	}
+}
+
+func TestPseudonymizedFields(t *testing.T) {
+	var buf bytes.Buffer
+
+	tl := newTestRedactingLog(t, &buf)
+	tl.redactor.pseudonymizer = &pseudonymizer{
+		keyId: "k2026",
+		key:   []byte("key-2026"),
+
+		fields: map[string]bool{"user_id": true},
+	}
+
+	newTevent("INFO", tl).Str("User_Id", "user-42").Any("user_id", "user-42").Msg("signed in")
+
+	if strings.Contains(buf.String(), "user-42") {
+		t.Errorf("record %q contains the identifier", buf.String())
+	}
+
+	record := decodeTestDocument(t, buf.Bytes())
+
+	for _, key := range []string{"User_Id", "user_id"} {
+		if got := record[key]; got != "pn:k2026:1c0f4952e997ed9b47d3" {
+			t.Errorf("%s = %v, want the pseudonym of user-42", key, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package tlog
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// connDialTimeout bounds connection attempts of network sinks.
+	connDialTimeout = 5 * time.Second
+	// connWriteTimeout bounds writes to stream connections.
+	connWriteTimeout = 5 * time.Second
+
+	// connMinBackoff and connMaxBackoff bound the delay between reconnection attempts.
+	connMinBackoff = time.Second
+	connMaxBackoff = time.Minute
+)
+
+// reconnectingConn holds the connection of a network sink. A failed connection is re-established
+// on a later send, with exponential backoff between attempts; sends while waiting fail at once.
+// It is not safe for concurrent use, so the owning writer serializes sends with its own lock.
+type reconnectingConn struct {
+	// dial connects to the server; describe names the server in errors.
+	dial     func() (net.Conn, error)
+	describe func() string
+
+	conn net.Conn
+
+	// failures counts consecutive connection failures; nextDial is the earliest time of the next attempt.
+	failures int
+	nextDial time.Time
+}
+
+// newReconnectingConn returns a reconnectingConn that dials address on network.
+func newReconnectingConn(network, address string) reconnectingConn {
+	return reconnectingConn{
+		dial: func() (net.Conn, error) {
+			return net.DialTimeout(network, address, connDialTimeout)
+		},
+		describe: func() string {
+			return network + "://" + address
+		},
+	}
+}
+
+// send calls write with the connection, dialing when necessary and reconnecting once when the
+// existing connection fails.
+func (c *reconnectingConn) send(write func(conn net.Conn) error) error {
+	if c.conn != nil {
+		err := write(c.conn)
+		if err == nil {
+			return nil
+		}
+
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	if time.Now().Before(c.nextDial) {
+		return fmt.Errorf("%s is unavailable; reconnecting after %s", c.describe(), c.nextDial.Format(time.RFC3339))
+	}
+
+	conn, err := c.dial()
+	if err == nil {
+		err = write(conn)
+		if err != nil {
+			conn.Close()
+		}
+	}
+
+	if err != nil {
+		c.failures++
+		c.nextDial = time.Now().Add(backoffDelay(c.failures, connMinBackoff, connMaxBackoff))
+
+		return fmt.Errorf("cannot send to %s: %w", c.describe(), err)
+	}
+
+	c.conn = conn
+	c.failures = 0
+	c.nextDial = time.Time{}
+
+	return nil
+}
+
+// Close closes the connection.
+func (c *reconnectingConn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+
+	return err
+}
@@ -0,0 +1,57 @@
+package tlog
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconnectingConnBacksOff(t *testing.T) {
+	var dials int
+
+	conn := reconnectingConn{
+		dial: func() (net.Conn, error) {
+			dials++
+
+			return nil, errors.New("connection refused")
+		},
+		describe: func() string { return "tcp://collector:514" },
+	}
+
+	write := func(net.Conn) error { return nil }
+
+	err := conn.send(write)
+	if err == nil || !strings.Contains(err.Error(), "cannot send to tcp://collector:514") {
+		t.Fatalf("first send error = %v, want the dial error", err)
+	}
+
+	err = conn.send(write)
+	if err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Errorf("second send error = %v, want the server reported unavailable", err)
+	}
+
+	if dials != 1 {
+		t.Errorf("dials = %d, want 1: the server was dialed during the backoff", dials)
+	}
+
+	// Skip the backoff delay and let the next dial succeed.
+	conn.nextDial = time.Time{}
+
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn.dial = func() (net.Conn, error) { return client, nil }
+
+	err = conn.send(write)
+	if err != nil {
+		t.Fatalf("send after the backoff: %v", err)
+	}
+
+	if conn.conn != client || conn.failures != 0 {
+		t.Errorf("conn = %v, failures = %d, want the new connection kept and the failures reset", conn.conn, conn.failures)
+	}
+
+	conn.Close()
+}
@@ -0,0 +1,522 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/choveylee/tcfg"
+	"github.com/json-iterator/go"
+)
+
+const (
+	// RedactModeFull replaces sensitive values with RedactedValue.
+	RedactModeFull = "full"
+	// RedactModePartial masks sensitive values with asterisks but keeps their last four letters or
+	// digits, or the first letter and the domain of email addresses, so that they stay recognizable.
+	RedactModePartial = "partial"
+	// RedactModePseudonymize replaces sensitive values with their [Pseudonym] under the active key
+	// of [LogPseudonymKeys], so that events about the same value can still be correlated.
+	RedactModePseudonymize = "pseudonymize"
+
+	// RedactedValue replaces values redacted in [RedactModeFull].
+	RedactedValue = "[REDACTED]"
+
+	// Names of the built-in redaction patterns accepted by [LogRedactPatterns].
+	RedactPatternBearer = "bearer"
+	RedactPatternJwt    = "jwt"
+	RedactPatternEmail  = "email"
+	RedactPatternPan    = "pan"
+
+	// redactPartialKeep is the number of trailing letters or digits kept by RedactModePartial.
+	redactPartialKeep = 4
+)
+
+// DefaultRedactFields lists the field names whose values are redacted by default.
+var DefaultRedactFields = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"access_token",
+	"refresh_token",
+	"api_key",
+	"apikey",
+	"authorization",
+	"cookie",
+}
+
+// DefaultRedactPatterns lists the built-in redaction patterns enabled by default.
+var DefaultRedactPatterns = []string{
+	RedactPatternBearer,
+	RedactPatternJwt,
+	RedactPatternEmail,
+	RedactPatternPan,
+}
+
+// RedactRule is a custom redaction rule configured with [LogRedactRules]. Pattern is a regular
+// expression in RE2 syntax; when it has a capturing group, only the text of the first group is
+// redacted. Mode is [RedactModeFull], [RedactModePartial], or [RedactModePseudonymize]; an empty
+// Mode uses [LogRedactMode].
+type RedactRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Mode    string `json:"mode"`
+}
+
+// redactRule is a compiled redaction rule.
+type redactRule struct {
+	name    string
+	pattern *regexp.Regexp
+	mode    string
+
+	// group is the capturing group whose text is redacted; 0 redacts the whole match.
+	group int
+
+	// valid reports whether a match is sensitive; nil accepts all matches.
+	valid func(match string) bool
+}
+
+// builtinRedactRules holds the built-in patterns by name.
+var builtinRedactRules = map[string]redactRule{
+	RedactPatternBearer: {
+		pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+		group:   1,
+	},
+	RedactPatternJwt: {
+		pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	RedactPatternEmail: {
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	RedactPatternPan: {
+		pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid:   luhnValid,
+	},
+}
+
+// redactor masks sensitive values in the detail, error, and typed fields of events and in the
+// messages sent to Sentry, and replaces the values of pseudonymized fields with pseudonyms. A nil
+// redactor leaves all values unchanged.
+type redactor struct {
+	// fields holds the lower-case names of the fields whose values are always redacted.
+	fields map[string]bool
+
+	// rules are applied in order; the rule for sensitive field names in free text comes last.
+	rules []redactRule
+
+	// pseudonymizer computes pseudonyms; nil when no pseudonym key is configured.
+	pseudonymizer *pseudonymizer
+}
+
+// loadRedactor reads the redaction and pseudonymization configuration through tcfg. It returns
+// nil when both are disabled.
+func loadRedactor() (*redactor, error) {
+	pseudonymizer, err := loadPseudonymizer()
+	if err != nil {
+		return nil, err
+	}
+
+	if !tcfg.DefaultBool(tcfg.LocalKey(LogRedactEnable), false) {
+		if pseudonymizer == nil {
+			return nil, nil
+		}
+
+		return &redactor{fields: make(map[string]bool), pseudonymizer: pseudonymizer}, nil
+	}
+
+	mode := strings.ToLower(tcfg.DefaultString(tcfg.LocalKey(LogRedactMode), RedactModeFull))
+	fields := tcfg.DefaultStrings(tcfg.LocalKey(LogRedactFields), ",", DefaultRedactFields)
+	patterns := tcfg.DefaultStrings(tcfg.LocalKey(LogRedactPatterns), ",", DefaultRedactPatterns)
+
+	var rules []RedactRule
+
+	if value := tcfg.DefaultString(tcfg.LocalKey(LogRedactRules), ""); value != "" {
+		err := jsoniter.Unmarshal([]byte(value), &rules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rules %q: %w", value, err)
+		}
+	}
+
+	return newRedactor(mode, fields, patterns, rules, pseudonymizer)
+}
+
+// newRedactor constructs a redactor that redacts the values of fields and the matches of the
+// built-in patterns and custom rules, masking them in mode unless a rule sets its own mode.
+// Pseudonyms are computed by pseudonymizer, which may be nil unless a mode requires it.
+func newRedactor(mode string, fields, patterns []string, rules []RedactRule, pseudonymizer *pseudonymizer) (*redactor, error) {
+	validMode := func(mode string) error {
+		switch mode {
+		case RedactModeFull, RedactModePartial:
+		case RedactModePseudonymize:
+			if pseudonymizer == nil {
+				return errors.New("pseudonymization requires a pseudonym key")
+			}
+		default:
+			return errors.New("unknown mode")
+		}
+
+		return nil
+	}
+
+	if err := validMode(mode); err != nil {
+		return nil, fmt.Errorf("invalid redaction mode %q: %w", mode, err)
+	}
+
+	r := &redactor{
+		fields: make(map[string]bool),
+
+		pseudonymizer: pseudonymizer,
+	}
+
+	for _, name := range patterns {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		rule, ok := builtinRedactRules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction pattern %q", name)
+		}
+
+		rule.name = name
+		rule.mode = mode
+
+		r.rules = append(r.rules, rule)
+	}
+
+	for _, customRule := range rules {
+		pattern, err := regexp.Compile(customRule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of redaction rule %q: %w", customRule.Name, err)
+		}
+
+		ruleMode := strings.ToLower(customRule.Mode)
+		if ruleMode == "" {
+			ruleMode = mode
+		}
+
+		if err := validMode(ruleMode); err != nil {
+			return nil, fmt.Errorf("invalid mode %q of redaction rule %q: %w", customRule.Mode, customRule.Name, err)
+		}
+
+		rule := redactRule{
+			name:    customRule.Name,
+			pattern: pattern,
+			mode:    ruleMode,
+		}
+
+		if pattern.NumSubexp() > 0 {
+			rule.group = 1
+		}
+
+		r.rules = append(r.rules, rule)
+	}
+
+	var names []string
+
+	for _, field := range fields {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+
+		r.fields[field] = true
+		names = append(names, regexp.QuoteMeta(field))
+	}
+
+	if len(names) > 0 {
+		// Matches key=value, key: value, and "key":"value" pairs of the sensitive fields in free
+		// text, such as a detail written as "password=secret". The value includes the scheme of
+		// authorization values such as "Bearer <token>".
+		r.rules = append(r.rules, redactRule{
+			name: "fields",
+			pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(names, "|") +
+				`)\b"?\s*[:=]\s*"?((?:(?:bearer|basic)\s+)?[^\s"',;&}]+)`),
+			mode:  RedactModeFull,
+			group: 1,
+		})
+	}
+
+	return r, nil
+}
+
+// sensitive reports whether the values of the field key are always redacted.
+func (r *redactor) sensitive(key string) bool {
+	return r != nil && r.fields[strings.ToLower(key)]
+}
+
+// redactString returns value with the matches of all rules masked.
+func (r *redactor) redactString(value string) string {
+	if r == nil || value == "" {
+		return value
+	}
+
+	for _, rule := range r.rules {
+		value = rule.apply(value, r.pseudonymizer)
+	}
+
+	return value
+}
+
+// pseudonymous reports whether the values of the field key are replaced with pseudonyms.
+func (r *redactor) pseudonymous(key string) bool {
+	return r != nil && r.pseudonymizer != nil && r.pseudonymizer.fields[strings.ToLower(key)]
+}
+
+// pseudonym returns the pseudonym of value, or RedactedValue when no pseudonym key is configured.
+func (r *redactor) pseudonym(value string) string {
+	if r == nil || r.pseudonymizer == nil {
+		return RedactedValue
+	}
+
+	return r.pseudonymizer.pseudonym(value)
+}
+
+// redactField returns the value of the string field key: its pseudonym when key is
+// pseudonymized, redacted as a whole when key is sensitive, and redacted by the rules otherwise.
+func (r *redactor) redactField(key, value string) string {
+	if r.pseudonymous(key) {
+		return r.pseudonym(value)
+	}
+
+	if r.sensitive(key) {
+		return RedactedValue
+	}
+
+	return r.redactString(value)
+}
+
+// redactNumber returns value, a number whose decimal text is text, unchanged unless the rules
+// match text, as they do for a card number stored as an integer; the redacted text is returned
+// then.
+func (r *redactor) redactNumber(text string, value any) any {
+	redacted := r.redactString(text)
+	if redacted == text {
+		return value
+	}
+
+	return redacted
+}
+
+// redactValue returns a copy of a value decoded from JSON in which sensitive object members are
+// redacted as a whole and all strings and numbers are redacted by the rules.
+func (r *redactor) redactValue(value any) any {
+	if r == nil {
+		return value
+	}
+
+	switch value := value.(type) {
+	case string:
+		return r.redactString(value)
+	case json.Number:
+		return r.redactNumber(value.String(), value)
+	case []any:
+		redacted := make([]any, len(value))
+		for i, element := range value {
+			redacted[i] = r.redactValue(element)
+		}
+
+		return redacted
+	case map[string]any:
+		redacted := make(map[string]any, len(value))
+		for key, member := range value {
+			switch {
+			case r.pseudonymous(key):
+				redacted[key] = r.pseudonym(pseudonymText(member))
+			case r.sensitive(key):
+				redacted[key] = RedactedValue
+			default:
+				redacted[key] = r.redactValue(member)
+			}
+		}
+
+		return redacted
+	default:
+		return value
+	}
+}
+
+// decodeJsonValue decodes one JSON value for redactValue, keeping numbers as json.Number.
+func decodeJsonValue(data []byte) (any, error) {
+	var decoded any
+
+	decoder := jsoniter.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, nil
+}
+
+// pseudonymText returns the text whose pseudonym replaces value: strings as they are, other
+// values as their JSON encoding.
+func pseudonymText(value any) string {
+	if text, ok := value.(string); ok {
+		return text
+	}
+
+	data, err := jsoniter.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(data)
+}
+
+// apply masks the matches of the rule in value, computing pseudonyms with pseudonymizer.
+func (rule redactRule) apply(value string, pseudonymizer *pseudonymizer) string {
+	matches := rule.pattern.FindAllStringSubmatchIndex(value, -1)
+	if matches == nil {
+		return value
+	}
+
+	var b strings.Builder
+
+	last := 0
+
+	for _, match := range matches {
+		start, end := match[2*rule.group], match[2*rule.group+1]
+		if start < 0 || start < last {
+			continue
+		}
+
+		text := value[start:end]
+		if rule.valid != nil && !rule.valid(text) {
+			continue
+		}
+
+		b.WriteString(value[last:start])
+		b.WriteString(rule.mask(text, pseudonymizer))
+
+		last = end
+	}
+
+	b.WriteString(value[last:])
+
+	return b.String()
+}
+
+// mask returns the masked form of text in the mode of the rule.
+func (rule redactRule) mask(text string, pseudonymizer *pseudonymizer) string {
+	if rule.mode == RedactModePseudonymize && pseudonymizer != nil {
+		return pseudonymizer.pseudonym(text)
+	}
+
+	if rule.mode != RedactModePartial {
+		return RedactedValue
+	}
+
+	if rule.name == RedactPatternEmail {
+		return maskEmail(text)
+	}
+
+	return maskPartial(text, redactPartialKeep)
+}
+
+// maskPartial replaces the letters and digits of text with asterisks, except the last keep of
+// them; separators are kept. Values with no more than 2*keep letters and digits are masked
+// entirely.
+func maskPartial(text string, keep int) string {
+	runes := []rune(text)
+
+	var count int
+	for _, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			count++
+		}
+	}
+
+	if count <= 2*keep {
+		keep = 0
+	}
+
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			continue
+		}
+
+		if keep > 0 {
+			keep--
+			continue
+		}
+
+		runes[i] = '*'
+	}
+
+	return string(runes)
+}
+
+// maskEmail keeps the first character of the local part and the domain of an email address.
+func maskEmail(text string) string {
+	local, domain, ok := strings.Cut(text, "@")
+	if !ok || local == "" {
+		return maskPartial(text, redactPartialKeep)
+	}
+
+	first := []rune(local)[0]
+
+	return string(first) + "***@" + domain
+}
+
+// luhnValid reports whether the digits of text, ignoring spaces and dashes, form a number of 13
+// to 19 digits that passes the Luhn check used by payment card numbers.
+func luhnValid(text string) bool {
+	var digits []int
+
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, int(r-'0'))
+		case r == ' ' || r == '-':
+		default:
+			return false
+		}
+	}
+
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	var sum int
+
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := digits[i]
+
+		if (len(digits)-1-i)%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+
+		sum += digit
+	}
+
+	return sum%10 == 0
+}
+
+// redactedError reports the redacted message of an error to span events, keeping the original
+// error available through Unwrap.
+type redactedError struct {
+	msg string
+	err error
+}
+
+// Error implements error.
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the original error.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,84 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func newTestRedactingLog(t *testing.T, buf *bytes.Buffer) *Tlog {
+	t.Helper()
+
+	redactor, err := newRedactor(RedactModeFull, DefaultRedactFields, DefaultRedactPatterns, nil, nil)
+	if err != nil {
+		t.Fatalf("newRedactor: %v", err)
+	}
+
+	tl := newTlog("billing", zerolog.MultiLevelWriter(buf), &fieldConfig{})
+	tl.redactor = redactor
+
+	return tl
+}
+
+func TestRedactNumbers(t *testing.T) {
+	var buf bytes.Buffer
+
+	tl := newTestRedactingLog(t, &buf)
+
+	type payment struct {
+		Pan    uint64 `json:"pan"`
+		Amount int    `json:"amount"`
+	}
+
+	newTevent("INFO", tl).
+		Any("card", int64(4111111111111111)).
+		Any("payment", map[string]any{"pan": 4111111111111111, "amount": 1250}).
+		Object("object", payment{Pan: 4111111111111111, Amount: 1250}).
+		Msg("charged")
+
+	if strings.Contains(buf.String(), "4111111111111111") {
+		t.Errorf("record %q contains the card number", buf.String())
+	}
+
+	record := decodeTestDocument(t, buf.Bytes())
+
+	if got := record["card"]; got != RedactedValue {
+		t.Errorf("card = %v, want %s", got, RedactedValue)
+	}
+
+	for _, key := range []string{"payment", "object"} {
+		object, _ := record[key].(map[string]any)
+
+		if got := object["pan"]; got != RedactedValue {
+			t.Errorf("%s.pan = %v, want %s", key, got, RedactedValue)
+		}
+
+		// Numbers that match no rule keep their type.
+		if got := object["amount"]; got != json.Number("1250") {
+			t.Errorf("%s.amount = %v (%T), want the number 1250", key, got, got)
+		}
+	}
+}
+
+func TestRedactAnyUnencodableValue(t *testing.T) {
+	var buf bytes.Buffer
+
+	tl := newTestRedactingLog(t, &buf)
+
+	newTevent("INFO", tl).
+		Any("callback", map[string]any{"token": "secret-token", "notify": make(chan int)}).
+		Msg("registered")
+
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Errorf("record %q contains the token", buf.String())
+	}
+
+	record := decodeTestDocument(t, buf.Bytes())
+
+	if got := record["callback"]; got != RedactedValue {
+		t.Errorf("callback = %v, want %s for a value that cannot be encoded", got, RedactedValue)
+	}
+}
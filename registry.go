@@ -0,0 +1,442 @@
+package tlog
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// SinkFactory constructs the writer of an output from its URL spec, such as
+// file:///var/log/app.log?size=200. The writer receives JSON records as written by zerolog and may
+// implement zerolog.LevelWriter and io.Closer. The parameters handled by the router itself
+// (min_level, max_level, format, include, and exclude) have been removed from the query.
+type SinkFactory func(spec *url.URL) (io.Writer, error)
+
+var (
+	// sinkFactories maps URL schemes to the factories of their sinks.
+	sinkFactories = map[string]SinkFactory{
+		"file":        newFileSink,
+		"stdout":      newStdoutSink,
+		"stderr":      newStderrSink,
+		"syslog+udp":  newSyslogSink,
+		"syslog+tcp":  newSyslogSink,
+		"syslog+tls":  newSyslogSink,
+		"syslog+unix": newSyslogSink,
+		"http":        newHttpSink,
+		"https":       newHttpSink,
+		"unix":        newUnixSink,
+	}
+
+	sinkFactoriesMu sync.RWMutex
+)
+
+// outputSpecStart matches the scheme that starts an output spec.
+var outputSpecStart = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*://`)
+
+// RegisterSink makes the sink constructed by factory available to output specs with scheme. It
+// panics when scheme is already registered or factory is nil, like database/sql.Register.
+//
+// Because packages that import tlog are initialized after it, specs naming a scheme that is not
+// registered yet when tlog reads its configuration are resolved on their first write.
+func RegisterSink(scheme string, factory SinkFactory) {
+	sinkFactoriesMu.Lock()
+	defer sinkFactoriesMu.Unlock()
+
+	if factory == nil {
+		panic("tlog: RegisterSink factory is nil")
+	}
+
+	scheme = strings.ToLower(scheme)
+
+	if _, ok := sinkFactories[scheme]; ok {
+		panic("tlog: RegisterSink called twice for scheme " + scheme)
+	}
+
+	sinkFactories[scheme] = factory
+}
+
+// lookupSink returns the factory registered for scheme.
+func lookupSink(scheme string) (SinkFactory, bool) {
+	sinkFactoriesMu.RLock()
+	defer sinkFactoriesMu.RUnlock()
+
+	factory, ok := sinkFactories[strings.ToLower(scheme)]
+
+	return factory, ok
+}
+
+// splitOutputSpecs splits a comma-separated list of output specs. A comma only separates two
+// specs when a scheme follows it, so that query values such as include=a,b keep their commas.
+func splitOutputSpecs(value string) []string {
+	var specs []string
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+
+		if len(specs) > 0 && !outputSpecStart.MatchString(part) {
+			specs[len(specs)-1] += "," + part
+			continue
+		}
+
+		if part != "" {
+			specs = append(specs, part)
+		}
+	}
+
+	return specs
+}
+
+// newSpecRouteWriter constructs the route of one output spec. Errors name the spec.
+func newSpecRouteWriter(spec string, fields *fieldConfig) (*routeWriter, error) {
+	specUrl, err := url.Parse(spec)
+	if err != nil || specUrl.Scheme == "" {
+		return nil, fmt.Errorf("output %q: invalid spec", spec)
+	}
+
+	query := specUrl.Query()
+
+	outputConfig := OutputConfig{
+		Type: specUrl.Scheme,
+
+		MinLevel: query.Get("min_level"),
+		MaxLevel: query.Get("max_level"),
+
+		Format: query.Get("format"),
+	}
+
+	for _, key := range []string{"include", "exclude"} {
+		var values []string
+		for _, value := range query[key] {
+			values = append(values, strings.Split(value, ",")...)
+		}
+
+		if key == "include" {
+			outputConfig.Include = values
+		} else {
+			outputConfig.Exclude = values
+		}
+	}
+
+	for _, key := range []string{"min_level", "max_level", "format", "include", "exclude"} {
+		query.Del(key)
+	}
+
+	specUrl.RawQuery = query.Encode()
+
+	route, err := newFilteredRouteWriter(outputConfig)
+	if err != nil {
+		return nil, fmt.Errorf("output %q: %w", spec, err)
+	}
+
+	var out io.Writer
+
+	factory, ok := lookupSink(specUrl.Scheme)
+	if ok {
+		out, err = factory(specUrl)
+		if err != nil {
+			return nil, fmt.Errorf("output %q: %w", spec, err)
+		}
+	} else {
+		out = &lazySink{spec: spec, specUrl: specUrl}
+	}
+
+	if closer, ok := out.(io.Closer); ok {
+		route.closer = closer
+	}
+
+	format := outputConfig.Format
+	if format == "" {
+		format = LogFormatJson
+	}
+
+	route.out = newFormatWriter(format, out, fields)
+
+	return route, nil
+}
+
+// lazySink resolves the factory of its scheme on the first write, for schemes registered after
+// tlog has read its configuration.
+type lazySink struct {
+	spec    string
+	specUrl *url.URL
+
+	out io.Writer
+	err error
+
+	once sync.Once
+}
+
+// Write implements io.Writer.
+func (s *lazySink) Write(p []byte) (int, error) {
+	var resolved bool
+
+	s.once.Do(func() {
+		resolved = true
+
+		factory, ok := lookupSink(s.specUrl.Scheme)
+		if !ok {
+			s.err = fmt.Errorf("output %q: no sink is registered for scheme %q", s.spec, s.specUrl.Scheme)
+		} else {
+			s.out, s.err = factory(s.specUrl)
+			if s.err != nil {
+				s.err = fmt.Errorf("output %q: %w", s.spec, s.err)
+			}
+		}
+	})
+
+	// The error is only reported by the write that resolved the sink; later records are dropped.
+	if s.err != nil {
+		if resolved {
+			return 0, s.err
+		}
+
+		return len(p), nil
+	}
+
+	return s.out.Write(p)
+}
+
+// Close closes the resolved sink.
+func (s *lazySink) Close() error {
+	if closer, ok := s.out.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// newFileSink constructs a RotateWriter from a spec such as
+// file:///var/log/app.log?size=200&rotate=24&expired=7&count=10&compress=gzip&fallback=stderr.
+// The size is in megabytes, rotate in hours, and expired in days; compress accepts gzip, true, or
+// false, and fallback the values of [LogFileFallback]. A spec with a host, such as
+// file://logs/app.log, names a relative path.
+func newFileSink(spec *url.URL) (io.Writer, error) {
+	filePath := spec.Host + spec.Path
+	if filePath == "" {
+		filePath = spec.Opaque
+	}
+
+	if filePath == "" {
+		return nil, errors.New("file path is empty")
+	}
+
+	query := spec.Query()
+
+	var outputConfig OutputConfig
+
+	for key, target := range map[string]**int{
+		"size":    &outputConfig.Size,
+		"rotate":  &outputConfig.Rotate,
+		"expired": &outputConfig.Expired,
+		"count":   &outputConfig.Count,
+	} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("invalid %s %q", key, value)
+		}
+
+		*target = &number
+	}
+
+	if value := query.Get("compress"); value != "" {
+		var compress bool
+
+		switch strings.ToLower(value) {
+		case "gzip", "true", "1":
+			compress = true
+		case "false", "0", "none":
+		default:
+			return nil, fmt.Errorf("unsupported compress %q: must be gzip, true, or false", value)
+		}
+
+		outputConfig.Compress = &compress
+	}
+
+	outputConfig.Path = filePath
+	outputConfig.Fallback = query.Get("fallback")
+
+	return newOutputRotateWriter(outputConfig, ""), nil
+}
+
+// newStdoutSink returns standard output, which is not closed with the logger.
+func newStdoutSink(_ *url.URL) (io.Writer, error) {
+	return noCloseWriter{Writer: os.Stdout}, nil
+}
+
+// newStderrSink returns standard error, which is not closed with the logger.
+func newStderrSink(_ *url.URL) (io.Writer, error) {
+	return noCloseWriter{Writer: os.Stderr}, nil
+}
+
+// newSyslogSink constructs a SyslogWriter from a spec such as syslog+udp://127.0.0.1:514 or
+// syslog+unix:///dev/log. The facility parameter sets the facility, rfc selects 5424 or 3164, and
+// ca names a CA file for syslog+tls.
+func newSyslogSink(spec *url.URL) (io.Writer, error) {
+	network := strings.TrimPrefix(strings.ToLower(spec.Scheme), "syslog+")
+
+	address := spec.Host
+	if network == "unix" {
+		address = spec.Path
+	}
+
+	query := spec.Query()
+
+	facilityName := query.Get("facility")
+	if facilityName == "" {
+		facilityName = "USER"
+	}
+
+	facility, err := parseSyslogFacility(facilityName)
+	if err != nil {
+		return nil, err
+	}
+
+	format := SyslogFormatRFC5424
+	if rfc := query.Get("rfc"); rfc != "" {
+		format = "RFC" + rfc
+
+		if format != SyslogFormatRFC5424 && format != SyslogFormatRFC3164 {
+			return nil, fmt.Errorf("unsupported rfc %q: must be 5424 or 3164", rfc)
+		}
+	}
+
+	var tlsConfig *tls.Config
+
+	if network == "tls" {
+		tlsConfig, err = newSyslogTlsConfig(address, query.Get("ca"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newSyslogWriter(network, address, tlsConfig, facility, format), nil
+}
+
+// newHttpSink constructs a WebhookWriter that posts batches of records as JSON arrays to the spec
+// URL. The batch_size, batch_interval, and timeout parameters configure batching; all other
+// parameters are kept in the request URL.
+func newHttpSink(spec *url.URL) (io.Writer, error) {
+	query := spec.Query()
+
+	batchSize, err := parseSpecInt(query, "batch_size")
+	if err != nil {
+		return nil, err
+	}
+
+	batchInterval, err := parseSpecDuration(query, "batch_interval")
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := parseSpecDuration(query, "timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{"batch_size", "batch_interval", "timeout"} {
+		query.Del(key)
+	}
+
+	endpointUrl := *spec
+	endpointUrl.RawQuery = query.Encode()
+
+	return newWebhookWriter(endpointUrl.String(), zerolog.TraceLevel, DefaultWebhookTemplate, nil,
+		timeout, batchSize, batchInterval, 0, 0)
+}
+
+// newUnixSink constructs a writer that sends newline-delimited records to the unix stream socket
+// of a spec such as unix:///run/collector.sock.
+func newUnixSink(spec *url.URL) (io.Writer, error) {
+	if spec.Path == "" {
+		return nil, errors.New("socket path is empty")
+	}
+
+	return newStreamWriter("unix", spec.Path), nil
+}
+
+// parseSpecInt parses the non-negative integer parameter key, returning zero when it is absent.
+func parseSpecInt(query url.Values, key string) (int, error) {
+	value := query.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+
+	return number, nil
+}
+
+// parseSpecDuration parses the duration parameter key, returning zero when it is absent.
+func parseSpecDuration(query url.Values, key string) (time.Duration, error) {
+	value := query.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+
+	return duration, nil
+}
+
+// streamWriter writes records to a stream socket. A failed connection is re-established on a
+// later write, with exponential backoff between attempts; records written while waiting are
+// dropped.
+type streamWriter struct {
+	conn reconnectingConn
+
+	sync.Mutex
+}
+
+// newStreamWriter constructs a streamWriter. The connection is established on the first write.
+func newStreamWriter(network, address string) *streamWriter {
+	return &streamWriter{conn: newReconnectingConn(network, address)}
+}
+
+// Write implements io.Writer, reconnecting once when the existing connection fails.
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	err := w.conn.send(func(conn net.Conn) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(connWriteTimeout))
+
+		_, err := conn.Write(p)
+
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("tlog: %w", err)
+	}
+
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (w *streamWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.conn.Close()
+}
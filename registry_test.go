@@ -0,0 +1,164 @@
+package tlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memorySinks holds the buffers of the memory:// test scheme by host.
+var memorySinks sync.Map
+
+func init() {
+	RegisterSink("memory", func(spec *url.URL) (io.Writer, error) {
+		buffer, _ := memorySinks.LoadOrStore(spec.Host, &syncBuffer{})
+
+		return buffer.(*syncBuffer), nil
+	})
+
+	RegisterSink("failing", func(spec *url.URL) (io.Writer, error) {
+		return nil, errors.New("collector is unreachable")
+	})
+}
+
+// memorySink returns the buffer of the memory:// sink with the given host.
+func memorySink(host string) *syncBuffer {
+	buffer, _ := memorySinks.LoadOrStore(host, &syncBuffer{})
+
+	return buffer.(*syncBuffer)
+}
+
+func TestSpecRouteWriterDefaultsToJson(t *testing.T) {
+	fields := &fieldConfig{names: map[string]string{fieldLevel: "severity", fieldMessage: "msg"}}
+
+	route, err := newSpecRouteWriter("memory://default-format", fields)
+	if err != nil {
+		t.Fatalf("newSpecRouteWriter: %v", err)
+	}
+
+	_, err = route.Write([]byte(`{"level":"info","message":"started"}` + "\n"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	record := decodeTestDocument(t, []byte(memorySink("default-format").String()))
+
+	if record["severity"] != "info" || record["msg"] != "started" {
+		t.Errorf("record = %v, want the level and message renamed", record)
+	}
+}
+
+func TestFileSinkRejectsUnsupportedCompression(t *testing.T) {
+	spec := "file://" + t.TempDir() + "/app.log?compress=zstd"
+
+	_, err := newSpecRouteWriter(spec, &fieldConfig{})
+	if err == nil || !strings.Contains(err.Error(), spec) || !strings.Contains(err.Error(), "must be gzip, true, or false") {
+		t.Errorf("newSpecRouteWriter error = %v, want the spec and the supported values", err)
+	}
+}
+
+func TestSplitOutputSpecs(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"stderr://", []string{"stderr://"}},
+		{"file:///var/log/app.log, stderr://?format=CONSOLE", []string{"file:///var/log/app.log", "stderr://?format=CONSOLE"}},
+		{"stdout://?include=user,order&exclude=token,stderr://", []string{"stdout://?include=user,order&exclude=token", "stderr://"}},
+		{" syslog+udp://127.0.0.1:514 ,\tunix:///run/collector.sock ", []string{"syslog+udp://127.0.0.1:514", "unix:///run/collector.sock"}},
+	} {
+		if got := splitOutputSpecs(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitOutputSpecs(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestSpecRouteWriterErrors(t *testing.T) {
+	for _, test := range []struct {
+		spec string
+		want string
+	}{
+		{"app.log", "invalid spec"},
+		{"memory://errors?min_level=LOUD", "LOUD"},
+		{"memory://errors?max_level=quiet", "quiet"},
+		{"file://", "file path is empty"},
+		{"file:///var/log/app.log?size=-1", `invalid size "-1"`},
+		{"file:///var/log/app.log?rotate=daily", `invalid rotate "daily"`},
+		{"file:///var/log/app.log?compress=lz4", `unsupported compress "lz4"`},
+		{"syslog+udp://127.0.0.1:514?facility=MAIL2", `invalid facility "MAIL2"`},
+		{"syslog+udp://127.0.0.1:514?rfc=3339", `unsupported rfc "3339"`},
+		{"http://collector/logs?batch_size=many", `invalid batch_size "many"`},
+		{"http://collector/logs?timeout=-1s", `invalid timeout "-1s"`},
+		{"unix://", "socket path is empty"},
+		{"failing://collector", "collector is unreachable"},
+	} {
+		_, err := newSpecRouteWriter(test.spec, &fieldConfig{})
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("output %q", test.spec)) ||
+			!strings.Contains(err.Error(), test.want) {
+			t.Errorf("newSpecRouteWriter(%q) error = %v, want the spec and %q", test.spec, err, test.want)
+		}
+	}
+}
+
+func TestRegisterSinkPanics(t *testing.T) {
+	factory := func(*url.URL) (io.Writer, error) { return io.Discard, nil }
+
+	for _, test := range []struct {
+		name    string
+		scheme  string
+		factory SinkFactory
+	}{
+		{"duplicate", "file", factory},
+		{"duplicate in another case", "MEMORY", factory},
+		{"nil factory", "discard", nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterSink(%q) did not panic", test.scheme)
+				}
+			}()
+
+			RegisterSink(test.scheme, test.factory)
+		})
+	}
+
+	if _, ok := lookupSink("discard"); ok {
+		t.Error("nil factory was registered")
+	}
+}
+
+func TestLazySinkReportsOpenFailureOnce(t *testing.T) {
+	for _, test := range []struct {
+		spec string
+		want string
+	}{
+		{"unregistered://collector", `no sink is registered for scheme "unregistered"`},
+		{"failing://collector", "collector is unreachable"},
+	} {
+		specUrl, _ := url.Parse(test.spec)
+
+		sink := &lazySink{spec: test.spec, specUrl: specUrl}
+
+		_, err := sink.Write([]byte("first\n"))
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("output %q", test.spec)) ||
+			!strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: first Write error = %v, want the spec and %q", test.spec, err, test.want)
+		}
+
+		n, err := sink.Write([]byte("second\n"))
+		if n != len("second\n") || err != nil {
+			t.Errorf("%s: second Write = %d, %v, want the record dropped without an error", test.spec, n, err)
+		}
+
+		if err := sink.Close(); err != nil {
+			t.Errorf("%s: Close: %v", test.spec, err)
+		}
+	}
+}
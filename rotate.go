@@ -4,7 +4,6 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"sort"
@@ -26,6 +25,19 @@ const (
 	DefaultMaxSize = 100
 	// DefaultRotateHours is the fallback time-rotation interval, in hours, when configuration is unset or invalid.
 	DefaultRotateHours = 1
+
+	// rotateSinkName is the sink name of internal errors reported by RotateWriter.
+	rotateSinkName = "file"
+
+	// FileFallbackStderr and FileFallbackNone are the values of [LogFileFallback] that write
+	// records to standard error, or drop them, while the log file cannot be written.
+	FileFallbackStderr = "stderr"
+	FileFallbackNone   = "none"
+
+	// reopenMinBackoff and reopenMaxBackoff bound the delay between two attempts to reopen a log
+	// file that could not be written.
+	reopenMinBackoff = time.Second
+	reopenMaxBackoff = time.Minute
 )
 
 var (
@@ -78,6 +90,15 @@ type RotateWriter struct {
 	// isCompress enables background gzip compression of rotated files.
 	isCompress bool
 
+	// fallback receives records while the log file cannot be written; nil drops them.
+	fallback io.Writer
+
+	// failed is set while the log file cannot be written. It is reopened at reopenTime, after
+	// reopenAttempts failed attempts.
+	failed         bool
+	reopenTime     time.Time
+	reopenAttempts int
+
 	file *os.File
 	size int64
 
@@ -125,10 +146,25 @@ func newRotateWriter(filePath string, fileSize int, fileRotate, fileExpired, fil
 	return rotateWriter
 }
 
-// Write implements io.Writer. It opens the file on first use, applies at most one time-based
-// rotation when due, then at most one size-based rotation when the write would exceed getMaxSize,
-// and writes the full buffer in one system call. A buffer larger than getMaxSize may leave one
-// file larger than the configured limit.
+// setFallback sets the writer that receives records while the log file cannot be written:
+// standard error for [FileFallbackStderr] or an empty target, none for [FileFallbackNone], and
+// otherwise a log file of the same name and rotation settings in the directory target.
+func (p *RotateWriter) setFallback(target string) {
+	switch strings.ToLower(target) {
+	case "", FileFallbackStderr:
+		p.fallback = noCloseWriter{Writer: os.Stderr}
+	case FileFallbackNone:
+		p.fallback = nil
+	default:
+		p.fallback = newRotateWriter(filepath.Join(target, filepath.Base(p.getFilePath())), p.fileSize,
+			int(p.fileRotate/time.Hour), p.fileExpired, p.fileCount, p.isCompress)
+	}
+}
+
+// Write implements io.Writer. While the log file cannot be written, records go to the fallback
+// writer, or are rejected without one, and the file is reopened with exponential backoff; the
+// failure and the recovery are each reported once as internal errors. When a write fails after
+// part of a record reached the file, only the rest of the record goes to the fallback writer.
 func (p *RotateWriter) Write(data []byte) (int, error) {
 	p.Lock()
 	defer p.Unlock()
@@ -137,6 +173,60 @@ func (p *RotateWriter) Write(data []byte) (int, error) {
 		return 0, os.ErrClosed
 	}
 
+	if p.failed {
+		if time.Now().Before(p.reopenTime) {
+			if p.fallback == nil {
+				return 0, fmt.Errorf("tlog: %s is unavailable; reopening after %s", p.getFilePath(),
+					p.reopenTime.Format(time.RFC3339))
+			}
+
+			return p.fallback.Write(data)
+		}
+
+		_ = p.close()
+	}
+
+	n, err := p.write(data)
+	if err == nil {
+		if p.failed {
+			p.failed = false
+			p.reopenAttempts = 0
+
+			reportError(rotateSinkName, OpRecover, p.getFilePath(), errSinkRecovered)
+		}
+
+		return n, nil
+	}
+
+	if !p.failed {
+		p.failed = true
+
+		if p.fallback == nil {
+			reportError(rotateSinkName, OpWrite, p.getFilePath(), err)
+		} else {
+			reportError(rotateSinkName, OpFallback, p.getFilePath(), err)
+		}
+	}
+
+	_ = p.close()
+
+	p.reopenAttempts++
+	p.reopenTime = time.Now().Add(backoffDelay(p.reopenAttempts, reopenMinBackoff, reopenMaxBackoff))
+
+	if p.fallback == nil {
+		return n, err
+	}
+
+	m, err := p.fallback.Write(data[n:])
+
+	return n + m, err
+}
+
+// write opens the file on first use, applies at most one time-based rotation when due, then at
+// most one size-based rotation when the write would exceed getMaxSize, and writes the full buffer
+// in one system call. A buffer larger than getMaxSize may leave one file larger than the
+// configured limit.
+func (p *RotateWriter) write(data []byte) (int, error) {
 	if p.file == nil {
 		if err := p.openLogFile(); err != nil {
 			return 0, err
@@ -186,6 +276,10 @@ func (p *RotateWriter) Close() error {
 	p.closed = true
 	close(p.done)
 
+	if closer, ok := p.fallback.(io.Closer); ok {
+		_ = closer.Close()
+	}
+
 	return p.close()
 }
 
@@ -357,7 +451,7 @@ func (p *RotateWriter) runMill() {
 
 		historyLogFiles, err := p.getHistoryLogFiles()
 		if err != nil {
-			log.Printf("tlog rotate: failed to enumerate rotated log files in %q: %v", p.getFileDir(), err)
+			reportError(rotateSinkName, OpList, p.getFileDir(), err)
 			continue
 		}
 
@@ -406,7 +500,7 @@ func (p *RotateWriter) runMill() {
 		for _, removeLogFile := range removeLogFiles {
 			path := filepath.Join(p.getFileDir(), removeLogFile.Name())
 			if err := os.Remove(path); err != nil {
-				log.Printf("tlog rotate: failed to remove rotated log file %q: %v", path, err)
+				reportError(rotateSinkName, OpRemove, path, err)
 			}
 		}
 
@@ -420,12 +514,7 @@ func (p *RotateWriter) runMill() {
 
 				dst := path + CompressSuffix
 				if err := compressLogFile(path, dst); err != nil {
-					log.Printf(
-						"tlog rotate: failed to compress rotated log file from %q to %q: %v",
-						path,
-						dst,
-						err,
-					)
+					reportError(rotateSinkName, OpCompress, path, err)
 				}
 			}
 		}
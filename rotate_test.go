@@ -0,0 +1,90 @@
+package tlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newBlockedRotateWriter returns a RotateWriter whose log directory cannot be created, because a
+// regular file takes its place, and the path of that file.
+func newBlockedRotateWriter(t *testing.T, fallback string) (*RotateWriter, string) {
+	t.Helper()
+
+	blocker := filepath.Join(t.TempDir(), "logs")
+
+	err := os.WriteFile(blocker, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotateWriter := newRotateWriter(filepath.Join(blocker, "app.log"), 0, 0, 0, 0, false)
+	rotateWriter.setFallback(fallback)
+
+	t.Cleanup(func() { _ = rotateWriter.Close() })
+
+	return rotateWriter, blocker
+}
+
+func TestRotateFallbackAndRecovery(t *testing.T) {
+	rotateWriter, blocker := newBlockedRotateWriter(t, FileFallbackStderr)
+
+	fallback := &syncBuffer{}
+	rotateWriter.fallback = fallback
+
+	for _, record := range []string{"first\n", "second\n"} {
+		n, err := rotateWriter.Write([]byte(record))
+		if err != nil || n != len(record) {
+			t.Fatalf("Write = %d, %v, want %d and no error through the fallback", n, err, len(record))
+		}
+	}
+
+	if got := fallback.String(); got != "first\nsecond\n" {
+		t.Errorf("fallback = %q, want both records", got)
+	}
+
+	err := os.Remove(blocker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Skip the backoff delay.
+	rotateWriter.reopenTime = time.Time{}
+
+	_, err = rotateWriter.Write([]byte("third\n"))
+	if err != nil {
+		t.Fatalf("Write after recovery: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(blocker, "app.log"))
+	if err != nil || string(data) != "third\n" {
+		t.Errorf("log file = %q, %v, want the record written after recovery", data, err)
+	}
+
+	if rotateWriter.failed {
+		t.Error("writer is still failed after recovery")
+	}
+}
+
+func TestRotateFallbackNoneBacksOff(t *testing.T) {
+	rotateWriter, _ := newBlockedRotateWriter(t, FileFallbackNone)
+
+	_, err := rotateWriter.Write([]byte("first\n"))
+	if err == nil || strings.Contains(err.Error(), "unavailable") {
+		t.Fatalf("first Write error = %v, want the error opening the file", err)
+	}
+
+	attempts := rotateWriter.reopenAttempts
+
+	_, err = rotateWriter.Write([]byte("second\n"))
+	if err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Errorf("second Write error = %v, want the file reported unavailable until the next attempt", err)
+	}
+
+	if rotateWriter.reopenAttempts != attempts {
+		t.Errorf("reopen attempts = %d, want %d: the file was reopened during the backoff",
+			rotateWriter.reopenAttempts, attempts)
+	}
+}
@@ -0,0 +1,481 @@
+package tlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/choveylee/tcfg"
+	"github.com/json-iterator/go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// OutputTypeStdout writes records to standard output.
+	OutputTypeStdout = "stdout"
+	// OutputTypeStderr writes records to standard error.
+	OutputTypeStderr = "stderr"
+	// OutputTypeFile writes records to a rotated log file.
+	OutputTypeFile = "file"
+)
+
+// OutputConfig declares one output of the routed pipeline configured with [LogOutputs] or
+// [LogOutputsFile]. Every record whose level lies between MinLevel and MaxLevel is written to the
+// output in Format, after the field filters have been applied. For example, the following
+// configuration writes ERROR and higher to error.log, everything to app.log, and WARN and higher
+// to standard error:
+//
+//	[
+//	  {"type": "file", "path": "error.log", "min_level": "ERROR"},
+//	  {"type": "file", "path": "app.log"},
+//	  {"type": "stderr", "min_level": "WARN", "format": "CONSOLE"}
+//	]
+type OutputConfig struct {
+	// Type is [OutputTypeStdout], [OutputTypeStderr], or [OutputTypeFile].
+	Type string `json:"type"`
+
+	// MinLevel and MaxLevel bound the levels written to the output; empty values leave the range
+	// open.
+	MinLevel string `json:"min_level"`
+	MaxLevel string `json:"max_level"`
+
+	// Format is the output format, accepting the same values as [LogFormat]. The default is JSON.
+	Format string `json:"format"`
+
+	// Include lists the fields written to the output in addition to time, level, and message; an
+	// empty list writes all fields. Exclude lists fields that are never written.
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+
+	// Path is the log file path of file outputs; the default is <AppName>.log.
+	Path string `json:"path"`
+
+	// Size, Rotate, Expired, Count, and Compress configure the rotation of file outputs; they
+	// default to the values of [LogFileSize], [LogFileRotate], [LogFileExpired], [LogFileCount],
+	// and [LogFileCompress].
+	Size     *int  `json:"size"`
+	Rotate   *int  `json:"rotate"`
+	Expired  *int  `json:"expired"`
+	Count    *int  `json:"count"`
+	Compress *bool `json:"compress"`
+
+	// Fallback is the fallback of file outputs, accepting the same values as [LogFileFallback],
+	// whose value it defaults to.
+	Fallback string `json:"fallback"`
+}
+
+// routeWriter implements zerolog.LevelWriter for one output: it passes the records within its
+// level range, with its field filters applied, to the encoder of the output.
+type routeWriter struct {
+	// out is the encoder of the output.
+	out io.Writer
+
+	// closer closes the underlying output; nil when it must stay open, as for stdout.
+	closer io.Closer
+
+	minLevel zerolog.Level
+	maxLevel zerolog.Level
+
+	// include and exclude are the field filters; a nil include keeps all fields.
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// Write implements io.Writer for records whose level is only known from their level field.
+func (w *routeWriter) Write(p []byte) (int, error) {
+	level := zerolog.NoLevel
+
+	if record, err := decodeRecord(p); err == nil {
+		if levelName, ok := record[fieldLevel].(string); ok {
+			level, _ = zerolog.ParseLevel(levelName)
+		}
+	}
+
+	return w.WriteLevel(level, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter. Records outside the level range are ignored.
+func (w *routeWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level != zerolog.NoLevel && (level < w.minLevel || level > w.maxLevel) {
+		return len(p), nil
+	}
+
+	if w.include == nil && w.exclude == nil {
+		return w.out.Write(p)
+	}
+
+	record, err := decodeRecord(p)
+	if err != nil {
+		return 0, fmt.Errorf("tlog router: cannot decode record: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for _, key := range recordKeys(record, fieldPriorityKeys) {
+		if !w.keep(key) {
+			continue
+		}
+
+		err := appendJsonField(&buf, key, record[key])
+		if err != nil {
+			return 0, fmt.Errorf("tlog router: %w", err)
+		}
+	}
+
+	buf.WriteString("}\n")
+
+	_, err = w.out.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// reportsErrorDetail implements errorDetailReporter for the encoder of the output.
+func (w *routeWriter) reportsErrorDetail() bool {
+	return reportsErrorDetail(w.out)
+}
+
+// keep reports whether the field key passes the field filters.
+func (w *routeWriter) keep(key string) bool {
+	if w.exclude[key] {
+		return false
+	}
+
+	switch key {
+	case fieldTime, fieldLevel, fieldMessage:
+		return true
+	}
+
+	return w.include == nil || w.include[key]
+}
+
+// Close closes the underlying output.
+func (w *routeWriter) Close() error {
+	if w.closer == nil {
+		return nil
+	}
+
+	return w.closer.Close()
+}
+
+// splitWriter implements zerolog.LevelWriter by writing records at or above level to high and all
+// other records to low. Each side has its own encoder, so that every record is written to one
+// stream in a single call and lines of the two streams never interleave within a line.
+type splitWriter struct {
+	low  io.Writer
+	high io.Writer
+
+	level zerolog.Level
+}
+
+// Write implements io.Writer for records whose level is unknown; they are written to low.
+func (w *splitWriter) Write(p []byte) (int, error) {
+	return w.low.Write(p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *splitWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level != zerolog.NoLevel && level >= w.level {
+		return w.high.Write(p)
+	}
+
+	return w.low.Write(p)
+}
+
+// reportsErrorDetail implements errorDetailReporter; it reports whether either side does.
+func (w *splitWriter) reportsErrorDetail() bool {
+	return reportsErrorDetail(w.low, w.high)
+}
+
+// routeSink is a route of a router: a routeWriter, or an isolatedWriter wrapping one.
+type routeSink interface {
+	zerolog.LevelWriter
+	io.Closer
+}
+
+// router implements zerolog.LevelWriter by writing every record to each of its routes. A failing
+// route does not prevent the others from receiving the record.
+type router struct {
+	routes []routeSink
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (r *router) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var errs []error
+
+	for _, route := range r.routes {
+		_, err := route.WriteLevel(level, p)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return 0, errors.Join(errs...)
+	}
+
+	return len(p), nil
+}
+
+// Write implements io.Writer.
+func (r *router) Write(p []byte) (int, error) {
+	var errs []error
+
+	for _, route := range r.routes {
+		_, err := route.Write(p)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return 0, errors.Join(errs...)
+	}
+
+	return len(p), nil
+}
+
+// reportsErrorDetail implements errorDetailReporter; it reports whether any route does.
+func (r *router) reportsErrorDetail() bool {
+	for _, route := range r.routes {
+		if reportsErrorDetail(route) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Close closes the outputs of all routes.
+func (r *router) Close() error {
+	var errs []error
+
+	for _, route := range r.routes {
+		err := route.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// loadOutputs reads the output declarations from [LogOutputs], or else from the file named by
+// [LogOutputsFile]. It returns an empty string when neither key is set.
+func loadOutputs() (string, error) {
+	outputs := tcfg.DefaultString(tcfg.LocalKey(LogOutputs), "")
+	if outputs != "" {
+		return outputs, nil
+	}
+
+	outputsFile := tcfg.DefaultString(tcfg.LocalKey(LogOutputsFile), "")
+	if outputsFile == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(outputsFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read outputs file %q: %w", outputsFile, err)
+	}
+
+	return string(data), nil
+}
+
+// newRouter constructs a router from output declarations written either as a JSON array of
+// OutputConfig objects or as a comma-separated list of URL specs resolved through the sink
+// registry. File outputs declared in JSON without a path write to <appName>.log. Each route is
+// isolated from the others unless isolation is nil. An output that cannot be constructed is
+// reported and skipped, so that it does not disable the others; an error is only returned when
+// the declarations cannot be parsed or no output could be constructed.
+func newRouter(outputs string, appName string, fields *fieldConfig, isolation *isolationConfig) (*router, error) {
+	var routes []routeSink
+
+	addRoute := func(name string, route *routeWriter) {
+		if isolation == nil {
+			routes = append(routes, route)
+			return
+		}
+
+		routes = append(routes, newIsolatedWriter(name, route, isolation))
+	}
+
+	var outputErr error
+
+	skipOutput := func(name string, err error) {
+		outputErr = err
+
+		reportError(name, OpInit, "", fmt.Errorf("output has been ignored: %w", err))
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(outputs), "[") {
+		var outputConfigs []OutputConfig
+
+		err := jsoniter.Unmarshal([]byte(outputs), &outputConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid outputs %q: %w", outputs, err)
+		}
+
+		for i, outputConfig := range outputConfigs {
+			name := fmt.Sprintf("output %d (%s)", i, strings.ToLower(outputConfig.Type))
+
+			route, err := newRouteWriter(outputConfig, appName, fields)
+			if err != nil {
+				skipOutput(name, fmt.Errorf("output %d: %w", i, err))
+				continue
+			}
+
+			addRoute(name, route)
+		}
+	} else {
+		for i, spec := range splitOutputSpecs(outputs) {
+			scheme, _, _ := strings.Cut(spec, ":")
+
+			name := fmt.Sprintf("output %d (%s)", i, scheme)
+
+			route, err := newSpecRouteWriter(spec, fields)
+			if err != nil {
+				skipOutput(name, err)
+				continue
+			}
+
+			addRoute(name, route)
+		}
+	}
+
+	if len(routes) == 0 {
+		if outputErr == nil {
+			outputErr = errors.New("no output is declared")
+		}
+
+		return nil, outputErr
+	}
+
+	return &router{routes: routes}, nil
+}
+
+// newRouteWriter constructs the route of one output declaration.
+func newRouteWriter(outputConfig OutputConfig, appName string, fields *fieldConfig) (*routeWriter, error) {
+	route, err := newFilteredRouteWriter(outputConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	format := outputConfig.Format
+	if format == "" {
+		format = LogFormatJson
+	}
+
+	var out io.Writer
+
+	switch strings.ToLower(outputConfig.Type) {
+	case OutputTypeStdout:
+		out = noCloseWriter{Writer: os.Stdout}
+	case OutputTypeStderr:
+		out = noCloseWriter{Writer: os.Stderr}
+	case OutputTypeFile:
+		rotateWriter := newOutputRotateWriter(outputConfig, appName)
+
+		out = rotateWriter
+		route.closer = rotateWriter
+	default:
+		return nil, fmt.Errorf("invalid type %q", outputConfig.Type)
+	}
+
+	route.out = newFormatWriter(format, out, fields)
+
+	return route, nil
+}
+
+// newFilteredRouteWriter constructs a route without output that applies the level range and field
+// filters of outputConfig.
+func newFilteredRouteWriter(outputConfig OutputConfig) (*routeWriter, error) {
+	route := &routeWriter{
+		minLevel: zerolog.TraceLevel,
+		maxLevel: zerolog.PanicLevel,
+	}
+
+	if outputConfig.MinLevel != "" {
+		level, ok := parseLevel(outputConfig.MinLevel)
+		if !ok {
+			return nil, fmt.Errorf("invalid min_level %q", outputConfig.MinLevel)
+		}
+
+		route.minLevel = level
+	}
+
+	if outputConfig.MaxLevel != "" {
+		level, ok := parseLevel(outputConfig.MaxLevel)
+		if !ok {
+			return nil, fmt.Errorf("invalid max_level %q", outputConfig.MaxLevel)
+		}
+
+		route.maxLevel = level
+	}
+
+	if len(outputConfig.Include) > 0 {
+		route.include = make(map[string]bool, len(outputConfig.Include))
+		for _, key := range outputConfig.Include {
+			route.include[key] = true
+		}
+	}
+
+	if len(outputConfig.Exclude) > 0 {
+		route.exclude = make(map[string]bool, len(outputConfig.Exclude))
+		for _, key := range outputConfig.Exclude {
+			route.exclude[key] = true
+		}
+	}
+
+	return route, nil
+}
+
+// newOutputRotateWriter constructs the RotateWriter of a file output, taking unset rotation and
+// fallback settings from the LOG_FILE_* configuration keys.
+func newOutputRotateWriter(outputConfig OutputConfig, appName string) *RotateWriter {
+	filePath := outputConfig.Path
+	if filePath == "" {
+		filePath = fmt.Sprintf("%s.log", appName)
+	}
+
+	fileSize := tcfg.DefaultInt(tcfg.LocalKey(LogFileSize), 500)
+	if outputConfig.Size != nil {
+		fileSize = *outputConfig.Size
+	}
+
+	fileRotate := tcfg.DefaultInt(tcfg.LocalKey(LogFileRotate), 1)
+	if outputConfig.Rotate != nil {
+		fileRotate = *outputConfig.Rotate
+	}
+
+	fileExpired := tcfg.DefaultInt(tcfg.LocalKey(LogFileExpired), 0)
+	if outputConfig.Expired != nil {
+		fileExpired = *outputConfig.Expired
+	}
+
+	fileCount := tcfg.DefaultInt(tcfg.LocalKey(LogFileCount), 0)
+	if outputConfig.Count != nil {
+		fileCount = *outputConfig.Count
+	}
+
+	fileCompress := tcfg.DefaultBool(tcfg.LocalKey(LogFileCompress), false)
+	if outputConfig.Compress != nil {
+		fileCompress = *outputConfig.Compress
+	}
+
+	fileFallback := tcfg.DefaultString(tcfg.LocalKey(LogFileFallback), FileFallbackStderr)
+	if outputConfig.Fallback != "" {
+		fileFallback = outputConfig.Fallback
+	}
+
+	rotateWriter := newRotateWriter(filePath, fileSize, fileRotate, fileExpired, fileCount, fileCompress)
+	rotateWriter.setFallback(fileFallback)
+
+	return rotateWriter
+}
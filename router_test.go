@@ -0,0 +1,202 @@
+package tlog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// writeRouterTestRecords writes one record per level to r, with the level name as its message.
+func writeRouterTestRecords(t *testing.T, r *router, levels ...zerolog.Level) {
+	t.Helper()
+
+	for _, level := range levels {
+		record := fmt.Sprintf(`{"level":%q,"time":"2026-01-02T03:04:05Z","message":%q,"user":"bob","token":"secret"}`+"\n",
+			level.String(), level.String())
+
+		_, err := r.WriteLevel(level, []byte(record))
+		if err != nil {
+			t.Fatalf("WriteLevel(%s): %v", level, err)
+		}
+	}
+}
+
+// readRouterTestRecords decodes the newline-delimited records in data.
+func readRouterTestRecords(t *testing.T, data []byte) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		if len(line) > 0 {
+			records = append(records, decodeTestDocument(t, line))
+		}
+	}
+
+	return records
+}
+
+// routerTestMessages returns the messages of records, joined by spaces.
+func routerTestMessages(records []map[string]any) string {
+	var messages []string
+
+	for _, record := range records {
+		message, _ := record[fieldMessage].(string)
+		messages = append(messages, message)
+	}
+
+	return strings.Join(messages, " ")
+}
+
+func TestRouterLevelRanges(t *testing.T) {
+	dir := t.TempDir()
+
+	outputs := fmt.Sprintf(`[
+		{"type": "file", "path": %q, "min_level": "ERROR"},
+		{"type": "file", "path": %q, "min_level": "INFO", "max_level": "WARN"},
+		{"type": "file", "path": %q}
+	]`, filepath.Join(dir, "error.log"), filepath.Join(dir, "app.log"), filepath.Join(dir, "all.log"))
+
+	r, err := newRouter(outputs, "billing", &fieldConfig{}, nil)
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+
+	writeRouterTestRecords(t, r, zerolog.DebugLevel, zerolog.InfoLevel, zerolog.WarnLevel, zerolog.ErrorLevel, zerolog.FatalLevel)
+
+	err = r.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	for _, test := range []struct {
+		file string
+		want string
+	}{
+		{"error.log", "error fatal"},
+		{"app.log", "info warn"},
+		{"all.log", "debug info warn error fatal"},
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := routerTestMessages(readRouterTestRecords(t, data)); got != test.want {
+			t.Errorf("%s has %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+func TestRouterFieldFilters(t *testing.T) {
+	memorySinks.Delete("router-include")
+	memorySinks.Delete("router-exclude")
+
+	outputs := "memory://router-include?include=user,memory://router-exclude?exclude=token&min_level=WARN"
+
+	r, err := newRouter(outputs, "billing", &fieldConfig{}, nil)
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+
+	writeRouterTestRecords(t, r, zerolog.InfoLevel, zerolog.WarnLevel)
+
+	for _, test := range []struct {
+		sink     string
+		messages string
+		keys     []string
+		dropped  []string
+	}{
+		{"router-include", "info warn", []string{fieldLevel, fieldTime, fieldMessage, "user"}, []string{"token"}},
+		{"router-exclude", "warn", []string{fieldLevel, fieldTime, fieldMessage, "user"}, []string{"token"}},
+	} {
+		records := readRouterTestRecords(t, []byte(memorySink(test.sink).String()))
+
+		if got := routerTestMessages(records); got != test.messages {
+			t.Errorf("%s has %q, want %q", test.sink, got, test.messages)
+		}
+
+		for _, record := range records {
+			for _, key := range test.keys {
+				if _, ok := record[key]; !ok {
+					t.Errorf("%s record %v has no %s field", test.sink, record, key)
+				}
+			}
+
+			for _, key := range test.dropped {
+				if _, ok := record[key]; ok {
+					t.Errorf("%s record %v has the filtered %s field", test.sink, record, key)
+				}
+			}
+		}
+	}
+}
+
+func TestRouterInvalidOutputs(t *testing.T) {
+	for _, test := range []struct {
+		outputs string
+		want    string
+	}{
+		{`[{"type": "file"`, "invalid outputs"},
+		{`[]`, "no output is declared"},
+		{`[{"type": "kafka"}]`, `invalid type "kafka"`},
+		{`[{"type": "stdout", "min_level": "LOUD"}]`, `invalid min_level "LOUD"`},
+		{`[{"type": "stdout", "max_level": "quiet"}]`, `invalid max_level "quiet"`},
+		{"stdout://?min_level=LOUD", `invalid min_level "LOUD"`},
+	} {
+		_, err := newRouter(test.outputs, "billing", &fieldConfig{}, nil)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("newRouter(%q) error = %v, want %q", test.outputs, err, test.want)
+		}
+	}
+
+	// An invalid output is skipped without disabling the valid ones.
+	r, err := newRouter(`[{"type": "kafka"}, {"type": "stdout"}]`, "billing", &fieldConfig{}, nil)
+	if err != nil {
+		t.Fatalf("newRouter with one valid output: %v", err)
+	}
+
+	if len(r.routes) != 1 {
+		t.Errorf("router has %d routes, want the valid output only", len(r.routes))
+	}
+
+	if got := lastError("output 0 (kafka)"); got == nil || got.Op != OpInit {
+		t.Errorf("last error of the skipped output = %v, want an %s error", got, OpInit)
+	}
+}
+
+func TestSplitWriterSendsHighLevelsToHigh(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	tl := newTlog("billing", zerolog.MultiLevelWriter(&splitWriter{low: &stdout, high: &stderr, level: zerolog.WarnLevel}), &fieldConfig{})
+
+	for _, level := range []string{"INFO", "WARN", "ERROR"} {
+		newTevent(level, tl).Msg(strings.ToLower(level))
+	}
+
+	if got := routerTestMessages(readRouterTestRecords(t, stdout.Bytes())); got != "info" {
+		t.Errorf("stdout has %q, want the records below WARN", got)
+	}
+
+	if got := routerTestMessages(readRouterTestRecords(t, stderr.Bytes())); got != "warn error" {
+		t.Errorf("stderr has %q, want the records at or above WARN", got)
+	}
+
+	// Records without a known level stay on the low stream.
+	writer := &splitWriter{low: &stdout, high: &stderr, level: zerolog.WarnLevel}
+
+	stdout.Reset()
+	stderr.Reset()
+
+	_, _ = writer.Write([]byte(`{"message":"plain"}` + "\n"))
+	_, _ = writer.WriteLevel(zerolog.NoLevel, []byte(`{"message":"nolevel"}`+"\n"))
+
+	if got := routerTestMessages(readRouterTestRecords(t, stdout.Bytes())); got != "plain nolevel" || stderr.Len() != 0 {
+		t.Errorf("stdout has %q and stderr %q, want both records on stdout", got, stderr.String())
+	}
+}
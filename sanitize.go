@@ -0,0 +1,148 @@
+package tlog
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/choveylee/tcfg"
+)
+
+const (
+	// DefaultFieldMaxBytes is the default byte budget of one field value of an event.
+	DefaultFieldMaxBytes = 10000
+
+	// ControlEscape writes control characters in console and logfmt output as escape sequences,
+	// such as \n, \r, and \x1b, so that a value can neither start a forged line nor carry a
+	// terminal escape sequence.
+	ControlEscape = "escape"
+	// ControlStrip removes control characters from the values written in console and logfmt
+	// output.
+	ControlStrip = "strip"
+
+	// truncatedSuffix is appended to values cut to their byte budget.
+	truncatedSuffix = "..."
+	// truncatedKeySuffix is appended to the key of an object or array over its byte budget to
+	// form the key of its cut encoding.
+	truncatedKeySuffix = "_truncated"
+)
+
+// sizeLimits holds the byte budgets of the values of one event. Non-positive budgets are
+// unlimited.
+type sizeLimits struct {
+	fieldMaxBytes int
+	eventMaxBytes int
+}
+
+// defaultSizeLimits returns the budgets of a logger without configuration.
+func defaultSizeLimits() sizeLimits {
+	return sizeLimits{
+		fieldMaxBytes: DefaultFieldMaxBytes,
+	}
+}
+
+// loadSizeLimits reads the byte budgets through tcfg.
+func loadSizeLimits() sizeLimits {
+	return sizeLimits{
+		fieldMaxBytes: tcfg.DefaultInt(tcfg.LocalKey(LogFieldMaxBytes), DefaultFieldMaxBytes),
+		eventMaxBytes: tcfg.DefaultInt(tcfg.LocalKey(LogEventMaxBytes), 0),
+	}
+}
+
+// truncate cuts value to at most n bytes, including the truncatedSuffix it appends, without
+// splitting a UTF-8 sequence. Values of at most n bytes are returned unchanged, and a budget too
+// small to hold the suffix cuts the value to an empty string.
+func truncate(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+
+	if n < len(truncatedSuffix) {
+		return ""
+	}
+
+	n -= len(truncatedSuffix)
+
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+
+	return value[:n] + truncatedSuffix
+}
+
+// limit charges value against the field and event budgets of the event and returns it, cut to
+// the smaller remaining budget when it exceeds it. The keys of cut values are recorded for the
+// truncated field. Values are charged in the order they are added, so once the event budget is
+// spent the values that follow are cut to an empty string.
+func (p *Tevent) limit(key, value string) (string, bool) {
+	limits := p.tl.limits
+
+	n := -1
+	if limits.fieldMaxBytes > 0 {
+		n = limits.fieldMaxBytes
+	}
+
+	if limits.eventMaxBytes > 0 {
+		remaining := max(limits.eventMaxBytes-p.used, 0)
+		if n < 0 || remaining < n {
+			n = remaining
+		}
+	}
+
+	p.used += len(value)
+
+	if n < 0 || len(value) <= n {
+		return value, false
+	}
+
+	p.truncated = append(p.truncated, key)
+
+	return truncate(value, n), true
+}
+
+// isControl reports whether r is a control character that must not reach console or logfmt
+// output verbatim: the C0 and C1 controls, DEL, and the Unicode line and paragraph separators.
+func isControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7f && r < 0xa0) || r == '\u2028' || r == '\u2029'
+}
+
+// sanitizeControl applies the control character policy mode to value. ControlStrip removes the
+// control characters; any other mode, including an unknown one, replaces them with escape
+// sequences.
+func sanitizeControl(mode, value string) string {
+	if strings.IndexFunc(value, isControl) < 0 {
+		return value
+	}
+
+	var b strings.Builder
+
+	b.Grow(len(value))
+
+	for _, r := range value {
+		if !isControl(r) {
+			b.WriteRune(r)
+			continue
+		}
+
+		if mode == ControlStrip {
+			continue
+		}
+
+		switch r {
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x100 {
+				fmt.Fprintf(&b, `\x%02x`, r)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestTruncateKeepsUtf8Sequences(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		n     int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"short", 5, "short"},
+		{"abcdef", 5, "ab" + truncatedSuffix},
+		{"abcdef", 3, truncatedSuffix},
+		{"aé...", 4, "a" + truncatedSuffix},
+		{"abcdef", 2, ""},
+		{"abc", -1, ""},
+	} {
+		got := truncate(test.value, test.n)
+		if got != test.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.value, test.n, got, test.want)
+		}
+
+		if len(got) > max(test.n, 0) {
+			t.Errorf("truncate(%q, %d) is %d bytes, over the budget", test.value, test.n, len(got))
+		}
+	}
+}
+
+func TestFieldBudgetKeepsFieldTypes(t *testing.T) {
+	var buf bytes.Buffer
+
+	tl := newTlog("billing", zerolog.MultiLevelWriter(&buf), &fieldConfig{})
+	tl.limits = sizeLimits{fieldMaxBytes: 16}
+
+	newTevent("INFO", tl).
+		Any("order", map[string]any{"id": "A-17", "items": []string{"book", "lamp", "chair"}}).
+		Any("tags", []string{"priority", "gift", "express"}).
+		Any("note", strings.Repeat("n", 20)).
+		Any("count", 3).
+		Msg("placed")
+
+	record := decodeTestDocument(t, buf.Bytes())
+
+	if order, ok := record["order"].(map[string]any); !ok || len(order) != 0 {
+		t.Errorf("order = %v (%T), want an empty object", record["order"], record["order"])
+	}
+
+	if tags, ok := record["tags"].([]any); !ok || len(tags) != 0 {
+		t.Errorf("tags = %v (%T), want an empty array", record["tags"], record["tags"])
+	}
+
+	for _, key := range []string{"order", "tags"} {
+		text, _ := record[key+truncatedKeySuffix].(string)
+		if len(text) != 16 || !strings.HasSuffix(text, truncatedSuffix) {
+			t.Errorf("%s%s = %q, want the encoding cut to 16 bytes", key, truncatedKeySuffix, text)
+		}
+	}
+
+	if got := record["note"]; got != strings.Repeat("n", 16-len(truncatedSuffix))+truncatedSuffix {
+		t.Errorf("note = %q, want the string cut to 16 bytes", got)
+	}
+
+	if got := record["count"]; got != json.Number("3") {
+		t.Errorf("count = %v, want 3", got)
+	}
+
+	truncated, _ := record[fieldTruncated].([]any)
+	if len(truncated) != 3 || truncated[0] != "order" || truncated[1] != "tags" || truncated[2] != "note" {
+		t.Errorf("truncated = %v, want order, tags, and note", truncated)
+	}
+}
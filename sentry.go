@@ -75,6 +75,9 @@ func connectSentry(sentryDsn string) error {
 // payloads to Sentry after the client has been initialized successfully.
 type SentryWriter struct {
 	io.Writer
+
+	// redactor masks sensitive values in the forwarded messages; nil forwards them unchanged.
+	redactor *redactor
 }
 
 // simpleLog holds the JSON fields used to build a concise Sentry title before the raw payload.
@@ -88,7 +91,7 @@ type simpleLog struct {
 // returns (len(p), nil) so the zerolog pipeline does not fail.
 func (w SentryWriter) WriteLevel(level zerolog.Level, p []byte) (n int, err error) {
 	if level >= zerolog.ErrorLevel {
-		captureSentryPayload(p)
+		captureSentryPayload(p, w.redactor)
 	}
 
 	return len(p), nil
@@ -101,9 +104,9 @@ func (w SentryWriter) Close() error {
 	return nil
 }
 
-func captureSentryPayload(p []byte) {
+func captureSentryPayload(p []byte, redactor *redactor) {
 	if sentryInitState.Load() == sentryInitReady {
-		sentryCaptureMessage(buildSentryMessage(p))
+		sentryCaptureMessage(redactor.redactString(buildSentryMessage(p)))
 	}
 }
 
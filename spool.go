@@ -0,0 +1,571 @@
+package tlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/choveylee/tcfg"
+)
+
+const (
+	// SpoolDropNewest discards records that do not fit into a full spool.
+	SpoolDropNewest = "DROP_NEWEST"
+	// SpoolDropOldest deletes the oldest segments of a full spool to make room for new records.
+	SpoolDropOldest = "DROP_OLDEST"
+
+	// DefaultSpoolMaxSize is the default maximum size of the spool of one sink, in megabytes.
+	DefaultSpoolMaxSize = 1024
+	// DefaultSpoolSegmentSize is the default maximum size of one spool segment file, in megabytes.
+	DefaultSpoolSegmentSize = 64
+
+	// spoolSegmentSuffix is the filename suffix of spool segment files.
+	spoolSegmentSuffix = ".seg"
+	// spoolCursorName is the name of the file that records the replay position.
+	spoolCursorName = "cursor"
+
+	// spoolFrameHeaderLen is the size of the header of one spooled record: its length and its
+	// CRC-32 checksum, both big-endian 32-bit integers.
+	spoolFrameHeaderLen = 8
+)
+
+var (
+	// spoolDirs counts the spools opened per sink name, so that several sinks of the same kind use
+	// separate directories.
+	spoolDirs = make(map[string]int)
+
+	spoolDirsMu sync.Mutex
+)
+
+// spoolPosition identifies a record in the spool by its segment and byte offset.
+type spoolPosition struct {
+	segment uint64
+	offset  int64
+}
+
+// diskSpool is a durable FIFO queue of records in a directory of append-only segment files. Remote
+// sinks append the batches they fail to deliver and replay them in order once the endpoint has
+// recovered. Every record is framed with its length and checksum; a cursor file records the
+// position of the first record that has not been acknowledged, so that a restarted process
+// resumes the replay where the previous one stopped, and segments are deleted once all their
+// records have been acknowledged. Delivery is at least once: records sent but not acknowledged
+// before a crash are replayed again.
+type diskSpool struct {
+	dir string
+
+	// segmentSize and maxSize bound one segment file and all segment files, in bytes.
+	segmentSize int64
+	maxSize     int64
+
+	// dropPolicy is SpoolDropNewest or SpoolDropOldest.
+	dropPolicy string
+
+	// segments lists the ids of the segment files on disk, in ascending order; the last one is
+	// open for appending.
+	segments []uint64
+
+	// segmentSizes holds the size of each segment in segments.
+	segmentSizes map[uint64]int64
+
+	file *os.File
+
+	// cursor is the position of the first record that has not been acknowledged.
+	cursor spoolPosition
+
+	sync.Mutex
+}
+
+// loadDiskSpool opens the spool of the sink called name from the spool configuration keys read
+// through tcfg. It returns nil when spooling is disabled or the spool cannot be opened.
+func loadDiskSpool(name string) *diskSpool {
+	spoolDir := tcfg.DefaultString(tcfg.LocalKey(LogSpoolDir), "")
+	if spoolDir == "" {
+		return nil
+	}
+
+	spoolMaxSize := tcfg.DefaultInt(tcfg.LocalKey(LogSpoolMaxSize), DefaultSpoolMaxSize)
+	spoolSegmentSize := tcfg.DefaultInt(tcfg.LocalKey(LogSpoolSegmentSize), DefaultSpoolSegmentSize)
+	spoolDropPolicy := tcfg.DefaultString(tcfg.LocalKey(LogSpoolDropPolicy), SpoolDropNewest)
+
+	spoolDirsMu.Lock()
+
+	spoolDirs[name]++
+
+	// The second and later sinks of the same kind, in configuration order, use numbered directories.
+	dirName := name
+	if spoolDirs[name] > 1 {
+		dirName = fmt.Sprintf("%s-%d", name, spoolDirs[name])
+	}
+
+	spoolDirsMu.Unlock()
+
+	spool, err := openDiskSpool(filepath.Join(spoolDir, dirName), int64(spoolSegmentSize)*int64(MegaByte),
+		int64(spoolMaxSize)*int64(MegaByte), spoolDropPolicy)
+	if err != nil {
+		reportError(name, OpSpool, filepath.Join(spoolDir, dirName), fmt.Errorf("spool has been disabled: %w", err))
+
+		return nil
+	}
+
+	return spool
+}
+
+// openDiskSpool opens or creates the spool in dir and recovers its state: segments before the
+// cursor are deleted and a record torn by a crash at the end of the last segment is truncated.
+// Non-positive sizes fall back to DefaultSpoolSegmentSize and DefaultSpoolMaxSize megabytes.
+func openDiskSpool(dir string, segmentSize, maxSize int64, dropPolicy string) (*diskSpool, error) {
+	if segmentSize <= 0 {
+		segmentSize = int64(DefaultSpoolSegmentSize) * int64(MegaByte)
+	}
+
+	if maxSize <= 0 {
+		maxSize = int64(DefaultSpoolMaxSize) * int64(MegaByte)
+	}
+
+	dropPolicy = strings.ToUpper(dropPolicy)
+	if dropPolicy != SpoolDropOldest {
+		dropPolicy = SpoolDropNewest
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	spool := &diskSpool{
+		dir: dir,
+
+		segmentSize: segmentSize,
+		maxSize:     maxSize,
+
+		dropPolicy: dropPolicy,
+
+		segmentSizes: make(map[uint64]int64),
+	}
+
+	err = spool.recover()
+	if err != nil {
+		return nil, err
+	}
+
+	return spool, nil
+}
+
+// recover loads the segments and the cursor from disk and opens the last segment for appending.
+func (s *diskSpool) recover() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		s.segments = append(s.segments, id)
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	s.cursor = s.readCursor()
+
+	// Segments before the cursor were acknowledged before the process stopped.
+	for len(s.segments) > 0 && s.segments[0] < s.cursor.segment {
+		_ = os.Remove(s.segmentPath(s.segments[0]))
+		s.segments = s.segments[1:]
+	}
+
+	if len(s.segments) == 0 {
+		return s.newSegment(s.cursor.segment)
+	}
+
+	if s.cursor.segment < s.segments[0] {
+		s.cursor = spoolPosition{segment: s.segments[0]}
+	}
+
+	for _, id := range s.segments[:len(s.segments)-1] {
+		fileInfo, err := os.Stat(s.segmentPath(id))
+		if err != nil {
+			return err
+		}
+
+		s.segmentSizes[id] = fileInfo.Size()
+	}
+
+	lastId := s.segments[len(s.segments)-1]
+
+	validSize, err := s.validSize(lastId)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.segmentPath(lastId), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = file.Truncate(validSize)
+	if err == nil {
+		_, err = file.Seek(validSize, io.SeekStart)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.segmentSizes[lastId] = validSize
+
+	if s.cursor.segment == lastId && s.cursor.offset > validSize {
+		s.cursor.offset = validSize
+	}
+
+	return nil
+}
+
+// validSize returns the size of the intact records at the start of segment id.
+func (s *diskSpool) validSize(id uint64) (int64, error) {
+	file, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(file)
+
+	var size int64
+
+	for {
+		record, err := readSpoolFrame(reader, fileInfo.Size()-size)
+		if err != nil {
+			return size, nil
+		}
+
+		size += int64(spoolFrameHeaderLen + len(record))
+	}
+}
+
+// empty reports whether every spooled record has been acknowledged.
+func (s *diskSpool) empty() bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.emptyLocked()
+}
+
+// emptyLocked performs empty with the lock held.
+func (s *diskSpool) emptyLocked() bool {
+	lastId := s.segments[len(s.segments)-1]
+
+	return s.cursor.segment == lastId && s.cursor.offset >= s.segmentSizes[lastId]
+}
+
+// append spools records. Records that do not fit are handled according to the drop policy; the
+// number of dropped records is returned with the first write error, if any.
+func (s *diskSpool) append(records [][]byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var dropped int
+
+	for _, record := range records {
+		frameLen := int64(spoolFrameHeaderLen + len(record))
+
+		lastId := s.segments[len(s.segments)-1]
+		if s.segmentSizes[lastId] > 0 && s.segmentSizes[lastId]+frameLen > s.segmentSize {
+			err := s.newSegment(lastId + 1)
+			if err != nil {
+				return dropped + 1, err
+			}
+		}
+
+		if !s.makeRoom(frameLen) {
+			dropped++
+			continue
+		}
+
+		frame := make([]byte, 0, frameLen)
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(record)))
+		frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(record))
+		frame = append(frame, record...)
+
+		n, err := s.file.Write(frame)
+
+		s.segmentSizes[s.segments[len(s.segments)-1]] += int64(n)
+
+		if err != nil {
+			return dropped + 1, err
+		}
+	}
+
+	return dropped, s.file.Sync()
+}
+
+// makeRoom reports whether frameLen more bytes fit into the spool, deleting the oldest segments
+// first when the drop policy allows it.
+func (s *diskSpool) makeRoom(frameLen int64) bool {
+	for s.totalSize()+frameLen > s.maxSize {
+		if s.dropPolicy != SpoolDropOldest || len(s.segments) < 2 {
+			return false
+		}
+
+		oldestId := s.segments[0]
+
+		_ = os.Remove(s.segmentPath(oldestId))
+
+		delete(s.segmentSizes, oldestId)
+		s.segments = s.segments[1:]
+
+		if s.cursor.segment <= oldestId {
+			s.cursor = spoolPosition{segment: s.segments[0]}
+			_ = s.writeCursor()
+		}
+	}
+
+	return true
+}
+
+// totalSize returns the size of all segment files.
+func (s *diskSpool) totalSize() int64 {
+	var size int64
+	for _, segmentSize := range s.segmentSizes {
+		size += segmentSize
+	}
+
+	return size
+}
+
+// peek returns up to max records starting at the cursor, in the order they were spooled, and the
+// position after the last of them, to be passed to ack once they have been delivered. A corrupt
+// record ends the segment that contains it.
+func (s *diskSpool) peek(max int) ([][]byte, spoolPosition, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var records [][]byte
+
+	position := s.cursor
+
+	for len(records) < max && position.offset < s.segmentSizes[position.segment] {
+		file, err := os.Open(s.segmentPath(position.segment))
+		if err != nil {
+			return records, position, err
+		}
+
+		_, err = file.Seek(position.offset, io.SeekStart)
+		if err != nil {
+			file.Close()
+			return records, position, err
+		}
+
+		reader := bufio.NewReader(file)
+
+		for len(records) < max && position.offset < s.segmentSizes[position.segment] {
+			record, err := readSpoolFrame(reader, s.segmentSizes[position.segment]-position.offset)
+			if err != nil {
+				reportError(filepath.Base(s.dir), OpSpool, s.segmentPath(position.segment),
+					fmt.Errorf("skipping the rest of segment: %w", err))
+
+				position.offset = s.segmentSizes[position.segment]
+				break
+			}
+
+			records = append(records, record)
+			position.offset += int64(spoolFrameHeaderLen + len(record))
+		}
+
+		file.Close()
+
+		if position.offset >= s.segmentSizes[position.segment] {
+			next, ok := s.nextSegment(position.segment)
+			if !ok {
+				break
+			}
+
+			position = spoolPosition{segment: next}
+		}
+	}
+
+	return records, position, nil
+}
+
+// nextSegment returns the id of the segment after id.
+func (s *diskSpool) nextSegment(id uint64) (uint64, bool) {
+	for _, segment := range s.segments {
+		if segment > id {
+			return segment, true
+		}
+	}
+
+	return 0, false
+}
+
+// ack acknowledges the records before position: it moves the cursor, persists it, and deletes the
+// segments that have been consumed completely. When the whole spool has been consumed, the
+// segment open for appending is replaced with an empty one.
+func (s *diskSpool) ack(position spoolPosition) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.cursor = position
+
+	for len(s.segments) > 1 && s.segments[0] < position.segment {
+		_ = os.Remove(s.segmentPath(s.segments[0]))
+
+		delete(s.segmentSizes, s.segments[0])
+		s.segments = s.segments[1:]
+	}
+
+	lastId := s.segments[len(s.segments)-1]
+
+	if s.emptyLocked() && s.segmentSizes[lastId] > 0 {
+		err := s.newSegment(lastId + 1)
+		if err != nil {
+			return err
+		}
+
+		_ = os.Remove(s.segmentPath(lastId))
+
+		delete(s.segmentSizes, lastId)
+		s.segments = s.segments[1:]
+
+		s.cursor = spoolPosition{segment: lastId + 1}
+	}
+
+	return s.writeCursor()
+}
+
+// close closes the segment open for appending.
+func (s *diskSpool) close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// newSegment closes the current segment and creates segment id for appending.
+func (s *diskSpool) newSegment(id uint64) error {
+	file, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	s.file = file
+
+	s.segments = append(s.segments, id)
+	s.segmentSizes[id] = 0
+
+	return nil
+}
+
+// segmentPath returns the path of segment id.
+func (s *diskSpool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, spoolSegmentSuffix))
+}
+
+// readCursor reads the cursor file, returning the zero position when it is missing or invalid.
+func (s *diskSpool) readCursor() spoolPosition {
+	data, err := os.ReadFile(filepath.Join(s.dir, spoolCursorName))
+	if err != nil {
+		return spoolPosition{}
+	}
+
+	var position spoolPosition
+
+	_, err = fmt.Sscanf(string(data), "%d %d", &position.segment, &position.offset)
+	if err != nil || position.offset < 0 {
+		return spoolPosition{}
+	}
+
+	return position
+}
+
+// writeCursor persists the cursor atomically by writing a temporary file and renaming it.
+func (s *diskSpool) writeCursor() error {
+	cursorPath := filepath.Join(s.dir, spoolCursorName)
+	tempPath := cursorPath + ".tmp"
+
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "%d %d\n", s.cursor.segment, s.cursor.offset)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, cursorPath)
+}
+
+// readSpoolFrame reads one framed record of at most remaining bytes, header included, and
+// verifies its checksum.
+func readSpoolFrame(reader *bufio.Reader, remaining int64) ([]byte, error) {
+	var header [spoolFrameHeaderLen]byte
+
+	_, err := io.ReadFull(reader, header[:])
+	if err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if int64(length) > remaining-spoolFrameHeaderLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	record := make([]byte, length)
+
+	_, err = io.ReadFull(reader, record)
+	if err != nil {
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	return record, nil
+}
@@ -0,0 +1,287 @@
+package tlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestSpool(t *testing.T, dir string, segmentSize, maxSize int64, dropPolicy string) *diskSpool {
+	t.Helper()
+
+	spool, err := openDiskSpool(dir, segmentSize, maxSize, dropPolicy)
+	if err != nil {
+		t.Fatalf("openDiskSpool: %v", err)
+	}
+
+	t.Cleanup(func() { _ = spool.close() })
+
+	return spool
+}
+
+func spoolTestRecords(first, count int) [][]byte {
+	records := make([][]byte, count)
+	for i := range records {
+		records[i] = []byte(fmt.Sprintf("record-%02d", first+i))
+	}
+
+	return records
+}
+
+// spoolTestFrameLen is the size of one framed record returned by spoolTestRecords.
+const spoolTestFrameLen = spoolFrameHeaderLen + len("record-00")
+
+func appendTestRecords(t *testing.T, spool *diskSpool, records [][]byte) {
+	t.Helper()
+
+	dropped, err := spool.append(records)
+	if err != nil || dropped != 0 {
+		t.Fatalf("append: dropped %d, %v", dropped, err)
+	}
+}
+
+// drainSpool peeks and acknowledges records until the spool is empty.
+func drainSpool(t *testing.T, spool *diskSpool, batchSize int) []string {
+	t.Helper()
+
+	var records []string
+
+	for !spool.empty() {
+		batch, position, err := spool.peek(batchSize)
+		if err != nil {
+			t.Fatalf("peek: %v", err)
+		}
+
+		for _, record := range batch {
+			records = append(records, string(record))
+		}
+
+		err = spool.ack(position)
+		if err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+	}
+
+	return records
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func checkRecords(t *testing.T, got []string, first, count int) {
+	t.Helper()
+
+	if len(got) != count {
+		t.Fatalf("got %d records %q, want %d", len(got), got, count)
+	}
+
+	for i, record := range got {
+		if want := fmt.Sprintf("record-%02d", first+i); record != want {
+			t.Errorf("record %d = %q, want %q", i, record, want)
+		}
+	}
+}
+
+func TestSpoolAppendAndAck(t *testing.T) {
+	dir := t.TempDir()
+
+	// Three records fit into one segment.
+	spool := openTestSpool(t, dir, 3*int64(spoolTestFrameLen), 1<<20, SpoolDropNewest)
+
+	if !spool.empty() {
+		t.Fatal("new spool is not empty")
+	}
+
+	appendTestRecords(t, spool, spoolTestRecords(0, 5))
+	appendTestRecords(t, spool, spoolTestRecords(5, 5))
+
+	if got := len(segmentFiles(t, dir)); got != 4 {
+		t.Errorf("spool has %d segments, want 4", got)
+	}
+
+	checkRecords(t, drainSpool(t, spool, 4), 0, 10)
+
+	if got := len(segmentFiles(t, dir)); got != 1 {
+		t.Errorf("drained spool has %d segments, want 1", got)
+	}
+
+	if size := spool.totalSize(); size != 0 {
+		t.Errorf("drained spool holds %d bytes, want 0", size)
+	}
+}
+
+func TestSpoolDropNewest(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir(), 2*int64(spoolTestFrameLen), 4*int64(spoolTestFrameLen), SpoolDropNewest)
+
+	dropped, err := spool.append(spoolTestRecords(0, 6))
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	if dropped != 2 {
+		t.Errorf("dropped %d records, want 2", dropped)
+	}
+
+	checkRecords(t, drainSpool(t, spool, 10), 0, 4)
+}
+
+func TestSpoolDropOldest(t *testing.T) {
+	dir := t.TempDir()
+
+	spool := openTestSpool(t, dir, 2*int64(spoolTestFrameLen), 4*int64(spoolTestFrameLen), SpoolDropOldest)
+
+	dropped, err := spool.append(spoolTestRecords(0, 6))
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	if dropped != 0 {
+		t.Errorf("dropped %d records, want 0", dropped)
+	}
+
+	if size := spool.totalSize(); size > 4*int64(spoolTestFrameLen) {
+		t.Errorf("spool holds %d bytes, more than its maximum size", size)
+	}
+
+	checkRecords(t, drainSpool(t, spool, 10), 2, 4)
+}
+
+func TestSpoolResumesFromCursor(t *testing.T) {
+	dir := t.TempDir()
+
+	spool, err := openDiskSpool(dir, 3*int64(spoolTestFrameLen), 1<<20, SpoolDropNewest)
+	if err != nil {
+		t.Fatalf("openDiskSpool: %v", err)
+	}
+
+	appendTestRecords(t, spool, spoolTestRecords(0, 8))
+
+	records, position, err := spool.peek(4)
+	if err != nil {
+		t.Fatalf("peek: %v", err)
+	}
+
+	checkRecords(t, stringRecords(records), 0, 4)
+
+	err = spool.ack(position)
+	if err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+
+	// Records peeked but not acknowledged before a restart are replayed again.
+	_, _, err = spool.peek(2)
+	if err != nil {
+		t.Fatalf("peek: %v", err)
+	}
+
+	spool.close()
+
+	cursor, err := os.ReadFile(filepath.Join(dir, spoolCursorName))
+	if err != nil {
+		t.Fatalf("cursor file: %v", err)
+	}
+
+	if want := fmt.Sprintf("%d %d\n", position.segment, position.offset); string(cursor) != want {
+		t.Errorf("cursor file = %q, want %q", cursor, want)
+	}
+
+	restarted := openTestSpool(t, dir, 3*int64(spoolTestFrameLen), 1<<20, SpoolDropNewest)
+
+	// The first segment was acknowledged completely and is gone.
+	if got := len(segmentFiles(t, dir)); got != 2 {
+		t.Errorf("restarted spool has %d segments, want 2", got)
+	}
+
+	appendTestRecords(t, restarted, spoolTestRecords(8, 2))
+
+	checkRecords(t, drainSpool(t, restarted, 3), 4, 6)
+}
+
+func TestSpoolRecoversTornFrame(t *testing.T) {
+	dir := t.TempDir()
+
+	spool, err := openDiskSpool(dir, 1<<20, 1<<20, SpoolDropNewest)
+	if err != nil {
+		t.Fatalf("openDiskSpool: %v", err)
+	}
+
+	appendTestRecords(t, spool, spoolTestRecords(0, 3))
+
+	spool.close()
+
+	segments := segmentFiles(t, dir)
+	if len(segments) != 1 {
+		t.Fatalf("spool has %d segments, want 1", len(segments))
+	}
+
+	// A crash in the middle of the last write leaves a frame whose payload is cut short, which
+	// no longer matches its checksum.
+	err = os.Truncate(segments[0], int64(3*spoolTestFrameLen-2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := openTestSpool(t, dir, 1<<20, 1<<20, SpoolDropNewest)
+
+	if size := restarted.totalSize(); size != int64(2*spoolTestFrameLen) {
+		t.Errorf("recovered spool holds %d bytes, want %d", size, 2*spoolTestFrameLen)
+	}
+
+	appendTestRecords(t, restarted, spoolTestRecords(3, 1))
+
+	got := drainSpool(t, restarted, 10)
+
+	want := []string{"record-00", "record-01", "record-03"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("recovered records = %q, want %q", got, want)
+	}
+}
+
+func TestSpoolSkipsCorruptFrame(t *testing.T) {
+	dir := t.TempDir()
+
+	spool := openTestSpool(t, dir, 3*int64(spoolTestFrameLen), 1<<20, SpoolDropNewest)
+
+	appendTestRecords(t, spool, spoolTestRecords(0, 6))
+
+	// Flip a payload byte of the second record of the first segment, so that its checksum fails.
+	segments := segmentFiles(t, dir)
+
+	file, err := os.OpenFile(segments[0], os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = file.WriteAt([]byte("X"), int64(spoolTestFrameLen+spoolFrameHeaderLen))
+	file.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The corrupt record ends its segment; the records of the next segment are still replayed.
+	got := drainSpool(t, spool, 10)
+
+	want := []string{"record-00", "record-03", "record-04", "record-05"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+}
+
+func stringRecords(records [][]byte) []string {
+	strs := make([]string, len(records))
+	for i, record := range records {
+		strs[i] = string(record)
+	}
+
+	return strs
+}
@@ -0,0 +1,420 @@
+package tlog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/choveylee/tcfg"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// SyslogFormatRFC5424 selects the RFC 5424 message format with structured data.
+	SyslogFormatRFC5424 = "RFC5424"
+	// SyslogFormatRFC3164 selects the BSD syslog message format of RFC 3164.
+	SyslogFormatRFC3164 = "RFC3164"
+
+	// syslogSdId is the SD-ID of the structured data element holding trace correlation fields.
+	// 32473 is the private enterprise number reserved for documentation by RFC 5612.
+	syslogSdId = "tlog@32473"
+)
+
+// syslogLocalSockets lists the local syslog sockets tried, in order, when no address is configured.
+var syslogLocalSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogFacilities maps facility names accepted by configuration to facility codes.
+var syslogFacilities = map[string]int{
+	"KERN":     0,
+	"USER":     1,
+	"MAIL":     2,
+	"DAEMON":   3,
+	"AUTH":     4,
+	"SYSLOG":   5,
+	"LPR":      6,
+	"NEWS":     7,
+	"UUCP":     8,
+	"CRON":     9,
+	"AUTHPRIV": 10,
+	"FTP":      11,
+	"LOCAL0":   16,
+	"LOCAL1":   17,
+	"LOCAL2":   18,
+	"LOCAL3":   19,
+	"LOCAL4":   20,
+	"LOCAL5":   21,
+	"LOCAL6":   22,
+	"LOCAL7":   23,
+}
+
+// syslogSeverity maps a zerolog level to a syslog severity code.
+func syslogSeverity(level zerolog.Level) int {
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return 7
+	case zerolog.InfoLevel:
+		return 6
+	case zerolog.WarnLevel:
+		return 4
+	case zerolog.ErrorLevel:
+		return 3
+	case zerolog.FatalLevel:
+		return 2
+	case zerolog.PanicLevel:
+		return 1
+	default:
+		return 5
+	}
+}
+
+// parseSyslogFacility converts a facility name such as LOCAL0 or a numeric code to a facility code.
+func parseSyslogFacility(facility string) (int, error) {
+	if code, ok := syslogFacilities[strings.ToUpper(facility)]; ok {
+		return code, nil
+	}
+
+	code, err := strconv.Atoi(facility)
+	if err != nil || code < 0 || code > 23 {
+		return 0, fmt.Errorf("tlog syslog: invalid facility %q", facility)
+	}
+
+	return code, nil
+}
+
+// SyslogWriter implements zerolog.LevelWriter by sending records to a syslog server over UDP, TCP,
+// TLS, or a local unix socket. Records are formatted according to RFC 5424 or RFC 3164; TCP and TLS
+// use the octet-counting framing of RFC 6587, and unix stream sockets terminate each message with
+// a newline. A failed connection is re-established on a later write, with exponential backoff
+// between attempts; records written while waiting are dropped.
+type SyslogWriter struct {
+	// network is udp, tcp, tls, unix, or unixgram; empty selects the local syslog socket.
+	network string
+	address string
+
+	tlsConfig *tls.Config
+
+	facility int
+	format   string
+
+	hostname string
+	procId   string
+
+	conn reconnectingConn
+
+	sync.Mutex
+}
+
+// newSyslogWriter constructs a SyslogWriter. The connection is established on the first write.
+func newSyslogWriter(network, address string, tlsConfig *tls.Config, facility int, format string) *SyslogWriter {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	format = strings.ToUpper(format)
+	if format != SyslogFormatRFC3164 {
+		format = SyslogFormatRFC5424
+	}
+
+	syslogWriter := &SyslogWriter{
+		network: strings.ToLower(network),
+		address: address,
+
+		tlsConfig: tlsConfig,
+
+		facility: facility,
+		format:   format,
+
+		hostname: hostname,
+		procId:   strconv.Itoa(os.Getpid()),
+	}
+
+	syslogWriter.conn = reconnectingConn{dial: syslogWriter.dial, describe: syslogWriter.describe}
+
+	return syslogWriter
+}
+
+// loadSyslogWriter constructs a SyslogWriter from the syslog configuration keys read through tcfg.
+func loadSyslogWriter() (*SyslogWriter, error) {
+	network := tcfg.DefaultString(tcfg.LocalKey(LogSyslogNetwork), "")
+	address := tcfg.DefaultString(tcfg.LocalKey(LogSyslogAddress), "")
+
+	facility, err := parseSyslogFacility(tcfg.DefaultString(tcfg.LocalKey(LogSyslogFacility), "USER"))
+	if err != nil {
+		return nil, err
+	}
+
+	format := tcfg.DefaultString(tcfg.LocalKey(LogSyslogFormat), SyslogFormatRFC5424)
+
+	var tlsConfig *tls.Config
+
+	if strings.EqualFold(network, "tls") {
+		tlsConfig, err = newSyslogTlsConfig(address, tcfg.DefaultString(tcfg.LocalKey(LogSyslogTlsCa), ""))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newSyslogWriter(network, address, tlsConfig, facility, format), nil
+}
+
+// newSyslogTlsConfig returns a TLS configuration that verifies the server against the system
+// roots, extended with the PEM certificates in caFile when it is not empty.
+func newSyslogTlsConfig(address, caFile string) (*tls.Config, error) {
+	serverName, _, err := net.SplitHostPort(address)
+	if err != nil {
+		serverName = address
+	}
+
+	tlsConfig := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("tlog syslog: cannot read CA file %q: %w", caFile, err)
+	}
+
+	certPool, err := x509.SystemCertPool()
+	if err != nil {
+		certPool = x509.NewCertPool()
+	}
+
+	if !certPool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tlog syslog: no certificates found in CA file %q", caFile)
+	}
+
+	tlsConfig.RootCAs = certPool
+
+	return tlsConfig, nil
+}
+
+// Write implements io.Writer for records whose level is only known from their level field.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter. It formats one JSON record as a syslog message and
+// sends it, reconnecting once when the existing connection fails.
+func (w *SyslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	record, err := decodeRecord(p)
+	if err != nil {
+		return 0, fmt.Errorf("tlog syslog: cannot decode record: %w", err)
+	}
+
+	if level == zerolog.NoLevel {
+		if levelName, ok := record[fieldLevel].(string); ok {
+			level, _ = zerolog.ParseLevel(levelName)
+		}
+	}
+
+	message := w.buildMessage(level, record)
+
+	w.Lock()
+	defer w.Unlock()
+
+	err = w.conn.send(func(conn net.Conn) error {
+		return w.writeConn(conn, message)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("tlog syslog: %w", err)
+	}
+
+	return len(p), nil
+}
+
+// Close closes the connection to the syslog server.
+func (w *SyslogWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.conn.Close()
+}
+
+// writeConn writes one message to conn with the framing of the transport.
+func (w *SyslogWriter) writeConn(conn net.Conn, message []byte) error {
+	if w.isStream(conn) {
+		_ = conn.SetWriteDeadline(time.Now().Add(connWriteTimeout))
+
+		framed := make([]byte, 0, len(message)+12)
+
+		if _, ok := conn.(*net.UnixConn); ok {
+			// Local stream listeners such as rsyslog imuxsock expect newline-terminated messages.
+			framed = append(framed, message...)
+			framed = append(framed, '\n')
+		} else {
+			// RFC 6587 octet counting: MSG-LEN SP SYSLOG-MSG.
+			framed = strconv.AppendInt(framed, int64(len(message)), 10)
+			framed = append(framed, ' ')
+			framed = append(framed, message...)
+		}
+
+		message = framed
+	}
+
+	_, err := conn.Write(message)
+
+	return err
+}
+
+// isStream reports whether conn is a byte stream that needs message framing.
+func (w *SyslogWriter) isStream(conn net.Conn) bool {
+	switch conn.(type) {
+	case *net.TCPConn, *tls.Conn:
+		return true
+	case *net.UnixConn:
+		return w.network == "unix"
+	default:
+		return false
+	}
+}
+
+// dial connects to the configured server, or to the first available local syslog socket.
+func (w *SyslogWriter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: connDialTimeout}
+
+	switch w.network {
+	case "tls":
+		return tls.DialWithDialer(dialer, "tcp", w.address, w.tlsConfig)
+	case "udp", "tcp", "unix", "unixgram":
+		return dialer.Dial(w.network, w.address)
+	}
+
+	var err error
+
+	for _, socket := range syslogLocalSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, dialErr := dialer.Dial(network, socket)
+			if dialErr == nil {
+				w.network = network
+				w.address = socket
+
+				return conn, nil
+			}
+
+			err = dialErr
+		}
+	}
+
+	return nil, errors.Join(errors.New("no local syslog socket is available"), err)
+}
+
+// describe returns the network and address used in error messages.
+func (w *SyslogWriter) describe() string {
+	if w.network == "" {
+		return "local syslog"
+	}
+
+	return w.network + "://" + w.address
+}
+
+// buildMessage formats record as a syslog message. The app_name field becomes the APP-NAME or TAG
+// and the message field becomes the message text. With RFC 5424 the trace correlation fields are
+// written as structured data; the remaining fields, and with RFC 3164 all fields, are appended to
+// the message text in logfmt. Control characters in the message text are escaped, so that a
+// message cannot break the framing of the transport.
+func (w *SyslogWriter) buildMessage(level zerolog.Level, record map[string]any) []byte {
+	priority := w.facility*8 + syslogSeverity(level)
+
+	recordTime, ok := parseRecordTime(record[fieldTime])
+	if !ok {
+		recordTime = time.Now()
+	}
+
+	appName, _ := record[fieldAppName].(string)
+
+	text, _ := record[fieldMessage].(string)
+	text = sanitizeControl(ControlEscape, text)
+
+	var sdParams []string
+
+	var extra bytes.Buffer
+
+	for _, key := range recordKeys(record, fieldPriorityKeys) {
+		switch key {
+		case fieldTime, fieldLevel, fieldAppName, fieldMessage:
+			continue
+		case CtxTraceId, CtxSpanId, CtxTraceSampled:
+			if w.format == SyslogFormatRFC5424 {
+				sdParams = append(sdParams, syslogSdParam(key, record[key]))
+				continue
+			}
+		}
+
+		extra.WriteByte(' ')
+		extra.WriteString(logfmtKey(key))
+		extra.WriteByte('=')
+		extra.WriteString(logfmtValue(ControlEscape, record[key]))
+	}
+
+	var buf bytes.Buffer
+
+	if w.format == SyslogFormatRFC3164 {
+		fmt.Fprintf(&buf, "<%d>%s %s %s[%s]: ",
+			priority,
+			recordTime.Local().Format(time.Stamp),
+			w.hostname,
+			syslogToken(appName, 32),
+			w.procId,
+		)
+	} else {
+		structuredData := "-"
+		if len(sdParams) > 0 {
+			structuredData = "[" + syslogSdId + " " + strings.Join(sdParams, " ") + "]"
+		}
+
+		fmt.Fprintf(&buf, "<%d>1 %s %s %s %s - %s ",
+			priority,
+			recordTime.Format("2006-01-02T15:04:05.000000Z07:00"),
+			syslogToken(w.hostname, 255),
+			syslogToken(appName, 48),
+			w.procId,
+			structuredData,
+		)
+	}
+
+	buf.WriteString(text)
+	buf.Write(extra.Bytes())
+
+	return buf.Bytes()
+}
+
+// syslogToken returns value restricted to printable US-ASCII without spaces and truncated to
+// maxLen, or the nil value "-" when nothing remains.
+func syslogToken(value string, maxLen int) string {
+	var buf strings.Builder
+
+	for i := 0; i < len(value) && buf.Len() < maxLen; i++ {
+		if value[i] > ' ' && value[i] < 0x7f {
+			buf.WriteByte(value[i])
+		}
+	}
+
+	if buf.Len() == 0 {
+		return "-"
+	}
+
+	return buf.String()
+}
+
+// syslogSdParam formats one SD-PARAM, escaping the characters RFC 5424 requires in PARAM-VALUE.
+func syslogSdParam(key string, value any) string {
+	str, ok := value.(string)
+	if !ok {
+		str = fmt.Sprintf("%v", value)
+	}
+
+	str = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(str)
+
+	return syslogToken(strings.ReplaceAll(key, "=", "_"), 32) + `="` + str + `"`
+}
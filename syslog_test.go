@@ -0,0 +1,192 @@
+package tlog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const syslogTestRecord = `{"level":"warn","app_name":"billing","time":"2026-01-02T03:04:05Z","message":"card declined",` +
+	`"trace_id":"0af7651916cd43dd8448eb211c80319c","order_id":"A-17"}` + "\n"
+
+// acceptOne accepts one connection on listener and returns everything read from it until it is
+// closed.
+func acceptOne(t *testing.T, listener net.Listener) <-chan string {
+	t.Helper()
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+
+		defer conn.Close()
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	return received
+}
+
+func writeSyslogTestRecords(t *testing.T, syslogWriter *SyslogWriter, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		_, err := syslogWriter.WriteLevel(zerolog.WarnLevel, []byte(syslogTestRecord))
+		if err != nil {
+			t.Fatalf("WriteLevel: %v", err)
+		}
+	}
+
+	syslogWriter.Close()
+}
+
+func checkSyslogMessage(t *testing.T, message string) {
+	t.Helper()
+
+	// LOCAL0 (16) * 8 + warning (4) = 132.
+	prefix := "<132>1 2026-01-02T03:04:05.000000Z "
+	if !strings.HasPrefix(message, prefix) {
+		t.Errorf("message %q does not start with %q", message, prefix)
+	}
+
+	for _, part := range []string{" billing ", `[tlog@32473 trace_id="0af7651916cd43dd8448eb211c80319c"]`,
+		" card declined order_id=A-17"} {
+		if !strings.Contains(message, part) {
+			t.Errorf("message %q does not contain %q", message, part)
+		}
+	}
+
+	if strings.Contains(message, "\n") {
+		t.Errorf("message %q contains a newline", message)
+	}
+}
+
+func TestSyslogUdp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+
+	defer conn.Close()
+
+	syslogWriter := newSyslogWriter("udp", conn.LocalAddr().String(), nil, 16, SyslogFormatRFC5424)
+
+	writeSyslogTestRecords(t, syslogWriter, 1)
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 4096)
+
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+
+	checkSyslogMessage(t, string(buf[:n]))
+}
+
+func TestSyslogTcpOctetCounting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on tcp: %v", err)
+	}
+
+	defer listener.Close()
+
+	received := acceptOne(t, listener)
+
+	syslogWriter := newSyslogWriter("tcp", listener.Addr().String(), nil, 16, SyslogFormatRFC5424)
+
+	writeSyslogTestRecords(t, syslogWriter, 2)
+
+	data := <-received
+
+	for i := 0; i < 2; i++ {
+		length, rest, ok := strings.Cut(data, " ")
+		if !ok {
+			t.Fatalf("frame %d of %q has no MSG-LEN", i, data)
+		}
+
+		n, err := strconv.Atoi(length)
+		if err != nil || n > len(rest) {
+			t.Fatalf("frame %d has MSG-LEN %q, with %d bytes following", i, length, len(rest))
+		}
+
+		checkSyslogMessage(t, rest[:n])
+
+		data = rest[n:]
+	}
+
+	if data != "" {
+		t.Errorf("unexpected data %q after the frames", data)
+	}
+}
+
+func TestSyslogUnixStreamNewlineFraming(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "log")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("cannot listen on a unix socket: %v", err)
+	}
+
+	defer listener.Close()
+
+	received := acceptOne(t, listener)
+
+	syslogWriter := newSyslogWriter("unix", socket, nil, 16, SyslogFormatRFC5424)
+
+	writeSyslogTestRecords(t, syslogWriter, 2)
+
+	scanner := bufio.NewScanner(strings.NewReader(<-received))
+
+	lines := 0
+	for scanner.Scan() {
+		checkSyslogMessage(t, scanner.Text())
+		lines++
+	}
+
+	if lines != 2 {
+		t.Errorf("listener read %d lines, want 2", lines)
+	}
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "log")
+
+	conn, err := net.ListenPacket("unixgram", socket)
+	if err != nil {
+		t.Skipf("cannot listen on a unixgram socket: %v", err)
+	}
+
+	defer conn.Close()
+
+	syslogWriter := newSyslogWriter("unixgram", socket, nil, 16, SyslogFormatRFC5424)
+
+	writeSyslogTestRecords(t, syslogWriter, 1)
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 4096)
+
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+
+	checkSyslogMessage(t, string(buf[:n]))
+}
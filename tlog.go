@@ -2,42 +2,58 @@ package tlog
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	stdlog "log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
-	"time"
 
 	"github.com/choveylee/tcfg"
 	"github.com/choveylee/ttrace"
+	"github.com/json-iterator/go"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var defaultLog *Tlog
 
-var (
-	initSentryFunc = initSentry
-
-	sentryInitLogf = func(format string, args ...any) {
-		stdlog.Printf(format, args...)
-	}
-)
+var initSentryFunc = initSentry
 
 const (
 	// CtxTraceId is the field key used for the distributed trace identifier in structured output.
 	CtxTraceId string = "trace_id"
-
-	// maxDetailLen is the maximum length of the joined detail payload before truncation.
-	maxDetailLen = 10000
+	// CtxSpanId is the field key used for the identifier of the active span in structured output.
+	CtxSpanId string = "span_id"
+	// CtxTraceSampled is the field key used for the sampled flag of the active span in structured output.
+	CtxTraceSampled string = "trace_sampled"
 )
 
 // Tlog wraps the zerolog.Logger used as the package default logger after initialization.
 type Tlog struct {
 	logger zerolog.Logger
+	writer zerolog.LevelWriter
+
+	// fields holds the timestamp layout and output key names used by this logger's writers.
+	fields *fieldConfig
+
+	// redactor masks sensitive values before they are encoded; nil disables redaction.
+	redactor *redactor
+
+	// limits holds the byte budgets of the values of each event.
+	limits sizeLimits
+
+	// spanEvent records WARN and higher events on the active span of the event context.
+	spanEvent bool
+
+	// errorDetail records the dynamic type and stack trace of errors passed to Tevent.Err, for
+	// the writers that report them.
+	errorDetail bool
 }
 
 // Tevent represents a structured log event under construction.
@@ -49,10 +65,28 @@ type Tevent struct {
 
 	// details stores fragments from Detail and Detailf, joined into field "detail" on emit.
 	details []string
+
+	// tl is the logger that created the event.
+	tl *Tlog
+
+	// err is the error recorded by Err, kept for span events.
+	err error
+
+	// span is the span that receives the event as a span event; nil when span events are disabled.
+	span trace.Span
+
+	// used counts the bytes of the values charged against the event budget, and truncated lists
+	// the keys of the values cut to their budget.
+	used      int
+	truncated []string
 }
 
 func init() {
-	zerolog.TimeFieldFormat = time.RFC3339
+	setErrorInterval(tcfg.DefaultDuration(tcfg.LocalKey(LogErrorInterval), DefaultErrorInterval))
+
+	zerolog.ErrorHandler = func(err error) {
+		reportError("logger", OpWrite, "", err)
+	}
 
 	logLevel := tcfg.DefaultString(tcfg.LocalKey(LogLevel), "INFO")
 	setGlobalLevel(logLevel)
@@ -70,33 +104,256 @@ func init() {
 		appName = strings.TrimSuffix(fileName, fileExt)
 	}
 
-	var writer zerolog.LevelWriter
+	fields := loadFieldConfig()
+
+	logFormat := tcfg.DefaultString(tcfg.LocalKey(LogFormat), LogFormatJson)
+
+	isolation := loadIsolationConfig()
+
+	var writers []io.Writer
+
+	outputs, err := loadOutputs()
+	if err != nil {
+		reportError("outputs", OpInit, "", fmt.Errorf("configured outputs have been ignored: %w", err))
+	}
+
+	if outputs != "" {
+		outputRouter, err := newRouter(outputs, appName, fields, isolation)
+		if err != nil {
+			reportError("outputs", OpInit, "", fmt.Errorf("configured outputs have been ignored: %w", err))
+		} else {
+			writers = append(writers, outputRouter)
+		}
+	}
+
+	if len(writers) == 0 {
+		stdoutWriter := newFormatWriter(logFormat, noCloseWriter{Writer: os.Stdout}, fields)
+
+		stderrLevel := tcfg.DefaultString(tcfg.LocalKey(LogStderrLevel), "")
+		if stderrLevel != "" {
+			level, ok := parseLevel(stderrLevel)
+			if !ok {
+				reportError("stderr", OpInit, "", fmt.Errorf("invalid stderr level %q has been ignored", stderrLevel))
+			} else {
+				stdoutWriter = &splitWriter{
+					low:  stdoutWriter,
+					high: newFormatWriter(logFormat, noCloseWriter{Writer: os.Stderr}, fields),
+
+					level: level,
+				}
+			}
+		}
+
+		writers = append(writers, isolate(isolation, "stdout", stdoutWriter))
+
+		logFileEnable := tcfg.DefaultBool(tcfg.LocalKey(LogFileEnable), false)
+		if logFileEnable {
+			filePath := tcfg.DefaultString(tcfg.LocalKey(LogFilePath), fmt.Sprintf("%s.log", appName))
+
+			fileSize := tcfg.DefaultInt(tcfg.LocalKey(LogFileSize), 500)
+
+			fileRotate := tcfg.DefaultInt(tcfg.LocalKey(LogFileRotate), 1)
+
+			fileExpired := tcfg.DefaultInt(tcfg.LocalKey(LogFileExpired), 0)
+			fileCount := tcfg.DefaultInt(tcfg.LocalKey(LogFileCount), 0)
+
+			fileCompress := tcfg.DefaultBool(tcfg.LocalKey(LogFileCompress), false)
+
+			logFileFormat := tcfg.DefaultString(tcfg.LocalKey(LogFileFormat), LogFormatJson)
+
+			rotateWriter := newRotateWriter(filePath, fileSize, fileRotate, fileExpired, fileCount, fileCompress)
+			rotateWriter.setFallback(tcfg.DefaultString(tcfg.LocalKey(LogFileFallback), FileFallbackStderr))
+
+			fileWriter := newFormatWriter(logFileFormat, noCloseWriter{Writer: rotateWriter}, fields)
+
+			writers = append(writers, isolate(isolation, "file", fileWriter))
+		}
+	}
+
+	redactor, err := loadRedactor()
+	if err != nil {
+		reportError("redaction", OpInit, "", fmt.Errorf("redaction has been disabled: %w", err))
+	}
+
+	writers = append(writers, withoutErrorDetail(&SentryWriter{redactor: redactor}))
+
+	webhookUrl := tcfg.DefaultString(tcfg.LocalKey(LogWebhookUrl), "")
+	if webhookUrl != "" {
+		webhookLevel, ok := parseLevel(tcfg.DefaultString(tcfg.LocalKey(LogWebhookLevel), LogLevelError))
+		if !ok {
+			webhookLevel = zerolog.ErrorLevel
+		}
 
-	logFileEnable := tcfg.DefaultBool(tcfg.LocalKey(LogFileEnable), false)
-	if logFileEnable {
-		filePath := tcfg.DefaultString(tcfg.LocalKey(LogFilePath), fmt.Sprintf("%s.log", appName))
+		webhookTemplate := tcfg.DefaultString(tcfg.LocalKey(LogWebhookTemplate), DefaultWebhookTemplate)
+		webhookHeaders := parseHeaders(tcfg.DefaultString(tcfg.LocalKey(LogWebhookHeaders), ""))
+		webhookTimeout := tcfg.DefaultDuration(tcfg.LocalKey(LogWebhookTimeout), DefaultSendTimeout)
 
-		fileSize := tcfg.DefaultInt(tcfg.LocalKey(LogFileSize), 500)
+		webhookBatchSize := tcfg.DefaultInt(tcfg.LocalKey(LogWebhookBatchSize), DefaultBatchSize)
+		webhookBatchInterval := tcfg.DefaultDuration(tcfg.LocalKey(LogWebhookBatchInterval), DefaultBatchInterval)
 
-		fileRotate := tcfg.DefaultInt(tcfg.LocalKey(LogFileRotate), 1)
+		webhookBreakerThreshold := tcfg.DefaultInt(tcfg.LocalKey(LogWebhookBreakerThreshold), DefaultBreakerThreshold)
+		webhookBreakerCooldown := tcfg.DefaultDuration(tcfg.LocalKey(LogWebhookBreakerCooldown), DefaultBreakerCooldown)
 
-		fileExpired := tcfg.DefaultInt(tcfg.LocalKey(LogFileExpired), 0)
-		fileCount := tcfg.DefaultInt(tcfg.LocalKey(LogFileCount), 0)
+		webhookWriter, err := newWebhookWriter(webhookUrl, webhookLevel, webhookTemplate, webhookHeaders, webhookTimeout,
+			webhookBatchSize, webhookBatchInterval, webhookBreakerThreshold, webhookBreakerCooldown)
+		if err != nil {
+			reportError("webhook", OpInit, "", fmt.Errorf("webhook has been disabled: %w", err))
+		} else {
+			writers = append(writers, withoutErrorDetail(webhookWriter))
+		}
+	}
 
-		fileCompress := tcfg.DefaultBool(tcfg.LocalKey(LogFileCompress), false)
+	syslogEnable := tcfg.DefaultBool(tcfg.LocalKey(LogSyslogEnable), false)
+	if syslogEnable {
+		syslogWriter, err := loadSyslogWriter()
+		if err != nil {
+			reportError("syslog", OpInit, "", fmt.Errorf("syslog output has been disabled: %w", err))
+		} else {
+			writers = append(writers, isolate(isolation, "syslog", withoutErrorDetail(syslogWriter)))
+		}
+	}
 
-		rotateWriter := newRotateWriter(filePath, fileSize, fileRotate, fileExpired, fileCount, fileCompress)
+	journaldEnable := tcfg.DefaultBool(tcfg.LocalKey(LogJournaldEnable), false)
+	if journaldEnable {
+		journaldSocket := tcfg.DefaultString(tcfg.LocalKey(LogJournaldSocket), DefaultJournaldSocket)
 
-		writer = zerolog.MultiLevelWriter(os.Stdout, &SentryWriter{}, noCloseWriter{Writer: rotateWriter})
-	} else {
-		writer = zerolog.MultiLevelWriter(os.Stdout, &SentryWriter{})
+		writers = append(writers, isolate(isolation, "journald", withoutErrorDetail(newJournaldWriter(journaldSocket))))
 	}
 
-	defaultLog = &Tlog{
-		logger: log.Logger.With().Str("app_name", appName).Logger().Output(writer),
+	gelfAddress := tcfg.DefaultString(tcfg.LocalKey(LogGelfAddress), "")
+	if gelfAddress != "" {
+		gelfNetwork := tcfg.DefaultString(tcfg.LocalKey(LogGelfNetwork), "udp")
+		gelfCompression := tcfg.DefaultString(tcfg.LocalKey(LogGelfCompression), GelfCompressionGzip)
+		gelfChunkSize := tcfg.DefaultInt(tcfg.LocalKey(LogGelfChunkSize), DefaultGelfChunkSize)
+
+		gelfWriter, err := newGelfWriter(gelfNetwork, gelfAddress, gelfCompression, gelfChunkSize)
+		if err != nil {
+			reportError("gelf", OpInit, "", fmt.Errorf("GELF output has been disabled: %w", err))
+		} else {
+			writers = append(writers, isolate(isolation, "gelf", withoutErrorDetail(gelfWriter)))
+		}
+	}
+
+	fluentAddress := tcfg.DefaultString(tcfg.LocalKey(LogFluentAddress), "")
+	if fluentAddress != "" {
+		fluentAck := tcfg.DefaultBool(tcfg.LocalKey(LogFluentAck), false)
+
+		fluentSharedKey := tcfg.DefaultString(tcfg.LocalKey(LogFluentSharedKey), "")
+		fluentUsername := tcfg.DefaultString(tcfg.LocalKey(LogFluentUsername), "")
+		fluentPassword := tcfg.DefaultString(tcfg.LocalKey(LogFluentPassword), "")
+
+		fluentTimeout := tcfg.DefaultDuration(tcfg.LocalKey(LogFluentTimeout), DefaultSendTimeout)
+
+		fluentBatchSize := tcfg.DefaultInt(tcfg.LocalKey(LogFluentBatchSize), DefaultBatchSize)
+		fluentBatchInterval := tcfg.DefaultDuration(tcfg.LocalKey(LogFluentBatchInterval), DefaultBatchInterval)
+
+		fluentWriter, err := newFluentWriter(fluentAddress, fluentAck, fluentSharedKey, fluentUsername, fluentPassword,
+			fluentTimeout, fluentBatchSize, fluentBatchInterval)
+		if err != nil {
+			reportError("fluent", OpInit, "", fmt.Errorf("Fluentd output has been disabled: %w", err))
+		} else {
+			writers = append(writers, withoutErrorDetail(fluentWriter))
+		}
+	}
+
+	otlpEndpoint := tcfg.DefaultString(tcfg.LocalKey(LogOtlpEndpoint), "")
+	if otlpEndpoint != "" {
+		otlpHeaders := parseHeaders(tcfg.DefaultString(tcfg.LocalKey(LogOtlpHeaders), ""))
+		otlpTimeout := tcfg.DefaultDuration(tcfg.LocalKey(LogOtlpTimeout), DefaultSendTimeout)
+
+		otlpBatchSize := tcfg.DefaultInt(tcfg.LocalKey(LogOtlpBatchSize), DefaultBatchSize)
+		otlpBatchInterval := tcfg.DefaultDuration(tcfg.LocalKey(LogOtlpBatchInterval), DefaultBatchInterval)
+
+		otlpWriter, err := newOtlpWriter(otlpEndpoint, otlpHeaders, otlpTimeout, otlpBatchSize, otlpBatchInterval)
+		if err != nil {
+			reportError("otlp", OpInit, "", fmt.Errorf("OTLP log export has been disabled: %w", err))
+		} else {
+			writers = append(writers, otlpWriter)
+		}
+	}
+
+	lokiEndpoint := tcfg.DefaultString(tcfg.LocalKey(LogLokiEndpoint), "")
+	if lokiEndpoint != "" {
+		lokiLabels := tcfg.DefaultStrings(tcfg.LocalKey(LogLokiLabels), ",", DefaultLokiLabels)
+		lokiEncoding := tcfg.DefaultString(tcfg.LocalKey(LogLokiEncoding), LokiEncodingProtobuf)
+		lokiTenant := tcfg.DefaultString(tcfg.LocalKey(LogLokiTenant), "")
+		lokiTimeout := tcfg.DefaultDuration(tcfg.LocalKey(LogLokiTimeout), DefaultSendTimeout)
+
+		lokiBatchSize := tcfg.DefaultInt(tcfg.LocalKey(LogLokiBatchSize), DefaultBatchSize)
+		lokiBatchAge := tcfg.DefaultDuration(tcfg.LocalKey(LogLokiBatchAge), DefaultBatchInterval)
+
+		lokiWriter, err := newLokiWriter(lokiEndpoint, lokiLabels, lokiEncoding, lokiTenant, lokiTimeout, lokiBatchSize, lokiBatchAge)
+		if err != nil {
+			reportError("loki", OpInit, "", fmt.Errorf("Loki output has been disabled: %w", err))
+		} else {
+			writers = append(writers, withoutErrorDetail(lokiWriter))
+		}
+	}
+
+	esEndpoint := tcfg.DefaultString(tcfg.LocalKey(LogEsEndpoint), "")
+	if esEndpoint != "" {
+		esIndex := tcfg.DefaultString(tcfg.LocalKey(LogEsIndex), appName)
+		esFormat := tcfg.DefaultString(tcfg.LocalKey(LogEsFormat), LogFormatJson)
+
+		esUsername := tcfg.DefaultString(tcfg.LocalKey(LogEsUsername), "")
+		esPassword := tcfg.DefaultString(tcfg.LocalKey(LogEsPassword), "")
+		esApiKey := tcfg.DefaultString(tcfg.LocalKey(LogEsApiKey), "")
+
+		esTimeout := tcfg.DefaultDuration(tcfg.LocalKey(LogEsTimeout), DefaultSendTimeout)
+
+		esFlushSize := tcfg.DefaultInt(tcfg.LocalKey(LogEsFlushSize), DefaultBatchSize)
+		esFlushInterval := tcfg.DefaultDuration(tcfg.LocalKey(LogEsFlushInterval), DefaultBatchInterval)
+
+		esFallback, err := newEsFallback(tcfg.DefaultString(tcfg.LocalKey(LogEsFallback), "stderr"))
+		if err == nil {
+			var esWriter *EsWriter
+
+			esWriter, err = newEsWriter(esEndpoint, esIndex, esFormat, fields, esUsername, esPassword, esApiKey,
+				esFallback, esTimeout, esFlushSize, esFlushInterval)
+			if err == nil {
+				writers = append(writers, esWriter)
+			}
+		}
+
+		if err != nil {
+			reportError("elasticsearch", OpInit, "", fmt.Errorf("Elasticsearch output has been disabled: %w", err))
+		}
+	}
+
+	writer := zerolog.MultiLevelWriter(writers...)
+
+	defaultLog = newTlog(appName, writer, fields)
+	defaultLog.redactor = redactor
+	defaultLog.errorDetail = reportsErrorDetail(writers...)
+	defaultLog.limits = loadSizeLimits()
+	defaultLog.spanEvent = tcfg.DefaultBool(tcfg.LocalKey(LogSpanEvent), false)
+}
+
+// newTlog constructs a Tlog that writes records tagged with appName to writer. Timestamps are
+// added by fields rather than through zerolog's global time settings.
+func newTlog(appName string, writer zerolog.LevelWriter, fields *fieldConfig) *Tlog {
+	return &Tlog{
+		logger: zerolog.New(writer).With().Str(fieldAppName, appName).Logger().Hook(fields),
+		writer: writer,
+
+		fields: fields,
+
+		limits: defaultSizeLimits(),
 	}
 }
 
+// Close flushes and stops the writers of the default logger that buffer records, such as the
+// OTLP exporter and the Sentry client. Call it before the process exits so that queued records
+// are delivered; records logged after Close may be lost.
+func Close() error {
+	closer, ok := defaultLog.writer.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	return closer.Close()
+}
+
 func startSentryInit(sentryDsn string) {
 	beginSentryInit()
 
@@ -105,11 +362,11 @@ func startSentryInit(sentryDsn string) {
 		finishSentryInit(err)
 
 		if err != nil {
-			sentryInitLogf(
-				"tlog: failed to initialize Sentry after %d attempts; error event forwarding has been disabled: %v",
+			reportError("sentry", OpInit, "", fmt.Errorf(
+				"failed to initialize Sentry after %d attempts; error event forwarding has been disabled: %w",
 				sentryInitAttempts,
 				err,
-			)
+			))
 		}
 	}()
 }
@@ -117,21 +374,31 @@ func startSentryInit(sentryDsn string) {
 // setGlobalLevel applies the global zerolog level from a case-insensitive name. Unrecognized
 // names default to info.
 func setGlobalLevel(level string) {
+	globalLevel, ok := parseLevel(level)
+	if !ok {
+		globalLevel = zerolog.InfoLevel
+	}
+
+	zerolog.SetGlobalLevel(globalLevel)
+}
+
+// parseLevel converts a level name such as WARN, matched case-insensitively, to a zerolog level.
+func parseLevel(level string) (zerolog.Level, bool) {
 	switch strings.ToUpper(level) {
 	case "DEBUG":
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		return zerolog.DebugLevel, true
 	case "INFO":
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		return zerolog.InfoLevel, true
 	case "WARN":
-		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		return zerolog.WarnLevel, true
 	case "ERROR":
-		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+		return zerolog.ErrorLevel, true
 	case "FATAL":
-		zerolog.SetGlobalLevel(zerolog.FatalLevel)
+		return zerolog.FatalLevel, true
 	case "PANIC":
-		zerolog.SetGlobalLevel(zerolog.PanicLevel)
+		return zerolog.PanicLevel, true
 	default:
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		return zerolog.NoLevel, false
 	}
 }
 
@@ -143,36 +410,50 @@ func newTevent(level string, tl *Tlog) *Tevent {
 		return &Tevent{
 			event: tl.logger.Debug(),
 			level: zerolog.DebugLevel,
+
+			tl: tl,
 		}
 	case "INFO":
 		return &Tevent{
 			event: tl.logger.Info(),
 			level: zerolog.InfoLevel,
+
+			tl: tl,
 		}
 	case "WARN":
 		return &Tevent{
 			event: tl.logger.Warn(),
 			level: zerolog.WarnLevel,
+
+			tl: tl,
 		}
 	case "ERROR":
 		return addCaller(&Tevent{
 			event: tl.logger.Error(),
 			level: zerolog.ErrorLevel,
+
+			tl: tl,
 		})
 	case "FATAL":
 		return addCaller(&Tevent{
 			event: tl.logger.Fatal(),
 			level: zerolog.FatalLevel,
+
+			tl: tl,
 		})
 	case "PANIC":
 		return addCaller(&Tevent{
 			event: tl.logger.Panic(),
 			level: zerolog.PanicLevel,
+
+			tl: tl,
 		})
 	default:
 		return &Tevent{
 			event: tl.logger.Info(),
 			level: zerolog.InfoLevel,
+
+			tl: tl,
 		}
 	}
 }
@@ -219,7 +500,7 @@ func (p *Tevent) Detail(value string) *Tevent {
 		return p
 	}
 
-	p.details = append(p.details, value)
+	p.details = append(p.details, p.tl.redactor.redactString(value))
 	return p
 }
 
@@ -230,32 +511,171 @@ func (p *Tevent) Detailf(format string, a ...any) *Tevent {
 		return p
 	}
 
-	p.details = append(p.details, fmt.Sprintf(format, a...))
+	p.details = append(p.details, p.tl.redactor.redactString(fmt.Sprintf(format, a...)))
 	return p
 }
 
-// Err records err under the "error" field when err is non-nil.
+// Err records err under the "error" field when err is non-nil. When a writer of the logger needs
+// them, the dynamic type and stack trace of err are recorded as well.
 func (p *Tevent) Err(err error) *Tevent {
 	if err != nil && p.enabled() {
-		p.event = p.event.Str("error", err.Error())
+		msg, _ := p.limit(fieldError, p.tl.redactor.redactString(err.Error()))
+
+		p.event = p.event.Str(fieldError, msg)
+		p.err = err
+
+		if msg != err.Error() {
+			p.err = &redactedError{msg: msg, err: err}
+		}
+
+		if p.tl.errorDetail {
+			p.event = p.event.Str(fieldErrorType, fmt.Sprintf("%T", err))
+
+			if stack := errorStack(err); stack != "" {
+				stack, _ = p.limit(fieldErrorStack, p.tl.redactor.redactString(stack))
+
+				p.event = p.event.Str(fieldErrorStack, stack)
+			}
+		}
 	}
 
 	return p
 }
 
-// Msg records content as the event message and returns content unchanged.
-func (p *Tevent) Msg(content string) string {
+// Str records value under the field key. Values of sensitive fields are redacted when redaction
+// is enabled.
+func (p *Tevent) Str(key, value string) *Tevent {
+	key = userKey(key)
+
 	if !p.enabled() {
-		return content
+		return p
 	}
 
-	p.attachDetail()
+	value, _ = p.limit(key, p.tl.redactor.redactField(key, value))
 
-	if p.level == zerolog.PanicLevel {
-		defer flushSentry()
+	p.event = p.event.Str(key, value)
+
+	return p
+}
+
+// Object records v under the field key. Structs are logged field by field as controlled by the
+// [ObjectTag] struct tag, and values implementing [LogMarshaler] are logged as the value returned
+// by MarshalLog. When redaction is enabled, sensitive fields and strings are redacted as by
+// [Tevent.Any].
+func (p *Tevent) Object(key string, v any) *Tevent {
+	key = userKey(key)
+
+	if !p.enabled() {
+		return p
+	}
+
+	if p.tl.redactor.pseudonymous(key) {
+		return p.Str(key, string(objectValueText(reflect.ValueOf(v))))
+	}
+
+	if p.tl.redactor.sensitive(key) {
+		p.event = p.event.Str(key, RedactedValue)
+		return p
+	}
+
+	encoder := objectEncoder{
+		redactor: p.tl.redactor,
+
+		path: make(map[uintptr]bool),
+	}
+
+	p.interfaceField(key, encoder.encode(reflect.ValueOf(v), 0))
+
+	return p
+}
+
+// Any records value under the field key, encoded as JSON. When redaction is enabled, sensitive
+// fields and object members are redacted, all strings and numbers are checked against the
+// redaction rules, and a value that cannot be encoded is redacted as a whole.
+func (p *Tevent) Any(key string, value any) *Tevent {
+	key = userKey(key)
+
+	if !p.enabled() {
+		return p
+	}
+
+	if p.tl.redactor == nil {
+		p.interfaceField(key, value)
+		return p
+	}
+
+	if p.tl.redactor.pseudonymous(key) {
+		p.event = p.event.Str(key, p.tl.redactor.pseudonym(pseudonymText(value)))
+		return p
+	}
+
+	if p.tl.redactor.sensitive(key) {
+		p.event = p.event.Str(key, RedactedValue)
+		return p
+	}
+
+	// A value that cannot be checked against the rules is not written at all.
+	data, err := jsoniter.Marshal(value)
+	if err != nil {
+		p.event = p.event.Str(key, RedactedValue)
+		return p
+	}
+
+	decoded, err := decodeJsonValue(data)
+	if err != nil {
+		p.event = p.event.Str(key, RedactedValue)
+		return p
+	}
+
+	p.interfaceField(key, p.tl.redactor.redactValue(decoded))
+
+	return p
+}
+
+// interfaceField records value under the field key, encoded as JSON. A string over its byte
+// budget is cut like any other string. An object or array over its budget is recorded empty, so
+// that the field keeps its type, and its cut encoding is recorded as a string under the key with
+// the suffix _truncated.
+func (p *Tevent) interfaceField(key string, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		p.event = p.event.Interface(key, value)
+		return
 	}
 
-	p.event.Msg(content)
+	var str string
+	if data[0] == '"' && json.Unmarshal(data, &str) == nil {
+		str, _ = p.limit(key, str)
+		p.event = p.event.Str(key, str)
+		return
+	}
+
+	text, cut := p.limit(key, string(data))
+	if !cut {
+		p.event = p.event.RawJSON(key, data)
+		return
+	}
+
+	switch data[0] {
+	case '{':
+		p.event = p.event.RawJSON(key, []byte("{}"))
+	case '[':
+		p.event = p.event.RawJSON(key, []byte("[]"))
+	default:
+		p.event = p.event.Str(key, text)
+		return
+	}
+
+	p.event = p.event.Str(key+truncatedKeySuffix, text)
+}
+
+// Msg records content as the event message and returns content unchanged.
+func (p *Tevent) Msg(content string) string {
+	if !p.enabled() {
+		return content
+	}
+
+	p.emit(content)
 
 	return content
 }
@@ -269,21 +689,35 @@ func (p *Tevent) Msgf(format string, a ...any) string {
 		return fmt.Sprintf(format, a...)
 	}
 
-	p.attachDetail()
+	content = fmt.Sprintf(format, a...)
+
+	p.emit(content)
+
+	return content
+}
+
+// emit writes the event with content as its message, after the detail and the truncated field.
+func (p *Tevent) emit(content string) {
+	message, _ := p.limit(fieldMessage, content)
+
+	detail := p.attachDetail()
+
+	if len(p.truncated) > 0 {
+		p.event = p.event.Strs(fieldTruncated, p.truncated)
+	}
+
+	p.recordSpan(message, detail)
 
 	if p.level == zerolog.PanicLevel {
 		defer flushSentry()
 	}
 
-	p.event.MsgFunc(func() string {
-		content = fmt.Sprintf(format, a...)
-		return content
-	})
-
-	return content
+	p.event.Msg(message)
 }
 
-// injectTraceId adds CtxTraceId to the event when ctx holds a valid trace ID.
+// injectTraceId adds CtxTraceId to the event when ctx holds a valid trace ID, and CtxSpanId and
+// CtxTraceSampled when ctx also carries a valid span. When span events are enabled, WARN and
+// higher events remember the span of ctx for recordSpan.
 func injectTraceId(revent *Tevent, ctx context.Context) *Tevent {
 	if !revent.enabled() {
 		return revent
@@ -294,15 +728,48 @@ func injectTraceId(revent *Tevent, ctx context.Context) *Tevent {
 		revent.event = revent.event.Str(CtxTraceId, traceId.String())
 	}
 
+	spanContext := ttrace.GetSpanContext(ctx)
+	if spanContext.IsValid() {
+		revent.event = revent.event.Str(CtxSpanId, spanContext.SpanID().String()).
+			Bool(CtxTraceSampled, spanContext.IsSampled())
+	}
+
+	if revent.tl.spanEvent && revent.level >= zerolog.WarnLevel {
+		span := ttrace.GetSpan(ctx)
+		if span.IsRecording() {
+			revent.span = span
+		}
+	}
+
 	return revent
 }
 
-// sizeCheck truncates value to maxDetailLen bytes, appending an ellipsis when truncated.
-func sizeCheck(value string) string {
-	if len(value) <= maxDetailLen {
-		return value
+// recordSpan adds the event to the span remembered by injectTraceId as a span event named "log".
+// Errors recorded with Err are added with span.RecordError, and ERROR and higher events set the
+// span status to codes.Error with content as the description. detail is the recorded detail.
+func (p *Tevent) recordSpan(content, detail string) {
+	if p.span == nil {
+		return
+	}
+
+	attributes := []attribute.KeyValue{
+		attribute.String("log.severity", strings.ToUpper(p.level.String())),
+		attribute.String("log.message", content),
+	}
+
+	if len(p.details) > 0 {
+		attributes = append(attributes, attribute.String("log.detail", detail))
+	}
+
+	if p.err != nil {
+		p.span.RecordError(p.err)
+	}
+
+	p.span.AddEvent("log", trace.WithAttributes(attributes...))
+
+	if p.level >= zerolog.ErrorLevel {
+		p.span.SetStatus(codes.Error, content)
 	}
-	return value[:maxDetailLen] + "..."
 }
 
 // addCaller sets field "caller" to file:line for the first frame outside module path github.com/choveylee.
@@ -313,29 +780,58 @@ func addCaller(tevent *Tevent) *Tevent {
 
 	_, file, line := funcFileLine("github.com/choveylee")
 
-	tevent.event = tevent.event.Str("caller", fmt.Sprintf("%s:%d", file, line))
+	tevent.event = tevent.event.Str(fieldCaller, fmt.Sprintf("%s:%d", file, line))
 
 	return tevent
 }
 
-func (p *Tevent) attachDetail() {
+// attachDetail records the detail fragments, joined with semicolons and cut to their byte budget,
+// under field "detail" and returns the recorded value.
+func (p *Tevent) attachDetail() string {
 	if len(p.details) == 0 {
-		return
+		return ""
 	}
 
-	value := sizeCheck(strings.Join(p.details, ";"))
+	value, _ := p.limit(fieldDetail, strings.Join(p.details, ";"))
 
-	p.event = p.event.Str("detail", value)
+	p.event = p.event.Str(fieldDetail, value)
+
+	return value
 }
 
 func (p *Tevent) enabled() bool {
 	return p != nil && p.event.Enabled()
 }
 
+// noCloseWriter hides the Close method of the wrapped writer, so that closing the writers of a
+// logger leaves standard output and the shared log file open.
 type noCloseWriter struct {
 	io.Writer
 }
 
+// stackTracker is implemented by errors that carry the stack trace of their creation, such as
+// those from github.com/choveylee/terror.
+type stackTracker interface {
+	StackTrack() string
+}
+
+// errorStack returns the stack trace carried by err or any error it wraps. Errors that expand
+// their "%+v" representation, as github.com/pkg/errors does, are reported with that
+// representation. It returns an empty string when no stack trace is available.
+func errorStack(err error) string {
+	var tracker stackTracker
+	if errors.As(err, &tracker) {
+		return tracker.StackTrack()
+	}
+
+	stack := fmt.Sprintf("%+v", err)
+	if stack == err.Error() {
+		return ""
+	}
+
+	return stack
+}
+
 // funcFileLine inspects the call stack, skips frames whose function name contains excludePKG,
 // and returns the short function name, file path, and line for the first remaining frame.
 func funcFileLine(excludePKG string) (string, string, int) {
@@ -0,0 +1,202 @@
+package tlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/rs/zerolog"
+)
+
+// DefaultWebhookTemplate is the default body template of webhook requests: a JSON array of the
+// records in the batch.
+const DefaultWebhookTemplate = "{{json .Records}}"
+
+// WebhookData is the data passed to the body template of webhook requests.
+type WebhookData struct {
+	// AppName is the app_name of the first record in the batch.
+	AppName string
+
+	// Records holds the decoded records of the batch, in the order they were logged.
+	Records []map[string]any
+}
+
+// webhookFuncs are the functions available to body templates in addition to the built-in ones:
+// json encodes a value as JSON, and jsonString encodes a value as a JSON string literal, for use
+// inside a hand-written JSON body.
+var webhookFuncs = template.FuncMap{
+	"json": func(value any) (string, error) {
+		data, err := jsoniter.Marshal(value)
+
+		return string(data), err
+	},
+	"jsonString": func(value any) (string, error) {
+		data, err := jsoniter.Marshal(fmt.Sprintf("%v", value))
+
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"join":  strings.Join,
+}
+
+// WebhookWriter implements zerolog.LevelWriter by posting records at or above a level threshold to
+// an HTTP endpoint in batches, such as a chat webhook or an internal collector. The request body is
+// rendered from a text/template with WebhookData. Failed requests are retried with exponential
+// backoff and jitter, and a circuit breaker stops requests to an endpoint that keeps failing.
+type WebhookWriter struct {
+	*batchWriter
+
+	// minLevel is the lowest level that is sent.
+	minLevel zerolog.Level
+
+	// endpoint is the URL that receives the requests.
+	endpoint string
+
+	// body renders the request body of one batch.
+	body *template.Template
+
+	// headers are added to every request; Content-Type defaults to application/json.
+	headers map[string]string
+
+	breaker *circuitBreaker
+
+	client *http.Client
+}
+
+// newWebhookWriter constructs a WebhookWriter for endpoint. An empty bodyTemplate falls back to
+// DefaultWebhookTemplate. Non-positive timeout, batchSize, and batchInterval values fall back to
+// DefaultSendTimeout, DefaultBatchSize, and DefaultBatchInterval, and non-positive breaker values
+// to DefaultBreakerThreshold and DefaultBreakerCooldown.
+func newWebhookWriter(endpoint string, minLevel zerolog.Level, bodyTemplate string, headers map[string]string,
+	timeout time.Duration, batchSize int, batchInterval time.Duration, breakerThreshold int, breakerCooldown time.Duration) (*WebhookWriter, error) {
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("tlog webhook: invalid url %q: %w", endpoint, err)
+	}
+
+	if endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https" {
+		return nil, fmt.Errorf("tlog webhook: invalid url %q: scheme must be http or https", endpoint)
+	}
+
+	if bodyTemplate == "" {
+		bodyTemplate = DefaultWebhookTemplate
+	}
+
+	body, err := template.New("webhook").Funcs(webhookFuncs).Parse(bodyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("tlog webhook: invalid body template: %w", err)
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultSendTimeout
+	}
+
+	webhookWriter := &WebhookWriter{
+		minLevel: minLevel,
+
+		endpoint: endpointUrl.String(),
+
+		body: body,
+
+		headers: headers,
+
+		breaker: newCircuitBreaker(breakerThreshold, breakerCooldown),
+
+		client: &http.Client{Timeout: timeout},
+	}
+
+	webhookWriter.batchWriter = newBatchWriter("webhook", batchSize, batchInterval, webhookWriter.post)
+
+	return webhookWriter, nil
+}
+
+// Write implements io.Writer for records whose level is only known from their level field.
+func (w *WebhookWriter) Write(p []byte) (int, error) {
+	level := zerolog.NoLevel
+
+	if record, err := decodeRecord(p); err == nil {
+		if levelName, ok := record[fieldLevel].(string); ok {
+			level, _ = zerolog.ParseLevel(levelName)
+		}
+	}
+
+	return w.WriteLevel(level, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter. Records below the level threshold are ignored.
+func (w *WebhookWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < w.minLevel || level == zerolog.NoLevel {
+		return len(p), nil
+	}
+
+	return w.batchWriter.Write(p)
+}
+
+// post renders the body of one batch and sends it with retries, unless the circuit breaker is open.
+func (w *WebhookWriter) post(records [][]byte) error {
+	data := WebhookData{Records: make([]map[string]any, 0, len(records))}
+
+	for _, p := range records {
+		record, err := decodeRecord(p)
+		if err != nil {
+			continue
+		}
+
+		if data.AppName == "" {
+			data.AppName, _ = record[fieldAppName].(string)
+		}
+
+		data.Records = append(data.Records, record)
+	}
+
+	if len(data.Records) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+
+	err := w.body.Execute(&body, data)
+	if err != nil {
+		return fmt.Errorf("cannot render body: %w", err)
+	}
+
+	// The breaker wraps the retries, so that a batch counts as one failure however many attempts
+	// it took.
+	return w.breaker.call(func() error {
+		return sendWithRetry(w.done, func() error {
+			return w.send(body.Bytes())
+		})
+	})
+}
+
+// send sends one request.
+func (w *WebhookWriter) send(body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return newStatusError(resp)
+}
@@ -0,0 +1,226 @@
+package tlog
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// webhookStub is an endpoint that records the requests it receives and answers with status.
+type webhookStub struct {
+	*httptest.Server
+
+	status   atomic.Int64
+	requests atomic.Int64
+
+	lastBody   string
+	lastHeader http.Header
+
+	// onRequest, when not nil, is called by the handler before it answers.
+	onRequest func()
+
+	sync.Mutex
+}
+
+func newWebhookStub(t *testing.T) *webhookStub {
+	t.Helper()
+
+	stub := &webhookStub{}
+	stub.status.Store(http.StatusOK)
+
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		stub.Lock()
+		stub.lastBody = string(body)
+		stub.lastHeader = r.Header.Clone()
+		stub.Unlock()
+
+		stub.requests.Add(1)
+
+		if stub.onRequest != nil {
+			stub.onRequest()
+		}
+
+		w.WriteHeader(int(stub.status.Load()))
+	}))
+
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+func newTestWebhookWriter(t *testing.T, endpoint, bodyTemplate string, headers map[string]string, breakerThreshold int, breakerCooldown time.Duration) *WebhookWriter {
+	t.Helper()
+
+	webhookWriter, err := newWebhookWriter(endpoint, zerolog.WarnLevel, bodyTemplate, headers, time.Second, 100, time.Hour,
+		breakerThreshold, breakerCooldown)
+	if err != nil {
+		t.Fatalf("newWebhookWriter: %v", err)
+	}
+
+	t.Cleanup(func() { webhookWriter.Close() })
+
+	return webhookWriter
+}
+
+var webhookTestRecords = [][]byte{
+	[]byte(`{"level":"error","app_name":"billing","time":"2026-01-02T03:04:05Z","message":"card \"4111\" declined"}` + "\n"),
+	[]byte(`{"level":"warn","app_name":"billing","time":"2026-01-02T03:04:06Z","message":"retrying"}` + "\n"),
+}
+
+func TestWebhookDefaultBody(t *testing.T) {
+	stub := newWebhookStub(t)
+
+	webhookWriter := newTestWebhookWriter(t, stub.URL, "", nil, 0, 0)
+
+	err := webhookWriter.post(webhookTestRecords)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	stub.Lock()
+	defer stub.Unlock()
+
+	if got := stub.lastHeader.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	var body []map[string]any
+
+	err = json.Unmarshal([]byte(stub.lastBody), &body)
+	if err != nil {
+		t.Fatalf("body %s is not a JSON array: %v", stub.lastBody, err)
+	}
+
+	if len(body) != 2 || body[0][fieldMessage] != `card "4111" declined` || body[1][fieldMessage] != "retrying" ||
+		body[0][fieldAppName] != "billing" {
+		t.Errorf("body = %s, want both records", stub.lastBody)
+	}
+}
+
+func TestWebhookTemplateAndHeaders(t *testing.T) {
+	stub := newWebhookStub(t)
+
+	bodyTemplate := `{"text": {{jsonString (upper .AppName)}}, "count": {{len .Records}}, ` +
+		`"first": {{jsonString (index .Records 0).message}}}`
+
+	headers := map[string]string{
+		"Authorization": "Bearer token",
+		"Content-Type":  "application/vnd.alert+json",
+	}
+
+	webhookWriter := newTestWebhookWriter(t, stub.URL, bodyTemplate, headers, 0, 0)
+
+	err := webhookWriter.post(webhookTestRecords)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	stub.Lock()
+	defer stub.Unlock()
+
+	if want := `{"text": "BILLING", "count": 2, "first": "card \"4111\" declined"}`; stub.lastBody != want {
+		t.Errorf("body = %s, want %s", stub.lastBody, want)
+	}
+
+	for key, want := range headers {
+		if got := stub.lastHeader.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestWebhookIgnoresLowLevels(t *testing.T) {
+	stub := newWebhookStub(t)
+
+	webhookWriter := newTestWebhookWriter(t, stub.URL, "", nil, 0, 0)
+
+	for _, record := range []string{`{"level":"info","message":"started"}`, `{"message":"no level"}`} {
+		_, err := webhookWriter.Write([]byte(record + "\n"))
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	webhookWriter.Close()
+
+	if got := stub.requests.Load(); got != 0 {
+		t.Errorf("endpoint received %d requests, want none for records below WARN", got)
+	}
+}
+
+func TestWebhookBreakerTransitions(t *testing.T) {
+	stub := newWebhookStub(t)
+
+	// 400 is not retried, so every batch is one request.
+	stub.status.Store(http.StatusBadRequest)
+
+	webhookWriter := newTestWebhookWriter(t, stub.URL, "", nil, 2, 50*time.Millisecond)
+
+	checkState := func(step string, wantState breakerState, wantRequests int64) {
+		t.Helper()
+
+		if got := webhookWriter.breaker.current(); got != wantState {
+			t.Errorf("%s: breaker is %s, want %s", step, got, wantState)
+		}
+
+		if got := stub.requests.Load(); got != wantRequests {
+			t.Errorf("%s: endpoint received %d requests, want %d", step, got, wantRequests)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		err := webhookWriter.post(webhookTestRecords)
+		if err == nil || errors.Is(err, errCircuitOpen) {
+			t.Fatalf("post %d error = %v, want the status error", i, err)
+		}
+	}
+
+	checkState("after the threshold", breakerOpen, 2)
+
+	err := webhookWriter.post(webhookTestRecords)
+	if !errors.Is(err, errCircuitOpen) {
+		t.Errorf("post while open error = %v, want %v", err, errCircuitOpen)
+	}
+
+	checkState("while open", breakerOpen, 2)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// The trial request after the cooldown fails and reopens the breaker.
+	err = webhookWriter.post(webhookTestRecords)
+	if err == nil || errors.Is(err, errCircuitOpen) {
+		t.Errorf("trial post error = %v, want the status error", err)
+	}
+
+	checkState("after a failed trial", breakerOpen, 3)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// The next trial succeeds and closes the breaker, which is half-open while it is sent.
+	stub.status.Store(http.StatusOK)
+
+	var trialState breakerState
+
+	stub.onRequest = func() { trialState = webhookWriter.breaker.current() }
+
+	err = webhookWriter.post(webhookTestRecords)
+	if err != nil {
+		t.Errorf("second trial post: %v", err)
+	}
+
+	if trialState != breakerHalfOpen {
+		t.Errorf("breaker was %s during the trial request, want %s", trialState, breakerHalfOpen)
+	}
+
+	checkState("after a successful trial", breakerClosed, 4)
+}